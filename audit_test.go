@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditSwitch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	target := filepath.Join(dir, "serverConfig.js")
+	original, err := os.ReadFile("testdata/golden/serverConfig.js.test.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(target, original, 0644)
+
+	for _, env := range []string{"stress", "test"} {
+		opts := switchOptions{ConfigDir: "testdata/configs", TargetPath: target, Env: env, App: "The Vault", Source: sourceProfile}
+		if _, err := executeSwitch(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path, _ := auditLogPath("The Vault")
+	if filepath.Base(path) != "The-Vault-c0c6dd9e.jsonl" {
+		t.Errorf("log file = %s", path)
+	}
+	entries, err := queryAuditLogs("", auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	first, second := entries[0], entries[1]
+	if first.From != "" || first.To != "stress" || second.From != "stress" || second.To != "test" {
+		t.Errorf("envs: %s → %s, %s → %s", first.From, first.To, second.From, second.To)
+	}
+	if first.Before != hashContent(string(original)) || second.After != first.Before || first.After != second.Before {
+		t.Errorf("hashes don't chain: %+v %+v", first, second)
+	}
+	if first.Source != sourceProfile || first.App != "The Vault" || first.Target != target {
+		t.Errorf("entry: %+v", first)
+	}
+
+	filtered, _ := queryAuditLogs("The Vault", auditFilter{Env: "test"})
+	if len(filtered) != 1 || filtered[0].To != "test" {
+		t.Errorf("--env test: %+v", filtered)
+	}
+	if filtered, _ := queryAuditLogs("Other", auditFilter{}); len(filtered) != 0 {
+		t.Errorf("other app: %+v", filtered)
+	}
+	if filtered, _ := queryAuditLogs("", auditFilter{Since: time.Now().Add(time.Hour)}); len(filtered) != 0 {
+		t.Errorf("--since in the future: %+v", filtered)
+	}
+}
+
+func TestAuditLogNames(t *testing.T) {
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	seen := make(map[string]string)
+	for _, app := range []string{"", "default", "a/b", "a-b", "a b", "A-b"} {
+		path, err := auditLogPath(app)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other, taken := seen[path]; taken {
+			t.Errorf("'%s' and '%s' share %s", app, other, path)
+		}
+		seen[path] = app
+	}
+}
+
+// The previous env is found from the end of the log, across read chunks
+func TestLastLoggedEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.jsonl")
+	line := func(target, env string, pad int) string {
+		data, _ := json.Marshal(auditEntry{To: env, Target: target, Config: strings.Repeat("x", pad)})
+		return string(data) + "\n"
+	}
+	match := line("/app/env.js", "stress", 0)
+
+	// Lines of another target after the match, so the match is cut by the
+	// start of the last chunk
+	var after strings.Builder
+	size, other := auditReadChunk-len(match)/2, len(line("/other.js", "test", 0))
+	for size-after.Len() > 2*(other+100) {
+		after.WriteString(line("/other.js", "test", 100))
+	}
+	after.WriteString(line("/other.js", "test", size-after.Len()-other))
+	if after.Len() != size {
+		t.Fatalf("layout: %d bytes after the match", after.Len())
+	}
+
+	for _, tt := range []struct {
+		name    string
+		content string
+		target  string
+		want    string
+	}{
+		{"no log", "", "/app/env.js", ""},
+		{"last line", line("/app/env.js", "test", 0) + match, "/app/env.js", "stress"},
+		{"cut by a chunk", line("/app/env.js", "test", auditReadChunk) + match + after.String(), "/app/env.js", "stress"},
+		{"chunks back", match + after.String() + after.String(), "/app/env.js", "stress"},
+		{"other target", match + after.String(), "/other.js", "test"},
+		{"never switched", match + after.String(), "/new.js", ""},
+		{"malformed line", match + "{not json\n", "/app/env.js", "stress"},
+	} {
+		os.Remove(path)
+		if tt.content != "" {
+			os.WriteFile(path, []byte(tt.content), 0600)
+		}
+		if got, err := lastLoggedEnv(path, tt.target); err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"36h", time.Date(2024, 5, 9, 0, 0, 0, 0, time.UTC)},
+		{"7d", time.Date(2024, 5, 3, 12, 0, 0, 0, time.UTC)},
+		{"2024-05-01", time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{"2024-05-01T08:30:00Z", time.Date(2024, 5, 1, 8, 30, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseSince(tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseSince(%s) = %v, %v, want %v", tt.value, got, err, tt.want)
+		}
+	}
+	if _, err := parseSince("yesterday", now); errorCode(err) != codeUsage {
+		t.Errorf("parseSince(yesterday) = %v, want a usage error", err)
+	}
+}
+
+// Switches through a proxy write no file; they are logged with the proxy as
+// their target
+func TestAuditProxySwitch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	proxy := &envProxy{
+		load: func(env string) (*Config, error) {
+			return &Config{Server: map[string]interface{}{"quest": "https://" + env + ".example.com"}}, nil
+		},
+		protected: func(env string) bool { return env == "prod" },
+		status:    proxyStatus{App: "The Vault"},
+	}
+	if err := proxy.switchEnv("test"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+	port := server.Listener.Addr().(*net.TCPAddr).Port
+
+	config := PersistentConfig{
+		Apps:     map[string]AppConfig{"The Vault": {ConfigDir: "testdata/configs", ProxyPort: port}},
+		Profiles: map[string]map[string]string{"stress": {"The Vault": "stress"}},
+	}
+	if err := savePersistentConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	results, err := applyProfile(config, "stress", false, false)
+	if err != nil || results[0].Err != nil {
+		t.Fatalf("profile: %v %+v", err, results)
+	}
+	// Without --app, the proxy tells which app it serves
+	opts := switchOptions{ConfigDir: "testdata/configs", Env: "test", Source: sourceTUI}
+	if _, err := switchAppProxy(opts, port); err != nil {
+		t.Fatal(err)
+	}
+	opts.Env = "prod"
+	if _, err := switchAppProxy(opts, port); errorCode(err) != codeProtectedEnv {
+		t.Fatalf("unconfirmed prod: err = %v", err)
+	}
+
+	entries, err := queryAuditLogs("The Vault", auditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v, want the two proxy switches", entries)
+	}
+	first, second := entries[0], entries[1]
+	if first.To != "stress" || first.Source != sourceProfile || second.From != "stress" || second.To != "test" || second.Source != sourceTUI {
+		t.Errorf("entries = %+v", entries)
+	}
+	if first.Target != proxyAuditTarget(port) || first.Before != "" || first.After != "" || !strings.HasSuffix(first.Config, "config.stress.json") {
+		t.Errorf("proxy entry = %+v", first)
+	}
+	if line := formatAuditEntry(first); !strings.Contains(line, "(no files)") || !strings.Contains(line, proxyAuditTarget(port)) {
+		t.Errorf("log line = %q", line)
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// tlsExpiryWarning is how close to expiry a certificate gets flagged
+const tlsExpiryWarning = 14 * 24 * time.Hour
+
+// endpoint is a URL field of a config
+type endpoint struct {
+	Name string
+	URL  string
+}
+
+// checkResult is the outcome of requesting one endpoint
+type checkResult struct {
+	Endpoint  endpoint
+	Status    int // 0 when no response came back
+	Latency   time.Duration
+	TLSExpiry time.Time // zero for plain http
+	Err       error
+}
+
+// failed reports whether the endpoint is down: no response or a 5xx
+func (r checkResult) failed() bool {
+	return r.Err != nil || r.Status >= 500
+}
+
+// configEndpoints lists the URL fields of a config: server (or every key of the
+// urls map, in config order), questServer and walkmeUrl
+func configEndpoints(config *Config) []endpoint {
+	endpoints := make([]endpoint, 0)
+	switch server := config.Server.(type) {
+	case string:
+		endpoints = append(endpoints, endpoint{"server", server})
+	case map[string]interface{}:
+		for _, key := range config.orderedServerKeys() {
+			if url, ok := server[key].(string); ok {
+				endpoints = append(endpoints, endpoint{"server." + key, url})
+			}
+		}
+	}
+	endpoints = append(endpoints,
+		endpoint{"questServer", config.QuestServer},
+		endpoint{"walkmeUrl", config.WalkmeUrl},
+	)
+
+	// Skip empty fields and anything that isn't an http(s) URL
+	urls := endpoints[:0]
+	for _, e := range endpoints {
+		if strings.HasPrefix(e.URL, "http://") || strings.HasPrefix(e.URL, "https://") {
+			urls = append(urls, e)
+		}
+	}
+	return urls
+}
+
+// checkEndpoint sends a HEAD request, falling back to GET when the server
+// doesn't support HEAD
+func checkEndpoint(client *http.Client, e endpoint) checkResult {
+	result := checkResult{Endpoint: e}
+	start := time.Now()
+	resp, err := client.Head(e.URL)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		start = time.Now()
+		resp, err = client.Get(e.URL)
+	}
+	result.Latency = time.Since(start)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	defer resp.Body.Close()
+
+	result.Status = resp.StatusCode
+	if resp.TLS != nil && len(resp.TLS.PeerCertificates) > 0 {
+		result.TLSExpiry = resp.TLS.PeerCertificates[0].NotAfter
+	}
+	return result
+}
+
+// checkEndpoints checks every endpoint concurrently and returns the results in
+// the order of endpoints
+func checkEndpoints(client *http.Client, endpoints []endpoint) []checkResult {
+	results := make([]checkResult, len(endpoints))
+	var wg sync.WaitGroup
+	for i, e := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = checkEndpoint(client, e)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// formatCheckResult renders the result of one endpoint, with errors and the
+// TLS expiry on their own lines
+func formatCheckResult(r checkResult, now time.Time, secrets []string) string {
+	icon := "✓"
+	switch {
+	case r.failed():
+		icon = "✗"
+	case r.Status >= 400:
+		icon = "⚠️"
+	}
+
+	status := "---"
+	if r.Status != 0 {
+		status = fmt.Sprintf("%d", r.Status)
+	}
+	line := fmt.Sprintf("%s %-20s %s  %6s  %s", icon, r.Endpoint.Name, status, r.Latency.Round(time.Millisecond), maskSecrets(r.Endpoint.URL, secrets))
+
+	if r.Err != nil {
+		line += fmt.Sprintf("\n    %v", r.Err)
+	}
+	if !r.TLSExpiry.IsZero() {
+		left := r.TLSExpiry.Sub(now)
+		note := fmt.Sprintf("TLS expires %s (%d days)", r.TLSExpiry.Format("2006-01-02"), int(left.Hours()/24))
+		switch {
+		case left <= 0:
+			note = fmt.Sprintf("⚠️  TLS certificate expired on %s", r.TLSExpiry.Format("2006-01-02"))
+		case left < tlsExpiryWarning:
+			note = "⚠️  " + note
+		}
+		line += "\n    " + note
+	}
+	return line
+}
+
+// printCheckResults prints one line per endpoint
+func printCheckResults(results []checkResult, secrets []string) {
+	if len(results) == 0 {
+		fmt.Println("No URLs to check")
+		return
+	}
+	now := time.Now()
+	for _, r := range results {
+		fmt.Println(formatCheckResult(r, now, secrets))
+	}
+}
+
+// checkFailure returns an endpoint-down error when any endpoint is down
+func checkFailure(results []checkResult) error {
+	failures := 0
+	for _, r := range results {
+		if r.failed() {
+			failures++
+		}
+	}
+	if failures > 0 {
+		return withCode(codeEndpointDown, fmt.Errorf("%d of %d endpoints are down", failures, len(results)))
+	}
+	return nil
+}
+
+// checkReport is the --output json form of a checkResult
+type checkReport struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Status    int        `json:"status,omitempty"`
+	LatencyMs int64      `json:"latencyMs"`
+	TLSExpiry *time.Time `json:"tlsExpiry,omitempty"`
+	Down      bool       `json:"down"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// checkReports converts results for --output json, masking secrets in URLs
+func checkReports(results []checkResult, secrets []string) []checkReport {
+	reports := make([]checkReport, 0, len(results))
+	for _, r := range results {
+		report := checkReport{
+			Name:      r.Endpoint.Name,
+			URL:       maskSecrets(r.Endpoint.URL, secrets),
+			Status:    r.Status,
+			LatencyMs: r.Latency.Milliseconds(),
+			Down:      r.failed(),
+		}
+		if !r.TLSExpiry.IsZero() {
+			expiry := r.TLSExpiry
+			report.TLSExpiry = &expiry
+		}
+		if r.Err != nil {
+			report.Error = r.Err.Error()
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// runCheck is `envswitch check <env>`: a health check of the URLs of an env
+func runCheck(args []string) error {
+	fs := flag.NewFlagSet("check", flag.ContinueOnError)
+	flags := addEnvFlags(fs)
+	timeout := fs.Duration("timeout", 5*time.Second, "Time limit for each request")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	if *flags.env == "" && len(positional) > 0 {
+		*flags.env = positional[0]
+	}
+	if err := flags.resolve(fs); err != nil {
+		return err
+	}
+	if *flags.env == "" {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch check <env> [--app name] [--config-dir dir] [--js] [--timeout 5s]"))
+	}
+
+	configPath := envConfigPath(*flags.configDir, *flags.env, flags.configTypeValue())
+	config, err := loadCommandConfig(configPath, flags.configTypeValue(), *flags.keyFile)
+	if err != nil {
+		return err
+	}
+
+	if !jsonOutput() {
+		fmt.Printf("Checking environment: %s\n\n", *flags.env)
+	}
+	results := checkEndpoints(&http.Client{Timeout: *timeout}, configEndpoints(config))
+	secrets := flags.secrets(config)
+	if jsonOutput() {
+		return printJSON("check", checkCommandResult{*flags.env, configPath, checkReports(results, secrets)}, nil, checkFailure(results))
+	}
+	printCheckResults(results, secrets)
+	return checkFailure(results)
+}
+
+// checkCommandResult is the --output json result of `envswitch check`
+type checkCommandResult struct {
+	Env        string        `json:"env"`
+	ConfigPath string        `json:"configPath"`
+	Checks     []checkReport `json:"checks"`
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigEndpoints(t *testing.T) {
+	config := &Config{
+		Server:      map[string]interface{}{"vault": "https://v", "quest": "https://q", "flag": true},
+		QuestServer: "http://qs",
+		QuestFront:  "https://front-is-not-checked",
+		WalkmeUrl:   "",
+		serverKeys:  []string{"vault", "quest", "flag"},
+	}
+	names := make([]string, 0)
+	for _, e := range configEndpoints(config) {
+		names = append(names, e.Name)
+	}
+	if got := strings.Join(names, ","); got != "server.vault,server.quest,questServer" {
+		t.Errorf("endpoints = %s", got)
+	}
+
+	config = &Config{Server: "not a url", WalkmeUrl: "https://w/w.js"}
+	if got := configEndpoints(config); len(got) != 1 || got[0].Name != "walkmeUrl" {
+		t.Errorf("endpoints = %v, want only walkmeUrl", got)
+	}
+}
+
+func TestCheckEndpoint(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {})
+	mux.HandleFunc("/get-only", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/missing", http.NotFound)
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := &http.Client{Timeout: 200 * time.Millisecond}
+
+	tests := []struct {
+		path   string
+		status int
+		failed bool
+	}{
+		{"/ok", 200, false},
+		{"/get-only", 200, false},
+		{"/down", 502, true},
+		{"/missing", 404, false}, // the server answers, so it isn't down
+		{"/slow", 0, true},
+	}
+	for _, tt := range tests {
+		r := checkEndpoint(client, endpoint{"server", server.URL + tt.path})
+		if r.Status != tt.status || r.failed() != tt.failed {
+			t.Errorf("%s: status %d failed %v (err %v), want %d %v", tt.path, r.Status, r.failed(), r.Err, tt.status, tt.failed)
+		}
+		if !r.TLSExpiry.IsZero() {
+			t.Errorf("%s: plain http has a TLS expiry", tt.path)
+		}
+	}
+}
+
+func TestCheckEndpointTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	r := checkEndpoint(server.Client(), endpoint{"server", server.URL})
+	if r.Err != nil || r.Status != 200 {
+		t.Fatalf("status %d, err %v", r.Status, r.Err)
+	}
+	if want := server.Certificate().NotAfter; !r.TLSExpiry.Equal(want) {
+		t.Errorf("TLS expiry = %v, want %v", r.TLSExpiry, want)
+	}
+
+	line := formatCheckResult(r, r.TLSExpiry.Add(-3*24*time.Hour), nil)
+	if !strings.Contains(line, "⚠️  TLS expires") || !strings.Contains(line, "(3 days)") {
+		t.Errorf("expiring certificate not flagged:\n%s", line)
+	}
+}
+
+func TestCheckEndpointsConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	endpoints := []endpoint{{"a", server.URL + "/a"}, {"b", server.URL + "/b"}, {"c", server.URL + "/c"}}
+	start := time.Now()
+	results := checkEndpoints(server.Client(), endpoints)
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("3 checks of 200ms took %v; they should run concurrently", elapsed)
+	}
+	for i, r := range results {
+		if r.Endpoint != endpoints[i] || r.Status != 200 {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+}
@@ -1,11 +1,12 @@
 package main
 
 import (
-	"encoding/json"
+	"bytes"
 	"fmt"
-	"os"
-	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
@@ -69,6 +70,12 @@ var (
 			Foreground(lipgloss.Color("#FFA500")).
 			Italic(true)
 
+	protectedStyle = lipgloss.NewStyle().
+			Bold(true).
+			Foreground(whiteColor).
+			Background(lipgloss.Color("#CC0000")).
+			Padding(0, 1)
+
 	pixelArt = `
  ███████╗███╗   ██╗██╗   ██╗    ███████╗██╗    ██╗██╗████████╗ ██████╗██╗  ██╗
  ██╔════╝████╗  ██║██║   ██║    ██╔════╝██║    ██║██║╚══██╔══╝██╔════╝██║  ██║
@@ -81,7 +88,17 @@ var (
 
 // PersistentConfig stores saved paths per app
 type PersistentConfig struct {
+	// Version is the schema version of the file (see store.go)
+	Version int `json:"version"`
+
 	Apps map[string]AppConfig `json:"apps"`
+
+	// Profiles map a profile name to the env of each of its apps
+	Profiles map[string]map[string]string `json:"profiles,omitempty"`
+
+	// TrustedWorkspaces maps a workspace file to the SHA-256 of the content
+	// whose hooks the user allowed (`envswitch workspace trust`)
+	TrustedWorkspaces map[string]string `json:"trustedWorkspaces,omitempty"`
 }
 
 // AppConfig stores the saved paths for an app
@@ -89,8 +106,66 @@ type AppConfig struct {
 	ConfigDir  string `json:"configDir"`
 	TargetPath string `json:"targetPath"`
 	LastEnv    string `json:"lastEnv"`
-	UseJS      bool   `json:"useJS"`
 	Format     string `json:"format"` // "serverConfig" or "envJs"
+
+	// ConfigType picks the config files: auto (by extension), json, js,
+	// js-eval, yaml or toml. UseJS is the setting it replaced, still read
+	// from workspace files.
+	ConfigType string `json:"configType,omitempty"`
+	UseJS      bool   `json:"useJS,omitempty"`
+
+	// Template renders the whole target with text/template instead of
+	// rewriting an existing one (see template.go)
+	Template string `json:"template,omitempty"`
+
+	// SecretFields marks extra config fields (e.g. "google.analytics") as secret
+	SecretFields []string `json:"secretFields,omitempty"`
+
+	// KeyFile holds the passphrase for its enc:v1: secrets (default
+	// $ENVSWITCH_SECRET_KEY or ~/.envswitch.key)
+	KeyFile string `json:"keyFile,omitempty"`
+
+	// Shell commands run before/after writing the target (see hooks.go)
+	PreSwitch             []string `json:"preSwitch,omitempty"`
+	PostSwitch            []string `json:"postSwitch,omitempty"`
+	HookTimeout           string   `json:"hookTimeout,omitempty"` // e.g. "30s", default 2m
+	RollbackOnPostFailure bool     `json:"rollbackOnPostFailure,omitempty"`
+
+	// Git guard: the env the committed target should point at, and whether to
+	// mark the target skip-worktree while it points somewhere else
+	DefaultEnv   string `json:"defaultEnv,omitempty"`
+	SkipWorktree bool   `json:"skipWorktree,omitempty"`
+
+	// ProxyPort is set once `envswitch proxy init` pointed the target at a local
+	// proxy; switches then go to the proxy instead of rewriting the target
+	ProxyPort int `json:"proxyPort,omitempty"`
+
+	// ProtectedEnvs need typed confirmation (or --yes-i-mean-prod) to switch
+	// to, like configs with protected: true
+	ProtectedEnvs []string `json:"protectedEnvs,omitempty"`
+
+	// workspace is the .envswitch.yaml the app comes from ("" for personal apps)
+	workspace string
+
+	// untrustedHooks is set when the hooks of the app's workspace file were
+	// dropped because the file isn't trusted (see workspace.go)
+	untrustedHooks bool
+
+	// setFields are the JSON keys the app was read with; they are written back
+	// even when empty, so an override can turn a workspace setting off
+	setFields []string
+}
+
+// configType returns the config type of the app ("auto" when unset)
+func (a AppConfig) configType() string {
+	switch {
+	case a.ConfigType != "":
+		return a.ConfigType
+	case a.UseJS:
+		return "js"
+	default:
+		return configTypeAuto
+	}
 }
 
 // CLI states
@@ -107,8 +182,20 @@ const (
 	stateAddAppName
 	stateAddAppConfigDir
 	stateAddAppTargetPath
-	stateAddAppUseJS
+	stateAddAppConfigType
 	stateAddAppFormat
+	stateSelectProfile
+	stateImportApps
+	stateExportApps
+	stateConfirmProtected
+)
+
+// Special entries of the app list
+const (
+	profilesEntry = "📚 Profiles..."
+	addAppEntry   = "➕ Add New App..."
+	importEntry   = "📥 Import Apps..."
+	exportEntry   = "📤 Export Apps..."
 )
 
 // Menu options for app menu
@@ -120,89 +207,99 @@ const (
 
 // Model represents the application state
 type model struct {
-	state            state
-	selectedApp      int
-	apps             []string // App names from config
-	configDir        string
-	targetPath       string
-	env              string
-	useJS            bool
-	format           string // "serverConfig" or "envJs"
-	textInput        textinput.Model
-	err              error
-	result           string
-	quitting         bool
-	persistentConfig PersistentConfig
-	hasSavedConfig   bool
-	menuOption       int
-	newAppName       string
-	formatOption     int // 0 = serverConfig, 1 = envJs
+	state             state
+	selectedApp       int
+	apps              []string // App names from config
+	configDir         string
+	targetPath        string
+	env               string
+	configType        string
+	format            string // "serverConfig" or "envJs"
+	textInput         textinput.Model
+	err               error
+	result            string
+	quitting          bool
+	persistentConfig  PersistentConfig
+	hasSavedConfig    bool
+	menuOption        int
+	newAppName        string
+	formatOption      int     // 0 = serverConfig, 1 = envJs
+	preview           *Config // config loaded for the confirm screen
+	previewErr        error
+	reveal            bool // show secrets in full on the confirm screen
+	hookOutput        string
+	offerSkipWorktree bool // target is tracked by git and now differs from its default env
+	profiles          []string
+	selectedProfile   int
+	proxies           []proxyStatus // running proxies of apps in proxy mode
+	protected         bool          // the app's env (or the one being switched to) is protected
+	confirmProfile    string        // profile waiting for its name to be typed (stateConfirmProtected)
+	protectedApps     []string      // the apps of confirmProfile going to a protected env
 }
 
-// getConfigPath returns the path to the persistent config file
-func getConfigPath() string {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return ".envswitch-config.json"
-	}
-	return filepath.Join(homeDir, ".envswitch-config.json")
-}
+// proxyPollInterval is how often the TUI asks the running proxies for their env
+const proxyPollInterval = 2 * time.Second
 
-// loadPersistentConfig loads the saved configuration
-func loadPersistentConfig() PersistentConfig {
-	config := PersistentConfig{
-		Apps: make(map[string]AppConfig),
-	}
+// proxyStatusMsg carries the proxies that answered a poll
+type proxyStatusMsg []proxyStatus
 
-	data, err := os.ReadFile(getConfigPath())
-	if err != nil {
-		// Initialize with default app - The Vault uses JS
-		config.Apps["The Vault"] = AppConfig{UseJS: true}
-		return config
-	}
+// proxyTickMsg starts the next poll
+type proxyTickMsg struct{}
 
-	json.Unmarshal(data, &config)
-	if config.Apps == nil {
-		config.Apps = make(map[string]AppConfig)
-		config.Apps["The Vault"] = AppConfig{UseJS: true}
-	}
+// pollProxies asks the proxy of every app in proxy mode which env it forwards to
+func pollProxies(config PersistentConfig) tea.Cmd {
+	return func() tea.Msg {
+		ports := make([]int, 0)
+		for _, app := range config.Apps {
+			if app.ProxyPort != 0 && !slices.Contains(ports, app.ProxyPort) {
+				ports = append(ports, app.ProxyPort)
+			}
+		}
+		sort.Ints(ports)
 
-	// Ensure "The Vault" always has UseJS = true (legacy fix)
-	if vault, exists := config.Apps["The Vault"]; exists {
-		vault.UseJS = true
-		config.Apps["The Vault"] = vault
+		running := make([]proxyStatus, 0, len(ports))
+		for _, port := range ports {
+			if status, err := fetchProxyStatus(port, 300*time.Millisecond); err == nil {
+				running = append(running, *status)
+			}
+		}
+		return proxyStatusMsg(running)
 	}
-
-	return config
 }
 
-// savePersistentConfig saves the configuration to disk
-func savePersistentConfig(config PersistentConfig) error {
-	data, err := json.MarshalIndent(config, "", "  ")
+// updateConfig saves a change on top of the latest saved file (another session
+// may have changed it meanwhile) and takes it as the in-memory settings. When
+// the save fails, they stay as they were.
+func (m *model) updateConfig(change func(config *PersistentConfig)) error {
+	config, err := updatePersistentConfig(func(config *PersistentConfig) error {
+		change(config)
+		return nil
+	})
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(getConfigPath(), data, 0644)
+	m.persistentConfig = config
+	return nil
 }
 
 // getAppNames returns sorted list of app names
 func getAppNames(config PersistentConfig) []string {
-	names := make([]string, 0, len(config.Apps)+1)
+	names := make([]string, 0, len(config.Apps)+2)
 	for name := range config.Apps {
 		names = append(names, name)
 	}
-	names = append(names, "➕ Add New App...")
+	sort.Strings(names)
+	names = append(names, profilesEntry, addAppEntry, importEntry, exportEntry)
 	return names
 }
 
-func initialModel() model {
+func initialModel(persistentConfig PersistentConfig) model {
 	ti := textinput.New()
 	ti.Placeholder = "Type here..."
 	ti.Focus()
 	ti.CharLimit = 500
 	ti.Width = 60
 
-	persistentConfig := loadPersistentConfig()
 	apps := getAppNames(persistentConfig)
 
 	return model{
@@ -215,11 +312,16 @@ func initialModel() model {
 }
 
 func (m model) Init() tea.Cmd {
-	return textinput.Blink
+	return tea.Batch(textinput.Blink, pollProxies(m.persistentConfig))
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	switch msg := msg.(type) {
+	case proxyStatusMsg:
+		m.proxies = msg
+		return m, tea.Tick(proxyPollInterval, func(time.Time) tea.Msg { return proxyTickMsg{} })
+	case proxyTickMsg:
+		return m, pollProxies(m.persistentConfig)
 	case tea.KeyMsg:
 		switch msg.String() {
 		case "ctrl+c":
@@ -227,7 +329,7 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, tea.Quit
 		case "q":
 			// Only quit if not in an input state
-			if m.state == stateSelectApp || m.state == stateAppMenu {
+			if m.state == stateSelectApp || m.state == stateAppMenu || m.state == stateSelectProfile {
 				m.quitting = true
 				return m, tea.Quit
 			}
@@ -241,12 +343,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.selectedApp > 0 {
 					m.selectedApp--
 				}
+			case stateSelectProfile:
+				if m.selectedProfile > 0 {
+					m.selectedProfile--
+				}
 			case stateAppMenu:
 				if m.menuOption > 0 {
 					m.menuOption--
 				}
-			case stateAddAppUseJS:
-				m.useJS = !m.useJS
+			case stateAddAppConfigType:
+				m.configType = stepConfigType(m.configType, -1)
 			case stateAddAppFormat:
 				m.formatOption = 1 - m.formatOption // toggle between 0 and 1
 				if m.formatOption == 0 {
@@ -261,12 +367,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				if m.selectedApp < len(m.apps)-1 {
 					m.selectedApp++
 				}
+			case stateSelectProfile:
+				if m.selectedProfile < len(m.profiles)-1 {
+					m.selectedProfile++
+				}
 			case stateAppMenu:
 				if m.menuOption < 2 {
 					m.menuOption++
 				}
-			case stateAddAppUseJS:
-				m.useJS = !m.useJS
+			case stateAddAppConfigType:
+				m.configType = stepConfigType(m.configType, 1)
 			case stateAddAppFormat:
 				m.formatOption = 1 - m.formatOption // toggle between 0 and 1
 				if m.formatOption == 0 {
@@ -275,6 +385,17 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.format = "envJs"
 				}
 			}
+		case "s":
+			// Accept the skip-worktree offer on the result screen
+			if m.state == stateDone && m.offerSkipWorktree {
+				return m.acceptSkipWorktree()
+			}
+		case "r":
+			// Toggle secret masking on the confirm screen
+			if m.state == stateConfirm {
+				m.reveal = !m.reveal
+				return m, nil
+			}
 		case "enter":
 			return m.handleEnter()
 		case "esc":
@@ -292,13 +413,28 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// showProtectedBanner reports whether the header warns about a protected env:
+// the app's current env, the one being switched to, or the one just switched to
+func (m model) showProtectedBanner() bool {
+	switch m.state {
+	case stateAppMenu, stateInputEnv, stateConfirm, stateConfirmProtected:
+		return m.protected
+	case stateDone:
+		return m.protected && m.err == nil
+	}
+	return false
+}
+
 func (m model) isInputState() bool {
 	return m.state == stateInputConfigDir ||
 		m.state == stateInputTargetPath ||
 		m.state == stateInputEnv ||
 		m.state == stateAddAppName ||
 		m.state == stateAddAppConfigDir ||
-		m.state == stateAddAppTargetPath
+		m.state == stateAddAppTargetPath ||
+		m.state == stateImportApps ||
+		m.state == stateExportApps ||
+		m.state == stateConfirmProtected
 }
 
 func (m model) handleEsc() (tea.Model, tea.Cmd) {
@@ -306,6 +442,8 @@ func (m model) handleEsc() (tea.Model, tea.Cmd) {
 	case stateAppMenu:
 		m.state = stateSelectApp
 		m.menuOption = 0
+		m.protected = false
+		m.err = nil
 	case stateInputConfigDir:
 		m.state = stateAppMenu
 		m.menuOption = 0
@@ -327,6 +465,13 @@ func (m model) handleEsc() (tea.Model, tea.Cmd) {
 		m.state = stateInputEnv
 		m.textInput.SetValue(m.env)
 		m.textInput.Placeholder = "Environment name..."
+	case stateConfirmProtected:
+		m.state = stateConfirm
+		if m.confirmProfile != "" {
+			m.state = stateSelectProfile
+			m.confirmProfile = ""
+		}
+		m.err = nil
 	case stateAddAppName:
 		m.state = stateSelectApp
 	case stateAddAppConfigDir:
@@ -337,12 +482,16 @@ func (m model) handleEsc() (tea.Model, tea.Cmd) {
 		m.state = stateAddAppConfigDir
 		m.textInput.SetValue(m.configDir)
 		m.textInput.Placeholder = "Config directory path..."
-	case stateAddAppUseJS:
+	case stateAddAppConfigType:
 		m.state = stateAddAppTargetPath
 		m.textInput.SetValue(m.targetPath)
 		m.textInput.Placeholder = "Target file path..."
 	case stateAddAppFormat:
-		m.state = stateAddAppUseJS
+		m.state = stateAddAppConfigType
+		m.err = nil
+	case stateSelectProfile, stateImportApps, stateExportApps:
+		m.state = stateSelectApp
+		m.err = nil
 	}
 	return m, nil
 }
@@ -353,7 +502,26 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 		appName := m.apps[m.selectedApp]
 
 		// Check if "Add New App" was selected
-		if appName == "➕ Add New App..." {
+		if appName == profilesEntry {
+			m.state = stateSelectProfile
+			m.profiles = profileNames(m.persistentConfig)
+			m.selectedProfile = 0
+			return m, nil
+		}
+		if appName == importEntry || appName == exportEntry {
+			m.state = stateImportApps
+			m.textInput.SetValue("")
+			m.textInput.Placeholder = "Path of the apps file to import..."
+			if appName == exportEntry {
+				m.state = stateExportApps
+				m.textInput.SetValue("envswitch-apps.json")
+				m.textInput.Placeholder = "Path to write the apps file to..."
+			}
+			m.textInput.Focus()
+			m.err = nil
+			return m, textinput.Blink
+		}
+		if appName == addAppEntry {
 			m.state = stateAddAppName
 			m.textInput.SetValue("")
 			m.textInput.Placeholder = "Enter new app name..."
@@ -361,7 +529,7 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 			m.newAppName = ""
 			m.configDir = ""
 			m.targetPath = ""
-			m.useJS = false
+			m.configType = configTypeAuto
 			return m, textinput.Blink
 		}
 
@@ -370,12 +538,14 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 			m.configDir = savedConfig.ConfigDir
 			m.targetPath = savedConfig.TargetPath
 			m.env = savedConfig.LastEnv
-			m.useJS = savedConfig.UseJS
+			m.configType = savedConfig.configType()
 			m.format = savedConfig.Format
 			if m.format == "" {
 				m.format = "serverConfig" // default
 			}
 			m.hasSavedConfig = savedConfig.ConfigDir != "" && savedConfig.TargetPath != ""
+			m.protected = m.hasSavedConfig && m.env != "" &&
+				envProtected(m.configDir, m.env, m.configType, savedConfig.ProtectedEnvs)
 		}
 
 		// If we have saved paths, show menu. Otherwise go to config input
@@ -414,8 +584,13 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 		case menuOptionDelete:
 			// Delete app
 			appName := m.apps[m.selectedApp]
-			delete(m.persistentConfig.Apps, appName)
-			savePersistentConfig(m.persistentConfig)
+			if err := m.updateConfig(func(config *PersistentConfig) {
+				delete(config.Apps, appName)
+			}); err != nil {
+				m.err = fmt.Errorf("could not delete %s: %v", appName, err)
+				return m, nil
+			}
+			m.err = nil
 			m.apps = getAppNames(m.persistentConfig)
 			if m.selectedApp >= len(m.apps) {
 				m.selectedApp = len(m.apps) - 1
@@ -463,41 +638,99 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 		if value != "" {
 			m.env = value
 		}
+		saved := m.persistentConfig.Apps[m.apps[m.selectedApp]]
+		m.preview, m.previewErr = loadEnvConfig(envConfigPath(m.configDir, m.env, m.configType), m.configType, saved.KeyFile)
+		m.protected = isProtected(m.preview, m.env, saved.ProtectedEnvs)
+		m.reveal = false
 		m.state = stateConfirm
 		return m, nil
 
 	case stateConfirm:
-		// Save the config before executing
-		appName := m.apps[m.selectedApp]
-		m.persistentConfig.Apps[appName] = AppConfig{
-			ConfigDir:  m.configDir,
-			TargetPath: m.targetPath,
-			LastEnv:    m.env,
-			UseJS:      m.useJS,
-			Format:     m.format,
+		// Protected envs need their name typed first
+		if m.protected {
+			m.state = stateConfirmProtected
+			m.textInput.SetValue("")
+			m.textInput.Placeholder = fmt.Sprintf("Type '%s' to confirm...", m.env)
+			m.textInput.Focus()
+			m.err = nil
+			return m, textinput.Blink
+		}
+		return m.switchEnv()
+
+	case stateConfirmProtected:
+		if profile := m.confirmProfile; profile != "" {
+			if value := strings.TrimSpace(m.textInput.Value()); value != profile {
+				m.err = fmt.Errorf("'%s' is not '%s': type the profile name exactly to apply it", value, profile)
+				return m, nil
+			}
+			m.err = nil
+			m.confirmProfile = ""
+			return m.switchProfile(profile, true)
+		}
+		if value := strings.TrimSpace(m.textInput.Value()); value != m.env {
+			m.err = fmt.Errorf("'%s' is not '%s': type the env name exactly to switch", value, m.env)
+			return m, nil
+		}
+		m.err = nil
+		return m.switchEnv()
+
+	case stateDone:
+		m.quitting = true
+		return m, tea.Quit
+
+	case stateSelectProfile:
+		if len(m.profiles) == 0 {
+			return m, nil
+		}
+		profile := m.profiles[m.selectedProfile]
+		m.protected = false
+		// Like a single switch, protected envs need a typed confirmation
+		if apps := protectedProfileApps(m.persistentConfig, profile); len(apps) > 0 {
+			m.confirmProfile, m.protectedApps = profile, apps
+			m.state = stateConfirmProtected
+			m.textInput.SetValue("")
+			m.textInput.Placeholder = fmt.Sprintf("Type '%s' to confirm...", profile)
+			m.textInput.Focus()
+			m.err = nil
+			return m, textinput.Blink
+		}
+		return m.switchProfile(profile, false)
+
+	// Import/export, with paths relative to the directory envswitch runs in
+	case stateImportApps:
+		value := strings.TrimSpace(m.textInput.Value())
+		if value == "" {
+			return m, nil
 		}
-		savePersistentConfig(m.persistentConfig)
-
-		// Execute the switch
-		err := executeSwitchNew(
-			m.configDir,
-			m.targetPath,
-			m.env,
-			m.useJS,
-			m.format,
-		)
+		report, err := importAppsFile(value, ".", "skip", false)
 		if err != nil {
 			m.err = err
-			m.result = fmt.Sprintf("❌ Error: %v", err)
-		} else {
-			m.result = fmt.Sprintf("✅ Successfully switched to %s environment!", m.env)
+			return m, nil
+		}
+		if config, err := loadPersistentConfig(); err == nil {
+			m.persistentConfig = config
+			m.apps = getAppNames(config)
 		}
+		m.result = fmt.Sprintf("✅ Imported apps from %s\n%s\n\nExisting apps were skipped and hooks left out; use `envswitch apps import --on-conflict overwrite|rename --allow-hooks` to replace or rename them, or import hooks.", value, formatImportReport(report))
 		m.state = stateDone
 		return m, nil
 
-	case stateDone:
-		m.quitting = true
-		return m, tea.Quit
+	case stateExportApps:
+		value := strings.TrimSpace(m.textInput.Value())
+		if value == "" {
+			return m, nil
+		}
+		data, err := exportApps(m.persistentConfig, nil, ".")
+		if err == nil {
+			err = writeFileAtomic(value, append(data, '\n'))
+		}
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.result = fmt.Sprintf("✅ Exported %d apps to %s", len(m.persistentConfig.Apps), value)
+		m.state = stateDone
+		return m, nil
 
 	// Add new app flow
 	case stateAddAppName:
@@ -533,11 +766,11 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 			return m, nil
 		}
 		m.targetPath = value
-		m.state = stateAddAppUseJS
-		m.useJS = false
+		m.state = stateAddAppConfigType
+		m.configType = configTypeAuto
 		return m, nil
 
-	case stateAddAppUseJS:
+	case stateAddAppConfigType:
 		// Go to format selection
 		m.state = stateAddAppFormat
 		m.formatOption = 0 // default to serverConfig
@@ -546,13 +779,18 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 
 	case stateAddAppFormat:
 		// Save the new app
-		m.persistentConfig.Apps[m.newAppName] = AppConfig{
-			ConfigDir:  m.configDir,
-			TargetPath: m.targetPath,
-			UseJS:      m.useJS,
-			Format:     m.format,
+		if err := m.updateConfig(func(config *PersistentConfig) {
+			config.Apps[m.newAppName] = AppConfig{
+				ConfigDir:  m.configDir,
+				TargetPath: m.targetPath,
+				ConfigType: m.configType,
+				Format:     m.format,
+			}
+		}); err != nil {
+			m.err = fmt.Errorf("could not save %s: %v", m.newAppName, err)
+			return m, nil
 		}
-		savePersistentConfig(m.persistentConfig)
+		m.err = nil
 		m.apps = getAppNames(m.persistentConfig)
 
 		// Select the new app and go to env input
@@ -573,6 +811,109 @@ func (m model) handleEnter() (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// switchProfile applies a profile (confirmProtected: its name was typed)
+// and shows the combined report
+func (m model) switchProfile(profile string, confirmProtected bool) (tea.Model, tea.Cmd) {
+	results, err := applyProfile(m.persistentConfig, profile, false, confirmProtected)
+	m.result = formatProfileReport(profile, results)
+	m.err = err
+	for _, r := range results {
+		if r.Err != nil && m.err == nil {
+			m.err = fmt.Errorf("profile '%s' did not switch every app", profile)
+		}
+	}
+	if err != nil && results == nil {
+		m.result = fmt.Sprintf("❌ Error: %v", err)
+	}
+	if config, err := loadPersistentConfig(); err == nil {
+		m.persistentConfig = config
+	}
+	m.state = stateDone
+	return m, nil
+}
+
+// switchEnv saves the app's settings and switches it to m.env (through the
+// proxy in proxy mode); m.protected confirms a protected env
+func (m model) switchEnv() (tea.Model, tea.Cmd) {
+	// Save the config before executing
+	// (keeping settings the TUI doesn't edit, like hooks)
+	appName := m.apps[m.selectedApp]
+	saveErr := m.updateConfig(func(config *PersistentConfig) {
+		saved := config.Apps[appName]
+		saved.ConfigDir = m.configDir
+		saved.TargetPath = m.targetPath
+		saved.LastEnv = m.env
+		saved.ConfigType = m.configType
+		saved.UseJS = false
+		saved.Format = m.format
+		config.Apps[appName] = saved
+	})
+	saved := m.persistentConfig.Apps[appName]
+
+	// Hook output is captured (the alt screen can't stream it)
+	var hookOutput bytes.Buffer
+	opts := switchOptions{
+		ConfigDir:  m.configDir,
+		TargetPath: m.targetPath,
+		Env:        m.env,
+		ConfigType: m.configType,
+		Format:     m.format,
+		Template:   saved.Template,
+		KeyFile:    saved.KeyFile,
+		Hooks:      saved.hooks(),
+		Output:     &hookOutput,
+		App:        appName,
+		Source:     sourceTUI,
+
+		ProtectedEnvs:    saved.ProtectedEnvs,
+		ConfirmProtected: m.protected,
+	}
+
+	// Proxy mode: the target points at the proxy, so only the proxy switches
+	if saved.ProxyPort != 0 {
+		status, err := switchAppProxy(opts, saved.ProxyPort)
+		if err != nil {
+			m.err = err
+			m.result = fmt.Sprintf("❌ Error: %v", err)
+		} else {
+			m.result = fmt.Sprintf("✅ Switched to %s through the proxy on port %d (no files changed)", m.env, saved.ProxyPort)
+			for i := range m.proxies {
+				if m.proxies[i].Port == status.Port {
+					m.proxies[i] = *status
+				}
+			}
+		}
+		if saveErr != nil {
+			m.result += fmt.Sprintf("\n⚠️  Could not save settings: %v", saveErr)
+		}
+		m.state = stateDone
+		return m, nil
+	}
+
+	plan, err := executeSwitch(opts)
+	m.hookOutput = strings.TrimSpace(hookOutput.String())
+	if err != nil {
+		m.err = err
+		m.result = fmt.Sprintf("❌ Error: %v", err)
+	} else {
+		m.result = fmt.Sprintf("✅ Successfully switched to %s environment!", m.env)
+		if saved.SkipWorktree {
+			if note, gitErr := guardTarget(m.targetPath, m.env, saved.DefaultEnv, plan.Result); gitErr != nil {
+				m.result += fmt.Sprintf("\n⚠️  %v", gitErr)
+			} else if note != "" {
+				m.result += "\n" + note
+			}
+		} else if isGitTracked(m.targetPath) && !isAtDefaultEnv(m.env, saved.DefaultEnv, m.targetPath, plan.Result) {
+			m.offerSkipWorktree = true
+		}
+	}
+	if saveErr != nil {
+		m.result += fmt.Sprintf("\n⚠️  Could not save settings: %v", saveErr)
+	}
+	m.state = stateDone
+	return m, nil
+}
+
 func (m model) View() string {
 	if m.quitting {
 		return "\n  👋 See you later! VAMOS BOCA! 💙💛\n\n"
@@ -593,6 +934,24 @@ func (m model) View() string {
 	s.WriteString(disclaimer)
 	s.WriteString("\n\n")
 
+	// Live env of the running proxies
+	for _, proxy := range m.proxies {
+		s.WriteString(warningStyle.Render(fmt.Sprintf("  🔀 Proxy :%d → %s", proxy.Port, proxy.Env)))
+		if proxy.App != "" {
+			s.WriteString(savedPathStyle.Render(fmt.Sprintf("  (%s)", proxy.App)))
+		}
+		s.WriteString("\n")
+	}
+	if len(m.proxies) > 0 {
+		s.WriteString("\n")
+	}
+
+	// Red banner while a protected env is involved
+	if m.showProtectedBanner() {
+		s.WriteString("  " + protectedStyle.Render(fmt.Sprintf("🛑 PROTECTED ENV: %s — requests from this app reach it", m.env)))
+		s.WriteString("\n\n")
+	}
+
 	// Main content based on state
 	switch m.state {
 	case stateSelectApp:
@@ -607,6 +966,8 @@ func (m model) View() string {
 		s.WriteString(m.viewInputEnv())
 	case stateConfirm:
 		s.WriteString(m.viewConfirm())
+	case stateConfirmProtected:
+		s.WriteString(m.viewConfirmProtected())
 	case stateDone:
 		s.WriteString(m.viewDone())
 	case stateAddAppName:
@@ -615,10 +976,16 @@ func (m model) View() string {
 		s.WriteString(m.viewAddAppConfigDir())
 	case stateAddAppTargetPath:
 		s.WriteString(m.viewAddAppTargetPath())
-	case stateAddAppUseJS:
-		s.WriteString(m.viewAddAppUseJS())
+	case stateAddAppConfigType:
+		s.WriteString(m.viewAddAppConfigType())
 	case stateAddAppFormat:
 		s.WriteString(m.viewAddAppFormat())
+	case stateImportApps:
+		s.WriteString(m.viewAppsFile("  📥 Import Apps", "  Apps file (from `envswitch apps export`):"))
+	case stateExportApps:
+		s.WriteString(m.viewAppsFile("  📤 Export Apps", "  Write all apps to (paths relative to the current directory):"))
+	case stateSelectProfile:
+		s.WriteString(m.viewSelectProfile())
 	}
 
 	return s.String()
@@ -642,9 +1009,14 @@ func (m model) viewSelectApp() string {
 		line := fmt.Sprintf("%s%s", cursor, style.Render(appName))
 
 		// Show saved info for configured apps
-		if appName != "➕ Add New App..." {
+		if appName == profilesEntry {
+			line += savedPathStyle.Render(fmt.Sprintf(" (%d)", len(m.persistentConfig.Profiles)))
+		} else if appName != addAppEntry && appName != importEntry && appName != exportEntry {
 			if savedConfig, exists := m.persistentConfig.Apps[appName]; exists && savedConfig.ConfigDir != "" {
 				line += savedPathStyle.Render(fmt.Sprintf(" [%s]", savedConfig.LastEnv))
+				if savedConfig.workspace != "" {
+					line += savedPathStyle.Render(" (workspace)")
+				}
 			} else {
 				line += warningStyle.Render(" (not configured)")
 			}
@@ -661,6 +1033,46 @@ func (m model) viewSelectApp() string {
 	return s.String()
 }
 
+func (m model) viewSelectProfile() string {
+	var s strings.Builder
+
+	prompt := promptStyle.Render("  📚 Which profile do you want to apply?")
+	s.WriteString(prompt)
+	s.WriteString("\n\n")
+
+	if len(m.profiles) == 0 {
+		s.WriteString(warningStyle.Render("  No profiles yet. Create one with: envswitch profile set <name> <app>=<env>..."))
+		s.WriteString("\n")
+	}
+
+	for i, name := range m.profiles {
+		cursor := "  "
+		style := normalStyle
+		if i == m.selectedProfile {
+			cursor = "▸ "
+			style = selectedStyle
+		}
+
+		pairs := make([]string, 0)
+		for app, env := range m.persistentConfig.Profiles[name] {
+			pairs = append(pairs, fmt.Sprintf("%s: %s", app, env))
+		}
+		sort.Strings(pairs)
+
+		line := fmt.Sprintf("%s%s", cursor, style.Render(name))
+		line += savedPathStyle.Render(fmt.Sprintf(" {%s}", strings.Join(pairs, ", ")))
+		s.WriteString(line)
+		s.WriteString("\n")
+	}
+
+	s.WriteString("\n")
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
+	s.WriteString(helpStyle.Render("  ↑/↓: navigate • enter: apply • esc: back"))
+	s.WriteString("\n")
+
+	return s.String()
+}
+
 func (m model) viewAppMenu() string {
 	var s strings.Builder
 
@@ -690,6 +1102,13 @@ func (m model) viewAppMenu() string {
 		s.WriteString(fmt.Sprintf("%s%s\n", cursor, style.Render(opt)))
 	}
 
+	if m.err != nil {
+		s.WriteString("\n")
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+		s.WriteString(errorStyle.Render(fmt.Sprintf("  ⚠️  %v", m.err)))
+		s.WriteString("\n")
+	}
+
 	s.WriteString("\n")
 	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
 	s.WriteString(helpStyle.Render("  ↑/↓: navigate • enter: select • esc: back"))
@@ -784,18 +1203,81 @@ func (m model) viewConfirm() string {
 			"  Environment: %s\n"+
 			"  Config Dir:  %s\n"+
 			"  Target:      %s\n"+
-			"  Use JS:      %t\n"+
+			"  Config type: %s\n"+
 			"  Format:      %s",
-		appName, m.env, m.configDir, m.targetPath, m.useJS, m.format,
+		appName, m.env, m.configDir, m.targetPath, m.configType, m.format,
 	))
 	s.WriteString(info)
 	s.WriteString("\n\n")
 
+	// Values the target will get, secrets masked unless revealed
+	if m.previewErr != nil {
+		s.WriteString(warningStyle.Render(fmt.Sprintf("  ⚠️  Could not load config: %v", m.previewErr)))
+		s.WriteString("\n\n")
+	} else if m.preview != nil {
+		var secrets []string
+		if !m.reveal {
+			secrets = m.preview.secretValues(m.persistentConfig.Apps[appName].SecretFields)
+		}
+		for _, entry := range configEntries(m.preview) {
+			s.WriteString(savedPathStyle.Render(fmt.Sprintf("  %-28s %s", entry.Name, maskSecrets(entry.Value, secrets))))
+			s.WriteString("\n")
+		}
+		s.WriteString("\n")
+	}
+
+	if m.protected {
+		s.WriteString(lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF0000")).Render(fmt.Sprintf("  🛑 %s is a protected env: you'll type its name to confirm", m.env)))
+		s.WriteString("\n\n")
+	}
+
 	s.WriteString(lipgloss.NewStyle().Bold(true).Foreground(bocaGold).Render("  Press ENTER to execute!"))
 	s.WriteString("\n\n")
 
+	revealHelp := "r: reveal secrets"
+	if m.reveal {
+		revealHelp = "r: mask secrets"
+	}
 	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
-	s.WriteString(helpStyle.Render("  enter: execute • esc: go back"))
+	s.WriteString(helpStyle.Render("  enter: execute • " + revealHelp + " • esc: go back"))
+	s.WriteString("\n")
+
+	return s.String()
+}
+
+func (m model) viewConfirmProtected() string {
+	var s strings.Builder
+
+	name := m.env
+	if m.confirmProfile != "" {
+		name = m.confirmProfile
+		s.WriteString(promptStyle.Render(fmt.Sprintf("  🛑 Profile '%s' switches to protected envs:", m.confirmProfile)))
+		s.WriteString("\n\n")
+		for _, app := range m.protectedApps {
+			s.WriteString(protectedStyle.Render("  " + app))
+			s.WriteString("\n")
+		}
+		s.WriteString("\n")
+	} else {
+		header := promptStyle.Render(fmt.Sprintf("  🛑 Switch %s to the protected env '%s'?", m.apps[m.selectedApp], m.env))
+		s.WriteString(header)
+		s.WriteString("\n\n")
+	}
+
+	prompt := lipgloss.NewStyle().Foreground(whiteColor).Render(fmt.Sprintf("  Type '%s' to confirm:", name))
+	s.WriteString(prompt)
+	s.WriteString("\n\n  ")
+	s.WriteString(m.textInput.View())
+	s.WriteString("\n\n")
+
+	if m.err != nil {
+		errorStyle := lipgloss.NewStyle().Bold(true).Foreground(lipgloss.Color("#FF0000"))
+		s.WriteString(errorStyle.Render(fmt.Sprintf("  ⚠️  %v", m.err)))
+		s.WriteString("\n\n")
+	}
+
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
+	s.WriteString(helpStyle.Render("  enter: switch • esc: back"))
 	s.WriteString("\n")
 
 	return s.String()
@@ -812,7 +1294,21 @@ func (m model) viewDone() string {
 	}
 	s.WriteString("\n\n")
 
+	if m.hookOutput != "" {
+		s.WriteString(savedPathStyle.Render(indentLines(lastLines(m.hookOutput, 15), "  ")))
+		s.WriteString("\n\n")
+	}
+
 	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
+	if m.offerSkipWorktree {
+		s.WriteString(warningStyle.Render("  💡 The target is tracked by git and no longer matches its default env."))
+		s.WriteString("\n")
+		s.WriteString(warningStyle.Render("     Mark it skip-worktree so it isn't committed by accident?"))
+		s.WriteString("\n\n")
+		s.WriteString(helpStyle.Render("  s: mark skip-worktree (and remember for this app) • enter: exit"))
+		s.WriteString("\n")
+		return s.String()
+	}
 	s.WriteString(helpStyle.Render("  Press ENTER to exit"))
 	s.WriteString("\n")
 
@@ -865,6 +1361,33 @@ func (m model) viewAddAppConfigDir() string {
 	return s.String()
 }
 
+// viewAppsFile prompts for the file of an import or export
+func (m model) viewAppsFile(title, label string) string {
+	var s strings.Builder
+
+	header := promptStyle.Render(title)
+	s.WriteString(header)
+	s.WriteString("\n\n")
+
+	prompt := lipgloss.NewStyle().Foreground(whiteColor).Render(label)
+	s.WriteString(prompt)
+	s.WriteString("\n\n  ")
+	s.WriteString(m.textInput.View())
+
+	if m.err != nil {
+		s.WriteString("\n\n")
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+		s.WriteString(errorStyle.Render(fmt.Sprintf("  ⚠️  %v", m.err)))
+	}
+
+	s.WriteString("\n\n")
+	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
+	s.WriteString(helpStyle.Render("  enter: confirm • esc: cancel"))
+	s.WriteString("\n")
+
+	return s.String()
+}
+
 func (m model) viewAddAppTargetPath() string {
 	var s strings.Builder
 
@@ -889,7 +1412,31 @@ func (m model) viewAddAppTargetPath() string {
 	return s.String()
 }
 
-func (m model) viewAddAppUseJS() string {
+// configTypeChoices are the config types offered when adding an app
+var configTypeChoices = []struct {
+	value string
+	label string
+}{
+	{configTypeAuto, "Auto (by file extension)"},
+	{"json", "JSON (.json files)"},
+	{"js", "JavaScript (.js/.mjs files, CommonJS or ESM)"},
+	{configTypeJSEval, "JavaScript, evaluated (computed values, require of config-dir files)"},
+	{"yaml", "YAML (.yaml/.yml files)"},
+	{"toml", "TOML (.toml files)"},
+}
+
+// stepConfigType moves the config type selection up (-1) or down (1)
+func stepConfigType(current string, step int) string {
+	for i, choice := range configTypeChoices {
+		if choice.value == current {
+			next := min(max(i+step, 0), len(configTypeChoices)-1)
+			return configTypeChoices[next].value
+		}
+	}
+	return configTypeAuto
+}
+
+func (m model) viewAddAppConfigType() string {
 	var s strings.Builder
 
 	header := promptStyle.Render(fmt.Sprintf("  ➕ Add New App: %s", m.newAppName))
@@ -903,31 +1450,23 @@ func (m model) viewAddAppUseJS() string {
 	s.WriteString(targetInfo)
 	s.WriteString("\n\n")
 
-	prompt := lipgloss.NewStyle().Foreground(whiteColor).Render("  Use JavaScript config files?")
+	prompt := lipgloss.NewStyle().Foreground(whiteColor).Render("  Config file type:")
 	s.WriteString(prompt)
 	s.WriteString("\n\n")
 
-	options := []struct {
-		label    string
-		selected bool
-	}{
-		{"Yes (.js files)", m.useJS},
-		{"No (.json files)", !m.useJS},
-	}
-
-	for i, opt := range options {
+	for _, choice := range configTypeChoices {
 		cursor := "  "
 		style := normalStyle
-		if (i == 0 && m.useJS) || (i == 1 && !m.useJS) {
+		if choice.value == m.configType {
 			cursor = "▸ "
 			style = selectedStyle
 		}
-		s.WriteString(fmt.Sprintf("%s%s\n", cursor, style.Render(opt.label)))
+		s.WriteString(fmt.Sprintf("%s%s\n", cursor, style.Render(choice.label)))
 	}
 
 	s.WriteString("\n")
 	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
-	s.WriteString(helpStyle.Render("  ↑/↓: toggle • enter: confirm • esc: back"))
+	s.WriteString(helpStyle.Render("  ↑/↓: select • enter: confirm • esc: back"))
 	s.WriteString("\n")
 
 	return s.String()
@@ -946,7 +1485,7 @@ func (m model) viewAddAppFormat() string {
 	targetInfo := lipgloss.NewStyle().Foreground(greenColor).Render(fmt.Sprintf("  ✓ Target: %s", m.targetPath))
 	s.WriteString(targetInfo)
 	s.WriteString("\n")
-	jsInfo := lipgloss.NewStyle().Foreground(greenColor).Render(fmt.Sprintf("  ✓ Use JS: %t", m.useJS))
+	jsInfo := lipgloss.NewStyle().Foreground(greenColor).Render(fmt.Sprintf("  ✓ Config type: %s", m.configType))
 	s.WriteString(jsInfo)
 	s.WriteString("\n\n")
 
@@ -976,6 +1515,13 @@ func (m model) viewAddAppFormat() string {
 		s.WriteString("\n")
 	}
 
+	if m.err != nil {
+		s.WriteString("\n")
+		errorStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#FF0000"))
+		s.WriteString(errorStyle.Render(fmt.Sprintf("  ⚠️  %v", m.err)))
+		s.WriteString("\n")
+	}
+
 	s.WriteString("\n")
 	helpStyle := lipgloss.NewStyle().Foreground(lipgloss.Color("#666666"))
 	s.WriteString(helpStyle.Render("  ↑/↓: toggle • enter: confirm • esc: back"))
@@ -984,62 +1530,48 @@ func (m model) viewAddAppFormat() string {
 	return s.String()
 }
 
-// executeSwitchNew runs the actual environment switch
-func executeSwitchNew(configDir, targetPath, env string, useJS bool, format string) error {
-	var config *Config
-	var err error
-	var configPath string
-
-	if useJS {
-		configPath = filepath.Join(configDir, fmt.Sprintf("config.%s.js", env))
-	} else {
-		configPath = filepath.Join(configDir, fmt.Sprintf("config.%s.json", env))
-	}
-
-	// Check if config file exists first
-	if _, statErr := os.Stat(configPath); os.IsNotExist(statErr) {
-		return fmt.Errorf("config file not found: %s", configPath)
-	}
-
-	if useJS {
-		config, err = LoadConfigFromJS(configPath)
-	} else {
-		config, err = loadConfig(configPath)
-	}
-
-	if err != nil {
-		return fmt.Errorf("loading config %s: %v", configPath, err)
-	}
-
-	// Check if target file exists
-	if _, statErr := os.Stat(targetPath); os.IsNotExist(statErr) {
-		return fmt.Errorf("target file not found: %s", targetPath)
+// acceptSkipWorktree marks the target skip-worktree and remembers the choice for the app
+func (m model) acceptSkipWorktree() (tea.Model, tea.Cmd) {
+	m.offerSkipWorktree = false
+	if err := setSkipWorktree(m.targetPath, true); err != nil {
+		m.result += fmt.Sprintf("\n⚠️  %v", err)
+		return m, nil
 	}
 
-	content, err := os.ReadFile(targetPath)
-	if err != nil {
-		return fmt.Errorf("reading target file %s: %v", targetPath, err)
+	appName := m.apps[m.selectedApp]
+	if err := m.updateConfig(func(config *PersistentConfig) {
+		saved := config.Apps[appName]
+		saved.SkipWorktree = true
+		config.Apps[appName] = saved
+	}); err != nil {
+		m.result += fmt.Sprintf("\n⚠️  Could not save settings: %v", err)
 	}
 
-	var result string
-	switch format {
-	case "envJs":
-		result = applyEnvJsReplacements(string(content), config, false)
-	default: // "serverConfig"
-		result = applyReplacements(string(content), config, false)
-	}
+	m.result += "\ngit: target marked skip-worktree (cleared again when you switch back)"
+	return m, nil
+}
 
-	err = os.WriteFile(targetPath, []byte(result), 0644)
-	if err != nil {
-		return fmt.Errorf("writing target file %s: %v", targetPath, err)
+// lastLines keeps the last n lines of a text
+func lastLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
 	}
+	return strings.Join(lines, "\n")
+}
 
-	return nil
+// indentLines prefixes every line of a text
+func indentLines(text, prefix string) string {
+	return prefix + strings.ReplaceAll(text, "\n", "\n"+prefix)
 }
 
 // RunInteractiveCLI starts the interactive CLI
 func RunInteractiveCLI() error {
-	p := tea.NewProgram(initialModel(), tea.WithAltScreen())
-	_, err := p.Run()
+	config, err := loadPersistentConfig()
+	if err != nil {
+		return err
+	}
+	p := tea.NewProgram(initialModel(config), tea.WithAltScreen())
+	_, err = p.Run()
 	return err
 }
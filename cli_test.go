@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// A save the store refuses (here: a file from a newer envswitch) is reported
+// and the app list stays as saved
+func TestTUISaveErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := filepath.Join(dir, "config.json")
+	t.Setenv("ENVSWITCH_CONFIG", path)
+	config := PersistentConfig{Apps: map[string]AppConfig{"Front": {ConfigDir: "configs"}}}
+	os.WriteFile(path, []byte(`{"version": 99, "apps": {}}`), 0600)
+
+	m := initialModel(config)
+	m.state, m.menuOption = stateAppMenu, menuOptionDelete
+	next, _ := m.handleEnter()
+	m = next.(model)
+	if m.err == nil || !strings.Contains(m.err.Error(), "could not delete Front") || m.state != stateAppMenu {
+		t.Errorf("delete: err = %v, state = %v", m.err, m.state)
+	}
+	if !strings.Contains(m.View(), "could not delete Front") {
+		t.Error("the delete error isn't shown")
+	}
+	if _, exists := m.persistentConfig.Apps["Front"]; !exists {
+		t.Error("Front deleted in memory")
+	}
+
+	m = initialModel(config)
+	m.state, m.newAppName, m.format = stateAddAppFormat, "Vault", "envJs"
+	next, _ = m.handleEnter()
+	m = next.(model)
+	if m.err == nil || !strings.Contains(m.err.Error(), "could not save Vault") || m.state != stateAddAppFormat {
+		t.Errorf("add: err = %v, state = %v", m.err, m.state)
+	}
+	if !strings.Contains(m.View(), "could not save Vault") {
+		t.Error("the add error isn't shown")
+	}
+	if _, exists := m.persistentConfig.Apps["Vault"]; exists {
+		t.Error("Vault added in memory")
+	}
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// completionValueFlags are the flags whose values are completed dynamically
+// through `envswitch __complete <kind>` instead of being listed as plain flags
+var completionValueFlags = map[string]string{
+	"env":    "envs",
+	"app":    "apps",
+	"format": "formats",
+}
+
+// listFlagsOf is set by `__complete flags <command>`: instead of parsing the
+// command's flags, parseFlags prints them and stops the command
+var listFlagsOf func(fs *flag.FlagSet)
+
+// errFlagsListed stops a command whose flags were listed for completion
+var errFlagsListed = errors.New("flags listed")
+
+// parseFlags parses the flags of a subcommand, or lists them for completion
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if listFlagsOf != nil {
+		listFlagsOf(fs)
+		return errFlagsListed
+	}
+	return fs.Parse(args)
+}
+
+// flagValues returns the values to complete for --name of a command, or nil
+// when they aren't a fixed set (envs and apps have their own kinds)
+func flagValues(command, name string) []string {
+	switch {
+	case name == "format":
+		return targetFormats
+	case name == "output":
+		return []string{outputText, outputJSON}
+	case name == "config-type":
+		names := []string{configTypeAuto}
+		for _, t := range configTypes {
+			names = append(names, t.Name)
+		}
+		return names
+	case name == "on-conflict":
+		return conflictModes
+	case command == "log" && name == "source":
+		return auditSources
+	case command == "convert" && (name == "from" || name == "to"):
+		return []string{"js", "json"}
+	}
+	return nil
+}
+
+// runCompletion prints the completion script for the requested shell
+func runCompletion(args []string) error {
+	if len(args) != 1 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch completion bash|zsh|fish|powershell"))
+	}
+
+	var script string
+	switch args[0] {
+	case "bash":
+		script = bashCompletion
+	case "zsh":
+		script = zshCompletionHeader + bashCompletion
+	case "fish":
+		script = fishCompletion()
+	case "powershell", "pwsh":
+		script = powershellCompletion
+	default:
+		return fmt.Errorf("unsupported shell '%s' (use bash, zsh, fish or powershell)", args[0])
+	}
+
+	_, err := os.Stdout.WriteString(script)
+	return err
+}
+
+// runComplete is the hidden `__complete` subcommand the completion scripts call back into
+func runComplete(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch __complete commands|flags [command [action]]|values <flag> [command]|apps|envs|formats"))
+	}
+
+	switch args[0] {
+	case "commands":
+		for _, name := range subcommandNames {
+			fmt.Println(name)
+		}
+	case "flags":
+		// The flags of a subcommand (`flags log`, `flags proxy switch`), or
+		// of a switch without one
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			flag.VisitAll(func(f *flag.Flag) {
+				fmt.Println(flagSpelling(f.Name))
+			})
+			return nil
+		}
+		if !slices.Contains(subcommandNames, args[1]) || args[1] == "completion" {
+			return nil
+		}
+		listFlagsOf = func(fs *flag.FlagSet) {
+			fs.VisitAll(func(f *flag.Flag) {
+				fmt.Println(flagSpelling(f.Name))
+			})
+		}
+		defer func() { listFlagsOf = nil }()
+		if err := runSubcommand(args[1], args[2:]); !errors.Is(err, errFlagsListed) {
+			// A command that needs an action stops before its flags
+			return nil
+		}
+	case "values":
+		if len(args) < 2 {
+			return nil
+		}
+		command := ""
+		if len(args) > 2 {
+			command = args[2]
+		}
+		for _, value := range flagValues(command, strings.TrimLeft(args[1], "-")) {
+			fmt.Println(value)
+		}
+	case "apps":
+		names := make([]string, 0)
+		for name := range peekPersistentConfig().Apps {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "envs":
+		fs := flag.NewFlagSet("__complete envs", flag.ContinueOnError)
+		app := fs.String("app", "", "")
+		configDir := fs.String("config-dir", "", "")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		dir := *configDir
+		if saved, exists := peekPersistentConfig().Apps[*app]; exists && dir == "" {
+			dir = saved.ConfigDir
+		}
+		if dir == "" {
+			dir = "./configs"
+		}
+		for _, env := range listEnvs(dir) {
+			fmt.Println(env)
+		}
+	case "formats":
+		for _, format := range targetFormats {
+			fmt.Println(format)
+		}
+	default:
+		return fmt.Errorf("unknown completion kind '%s'", args[0])
+	}
+	return nil
+}
+
+// listEnvs scans a config directory for config.<env>.<ext> files of every config type
+func listEnvs(configDir string) []string {
+	entries, err := os.ReadDir(configDir)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	envs := make([]string, 0)
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "config.") {
+			continue
+		}
+		ext := filepath.Ext(name)
+		if !isConfigExtension(ext) {
+			continue
+		}
+		env := strings.TrimSuffix(strings.TrimPrefix(name, "config."), ext)
+		if env == "" || seen[env] {
+			continue
+		}
+		seen[env] = true
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	return envs
+}
+
+// flagSpelling returns how a flag is written on the command line (-i, --env)
+func flagSpelling(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// fishCompletion builds the fish script, describing every flag from the flag set
+func fishCompletion() string {
+	var s strings.Builder
+	s.WriteString(fishCompletionHeader)
+
+	flag.VisitAll(func(f *flag.Flag) {
+		opt := "-l " + f.Name
+		if len(f.Name) == 1 {
+			opt = "-o " + f.Name
+		}
+		desc := strings.ReplaceAll(f.Usage, "'", `\'`)
+
+		switch f.Name {
+		case "config-dir":
+			s.WriteString(fmt.Sprintf("complete -c envswitch %s -x -a '(__fish_complete_directories)' -d '%s'\n", opt, desc))
+		case "target":
+			s.WriteString(fmt.Sprintf("complete -c envswitch %s -r -F -d '%s'\n", opt, desc))
+		default:
+			if kind, dynamic := completionValueFlags[f.Name]; dynamic {
+				s.WriteString(fmt.Sprintf("complete -c envswitch %s -x -a '(__envswitch_complete %s)' -d '%s'\n", opt, kind, desc))
+			} else {
+				s.WriteString(fmt.Sprintf("complete -c envswitch %s -d '%s'\n", opt, desc))
+			}
+		}
+	})
+
+	s.WriteString("complete -c esw -w envswitch\n")
+	return s.String()
+}
+
+const bashCompletion = `# bash completion for envswitch
+# Set ENVSWITCH_BIN if envswitch isn't on your PATH (e.g. "go run /path/to/envSwitch/.")
+_envswitch() {
+    local bin="${ENVSWITCH_BIN:-envswitch}"
+    local cur="${COMP_WORDS[COMP_CWORD]}"
+    local prev="${COMP_WORDS[COMP_CWORD-1]}"
+    COMPREPLY=()
+
+    if [ "$COMP_CWORD" -eq 1 ] && [[ "$cur" != -* ]]; then
+        COMPREPLY=( $(compgen -W "$($bin __complete commands 2>/dev/null)" -- "$cur") )
+        return
+    fi
+
+    case "$prev" in
+        --env|-env)
+            local app="" dir="" i
+            for ((i = 1; i < COMP_CWORD; i++)); do
+                case "${COMP_WORDS[i]}" in
+                    --app|-app) app="${COMP_WORDS[i+1]}" ;;
+                    --config-dir|-config-dir) dir="${COMP_WORDS[i+1]}" ;;
+                esac
+            done
+            app="${app//\\/}"; app="${app//\"/}"; app="${app//\'/}"
+            COMPREPLY=( $(compgen -W "$($bin __complete envs --app="$app" --config-dir="$dir" 2>/dev/null)" -- "$cur") )
+            return
+            ;;
+        --app|-app)
+            local name
+            while IFS= read -r name; do
+                [[ "$name" == "$cur"* ]] && COMPREPLY+=( "$(printf '%q' "$name")" )
+            done < <($bin __complete apps 2>/dev/null)
+            return
+            ;;
+        --format|-format)
+            COMPREPLY=( $(compgen -W "$($bin __complete formats 2>/dev/null)" -- "$cur") )
+            return
+            ;;
+        --config-dir|-config-dir)
+            COMPREPLY=( $(compgen -d -- "$cur") )
+            return
+            ;;
+        --target|-target)
+            COMPREPLY=( $(compgen -f -- "$cur") )
+            return
+            ;;
+        -*)
+            local values
+            values="$($bin __complete values "$prev" "${COMP_WORDS[1]}" 2>/dev/null)"
+            if [ -n "$values" ]; then
+                COMPREPLY=( $(compgen -W "$values" -- "$cur") )
+                return
+            fi
+            ;;
+    esac
+
+    if [[ "$cur" == -* ]]; then
+        # The flags of the subcommand (and its action) when there is one
+        local words=() i
+        for ((i = 1; i < COMP_CWORD && i <= 2; i++)); do
+            [[ "${COMP_WORDS[i]}" == -* ]] && break
+            words+=( "${COMP_WORDS[i]}" )
+        done
+        COMPREPLY=( $(compgen -W "$($bin __complete flags "${words[@]}" 2>/dev/null)" -- "$cur") )
+    fi
+}
+complete -F _envswitch envswitch esw
+`
+
+const zshCompletionHeader = `# zsh completion for envswitch (uses the bash completion through bashcompinit)
+autoload -U +X compinit && compinit
+autoload -U +X bashcompinit && bashcompinit
+
+`
+
+const fishCompletionHeader = `# fish completion for envswitch
+# Set ENVSWITCH_BIN if envswitch isn't on your PATH (e.g. "go run /path/to/envSwitch/.")
+function __envswitch_complete
+    set -l bin envswitch
+    if set -q ENVSWITCH_BIN
+        set bin (string split ' ' -- $ENVSWITCH_BIN)
+    end
+    set -l tokens (commandline -opc)
+    if test "$argv[1]" = flags
+        # The subcommand (and its action) whose flags to list
+        for token in $tokens[2..3]
+            string match -q -- '-*' $token; and break
+            set -a argv $token
+        end
+    else if test "$argv[1]" = values
+        string match -q -- '-*' $tokens[-1]; or return
+        set -a argv $tokens[-1] $tokens[2]
+    else if test "$argv[1]" = envs
+        for i in (seq (count $tokens))
+            set -l next (math $i + 1)
+            if test $next -le (count $tokens)
+                if contains -- $tokens[$i] --app -app
+                    set -a argv --app=$tokens[$next]
+                else if contains -- $tokens[$i] --config-dir -config-dir
+                    set -a argv --config-dir=$tokens[$next]
+                end
+            end
+        end
+    end
+    command $bin __complete $argv 2>/dev/null
+end
+
+complete -c envswitch -f
+complete -c envswitch -n '__fish_use_subcommand' -a '(__envswitch_complete commands)'
+complete -c envswitch -n 'not __fish_use_subcommand; and string match -q -- "-*" (commandline -ct)' -a '(__envswitch_complete flags)'
+complete -c envswitch -n 'not __fish_use_subcommand' -a '(__envswitch_complete values)'
+`
+
+const powershellCompletion = `# PowerShell completion for envswitch
+# Set $env:ENVSWITCH_BIN if envswitch isn't on your PATH (e.g. "go run C:\path\to\envSwitch\.")
+Register-ArgumentCompleter -Native -CommandName envswitch, esw -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+
+    $bin = if ($env:ENVSWITCH_BIN) { $env:ENVSWITCH_BIN } else { 'envswitch' }
+    $exe, $exeArgs = $bin -split ' '
+    $words = @($commandAst.CommandElements | ForEach-Object {
+        if ($_ -is [System.Management.Automation.Language.StringConstantExpressionAst]) { $_.Value } else { $_.Extent.Text }
+    })
+    if ($wordToComplete -ne '' -and $words.Count -gt 1) { $words = $words[0..($words.Count - 2)] }
+    $prev = $words[-1]
+
+    function Get-FlagValue($name) {
+        for ($i = 1; $i -lt $words.Count - 1; $i++) {
+            if ($words[$i] -eq "--$name" -or $words[$i] -eq "-$name") { return $words[$i + 1] }
+        }
+        return ''
+    }
+
+    $candidates = switch -Regex ($prev) {
+        '^--?env$' { & $exe @exeArgs __complete envs "--app=$(Get-FlagValue 'app')" "--config-dir=$(Get-FlagValue 'config-dir')" }
+        '^--?app$' { & $exe @exeArgs __complete apps }
+        '^--?format$' { & $exe @exeArgs __complete formats }
+        default {
+            $values = if ($prev -match '^--?[a-z]') { & $exe @exeArgs __complete values $prev $words[1] }
+            if ($values) { $values }
+            elseif ($words.Count -le 1 -and -not $wordToComplete.StartsWith('-')) { & $exe @exeArgs __complete commands }
+            else {
+                $command = @($words | Select-Object -Skip 1 -First 2 | Where-Object { -not $_.StartsWith('-') })
+                & $exe @exeArgs __complete flags @command
+            }
+        }
+    }
+
+    $candidates | Where-Object { $_ -like "$wordToComplete*" } | ForEach-Object {
+        $text = if ($_ -match '\s') { "'$_'" } else { $_ }
+        [System.Management.Automation.CompletionResult]::new($text, $_, 'ParameterValue', $_)
+    }
+}
+`
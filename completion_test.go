@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// complete runs `envswitch __complete args...` and returns the lines it prints
+func complete(t *testing.T, args ...string) []string {
+	t.Helper()
+	out, err := captureStdout(t, func() error { return runComplete(args) })
+	if err != nil {
+		t.Fatalf("__complete %v: %v", args, err)
+	}
+	return strings.Fields(out)
+}
+
+func TestComplete(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	configDir := filepath.Join(dir, "configs")
+	os.MkdirAll(configDir, 0755)
+	for _, name := range []string{"config.test.json", "config.stress.js", "config.prod.yaml", "config.prod.json", "notes.txt"} {
+		os.WriteFile(filepath.Join(configDir, name), []byte("{}"), 0644)
+	}
+	config := PersistentConfig{Apps: map[string]AppConfig{
+		"Backoffice": {ConfigDir: configDir},
+		"Front":      {ConfigDir: filepath.Join(dir, "front")},
+	}}
+	if err := savePersistentConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want []string // all of them, in order
+		has  []string // some of them
+		not  []string
+	}{
+		{args: []string{"apps"}, want: []string{"Backoffice", "Front"}},
+		{args: []string{"envs", "--app=Backoffice"}, want: []string{"prod", "stress", "test"}},
+		{args: []string{"envs", "--config-dir=" + filepath.Join(dir, "front")}, want: []string{}},
+		{args: []string{"formats"}, want: targetFormats},
+		{args: []string{"commands"}, has: []string{"log", "convert", "workspace"}},
+		{args: []string{"flags", "log"}, has: []string{"--source", "--since", "--limit", "--output"}, not: []string{"--dry-run"}},
+		{args: []string{"flags", "convert"}, has: []string{"--from", "--to", "--partial"}},
+		{args: []string{"flags", "secrets", "rotate"}, has: []string{"--new-keyfile", "--keyfile"}},
+		{args: []string{"flags", "proxy"}, want: []string{}},
+		{args: []string{"flags", "completion"}, want: []string{}},
+		{args: []string{"values", "--source", "log"}, want: auditSources},
+		{args: []string{"values", "--from", "convert"}, want: []string{"js", "json"}},
+		{args: []string{"values", "--from", "mock"}, want: []string{}},
+		{args: []string{"values", "--output", "show"}, want: []string{"text", "json"}},
+		{args: []string{"values", "--config-type"}, has: []string{"auto", "json", "js-eval", "yaml", "toml"}},
+	} {
+		got := complete(t, tt.args...)
+		if tt.want != nil && !slices.Equal(got, tt.want) {
+			t.Errorf("%v = %v, want %v", tt.args, got, tt.want)
+		}
+		for _, value := range tt.has {
+			if !slices.Contains(got, value) {
+				t.Errorf("%v = %v, missing %s", tt.args, got, value)
+			}
+		}
+		for _, value := range tt.not {
+			if slices.Contains(got, value) {
+				t.Errorf("%v = %v, has %s", tt.args, got, value)
+			}
+		}
+	}
+
+	// Listing flags doesn't run the command, and leaves parsing as it was
+	if _, err := os.Stat(filepath.Join(dir, "configs", "config.test.js")); !os.IsNotExist(err) {
+		t.Errorf("convert ran while completing: %v", err)
+	}
+	if listFlagsOf != nil {
+		t.Error("listFlagsOf left set")
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// configTypeAuto picks the loader by the extension of the config file found
+const configTypeAuto = "auto"
+
+// configTypeJSEval reads JS configs by running them (see jseval.go)
+const configTypeJSEval = "js-eval"
+
+// configTypes lists the config file types (--config-type) and their extensions,
+// in the order auto looks for them
+var configTypes = []struct {
+	Name       string
+	Extensions []string
+}{
+	{"json", []string{".json"}},
+	{"js", []string{".js", ".mjs", ".cjs"}},
+	{configTypeJSEval, []string{".js", ".mjs", ".cjs"}},
+	{"yaml", []string{".yaml", ".yml"}},
+	{"toml", []string{".toml"}},
+}
+
+// configExtensions returns the extensions of a config type (all of them for auto)
+func configExtensions(configType string) []string {
+	extensions := make([]string, 0)
+	for _, t := range configTypes {
+		if configType == "" || configType == configTypeAuto || configType == t.Name {
+			for _, ext := range t.Extensions {
+				if !slices.Contains(extensions, ext) {
+					extensions = append(extensions, ext)
+				}
+			}
+		}
+	}
+	return extensions
+}
+
+// checkConfigType validates a --config-type value
+func checkConfigType(configType string) error {
+	names := []string{configTypeAuto}
+	for _, t := range configTypes {
+		names = append(names, t.Name)
+	}
+	for _, name := range names {
+		if configType == name {
+			return nil
+		}
+	}
+	return withCode(codeUsage, fmt.Errorf("unknown config type '%s' (use %s)", configType, strings.Join(names, ", ")))
+}
+
+// isConfigExtension reports whether files with this extension are env configs
+func isConfigExtension(ext string) bool {
+	for _, known := range configExtensions(configTypeAuto) {
+		if ext == known {
+			return true
+		}
+	}
+	return false
+}
+
+// envConfigPath returns the config.<env>.<ext> file of an env inside configDir:
+// the first one that exists among the extensions of the config type, or the
+// first extension when there is none (config.<env>.json for auto)
+func envConfigPath(configDir, env, configType string) string {
+	extensions := configExtensions(configType)
+	for _, ext := range extensions {
+		path := filepath.Join(configDir, "config."+env+ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return filepath.Join(configDir, "config."+env+extensions[0])
+}
+
+// envConfigFiles returns every config file of an env, whatever its type
+func envConfigFiles(configDir, env string) []string {
+	paths := make([]string, 0)
+	for _, ext := range configExtensions(configTypeAuto) {
+		path := filepath.Join(configDir, "config."+env+ext)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// readConfigFile loads a config file with the loader of its extension, secrets
+// still encrypted. JS configs may be CommonJS (module.exports = function or
+// object) or ESM (export default); with the js-eval config type they are run
+// instead of read.
+func readConfigFile(configPath, configType string) (*Config, error) {
+	switch filepath.Ext(configPath) {
+	case ".js", ".mjs", ".cjs":
+		if configType == configTypeJSEval {
+			return evalJSConfig(configPath)
+		}
+		return LoadConfigFromJS(configPath)
+	case ".yaml", ".yml":
+		return loadYAMLConfig(configPath)
+	case ".toml":
+		return loadTOMLConfig(configPath)
+	default:
+		return loadConfig(configPath)
+	}
+}
+
+// loadYAMLConfig loads a config.<env>.yaml file
+func loadYAMLConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	return configFromTree(tree, yamlServerKeys(data))
+}
+
+// loadTOMLConfig loads a config.<env>.toml file ([server] is the server object)
+func loadTOMLConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := parseTOML(data)
+	if err != nil {
+		return nil, err
+	}
+	return configFromTree(doc.Values, doc.Keys["server"])
+}
+
+// configFromTree decodes a parsed YAML/TOML tree into a Config, keeping the
+// server key order of the file
+func configFromTree(tree interface{}, serverKeys []string) (*Config, error) {
+	if _, ok := tree.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("the config must be a mapping of fields")
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+	if len(serverKeys) > 0 {
+		config.serverKeys = serverKeys
+	}
+	return &config, nil
+}
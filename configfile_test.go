@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The same config in every supported file type
+var configFileTypes = map[string]string{
+	".json": `{
+  "server": {"vault": "https://v.example.com", "quest": "https://q.example.com/api"},
+  "questServer": "https://qs.example.com",
+  "google": {"recaptcha": "site-key"}
+}`,
+	".js": `module.exports = function () {
+    return {
+        server: {vault: 'https://v.example.com', quest: 'https://q.example.com/api'},
+        questServer: 'https://qs.example.com',
+        google: {recaptcha: 'site-key'}
+    };
+};`,
+	".cjs": `// Newer gulp configs export the object itself
+module.exports = {
+    server: {vault: 'https://v.example.com', quest: 'https://q.example.com/api'},
+    questServer: 'https://qs.example.com',
+    google: {recaptcha: 'site-key'}
+};`,
+	".mjs": `export default {
+    server: {vault: "https://v.example.com", quest: "https://q.example.com/api"},
+    questServer: "https://qs.example.com",
+    google: {recaptcha: "site-key"},
+};`,
+	".yaml": `# stress
+server:
+  vault: https://v.example.com
+  quest: "https://q.example.com/api"
+questServer: https://qs.example.com
+google: {recaptcha: site-key}
+`,
+	".toml": `questServer = "https://qs.example.com" # comment
+google.recaptcha = 'site-key'
+
+[server]
+vault = "https://v.example.com"
+"quest" = "https://q.example.com/api"
+`,
+}
+
+func TestConfigFileTypes(t *testing.T) {
+	dir := t.TempDir()
+	want := &Config{
+		Server:      map[string]interface{}{"vault": "https://v.example.com", "quest": "https://q.example.com/api"},
+		QuestServer: "https://qs.example.com",
+		Google:      GoogleConf{Recaptcha: "site-key"},
+	}
+	for ext, content := range configFileTypes {
+		path := filepath.Join(dir, "config.stress"+ext)
+		os.WriteFile(path, []byte(content), 0644)
+		got, err := readConfigFile(path, configTypeAuto)
+		if err != nil {
+			t.Errorf("%s: %v", ext, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Server, want.Server) || got.QuestServer != want.QuestServer || got.Google != want.Google {
+			t.Errorf("%s: got %+v, want %+v", ext, got, want)
+		}
+		if keys := strings.Join(got.orderedServerKeys(), ","); keys != "vault,quest" {
+			t.Errorf("%s: server keys = %s, want vault,quest", ext, keys)
+		}
+	}
+
+	// auto takes the first type that exists; a type only looks at its own files
+	if got := filepath.Base(envConfigPath(dir, "stress", configTypeAuto)); got != "config.stress.json" {
+		t.Errorf("auto picked %s", got)
+	}
+	if got := filepath.Base(envConfigPath(dir, "stress", "yaml")); got != "config.stress.yaml" {
+		t.Errorf("yaml picked %s", got)
+	}
+	if got := filepath.Base(envConfigPath(dir, "nope", "toml")); got != "config.nope.toml" {
+		t.Errorf("missing toml = %s", got)
+	}
+	if got := len(envConfigFiles(dir, "stress")); got != len(configFileTypes) {
+		t.Errorf("envConfigFiles found %d files, want %d", got, len(configFileTypes))
+	}
+}
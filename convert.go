@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// orderedObject is a JSON/JS object that keeps its keys in source order
+type orderedObject []orderedField
+
+type orderedField struct {
+	Key   string
+	Value interface{}
+}
+
+// MarshalJSON writes the fields in order
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range o {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(field.Key)
+		buf.Write(key)
+		buf.WriteByte(':')
+		value, err := json.Marshal(field.Value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// convertProblem is a construct of a JS config that has no JSON equivalent
+type convertProblem struct {
+	Line    int    `json:"line"`
+	Key     string `json:"key"` // the property that was left out, e.g. "firebase.apiKey"
+	Message string `json:"message"`
+}
+
+func (p convertProblem) String() string {
+	return fmt.Sprintf("line %d: %s (%s left out)", p.Line, p.Message, p.Key)
+}
+
+// jsTranslator turns the literal parts of a JS config into JSON values and
+// collects what it can't translate
+type jsTranslator struct {
+	src      string
+	problems []convertProblem
+	notes    []string // changes that keep the meaning, e.g. renamed keys
+}
+
+func (tr *jsTranslator) problem(t jsToken, key, format string, args ...interface{}) {
+	tr.problems = append(tr.problems, convertProblem{t.Line, key, fmt.Sprintf(format, args...)})
+}
+
+// translateJSConfig translates the object a JS config exports
+// (module.exports = function () { return {...} }, module.exports = {...} or
+// export default {...}) with its keys in order. Properties it can't translate
+// are left out and reported.
+func translateJSConfig(src string) (orderedObject, *jsTranslator, error) {
+	tokens, err := tokenizeJS(src)
+	if err != nil {
+		return nil, nil, err
+	}
+	code := skipComments(tokens)
+	open, close := exportedObject(code)
+	if open < 0 {
+		return nil, nil, fmt.Errorf("no exported config object (module.exports = ... or export default ...)")
+	}
+	if close < 0 {
+		return nil, nil, fmt.Errorf("line %d: unclosed object", code[open].Line)
+	}
+	tr := &jsTranslator{src: src}
+	return tr.object(code, open, close, ""), tr, nil
+}
+
+// exportedObject returns the indexes of the { and } of the exported config
+// object in tokens without comments, or -1, -1
+func exportedObject(code []jsToken) (int, int) {
+	for i := 0; i < len(code); i++ {
+		start := -1
+		switch {
+		case i+3 < len(code) && code[i].is("module") && code[i+1].is(".") && code[i+2].is("exports") && code[i+3].is("="):
+			start = i + 4
+		case i+1 < len(code) && code[i].is("export") && code[i+1].is("default"):
+			start = i + 2
+		}
+		if start < 0 || start >= len(code) {
+			continue
+		}
+		if code[start].is("{") {
+			return start, closingToken(code, start)
+		}
+		// A function: the object it returns (return {...}, => ({...}) or => {return {...}})
+		for j := start; j+1 < len(code); j++ {
+			arrow := code[j].is("=") && code[j+1].is(">")
+			if !code[j].is("return") && !arrow {
+				continue
+			}
+			k := j + 1
+			if arrow {
+				k = j + 2
+			}
+			if k+1 < len(code) && code[k].is("(") && code[k+1].is("{") {
+				k++
+			}
+			if k < len(code) && code[k].is("{") && (!arrow || code[k-1].is("(")) {
+				return k, closingToken(code, k)
+			}
+		}
+		return -1, -1
+	}
+	return -1, -1
+}
+
+// splitTopLevel splits tokens[open+1:close] at the commas outside brackets
+func splitTopLevel(code []jsToken, open, close int) [][]jsToken {
+	parts := make([][]jsToken, 0)
+	start := open + 1
+	for i := open + 1; i < close; i++ {
+		switch {
+		case code[i].is("{") || code[i].is("[") || code[i].is("("):
+			if end := closingToken(code, i); end > 0 && end < close {
+				i = end
+			}
+		case code[i].is(","):
+			parts = append(parts, code[start:i])
+			start = i + 1
+		}
+	}
+	if start < close {
+		parts = append(parts, code[start:close])
+	}
+	return parts
+}
+
+// object translates the object literal between open and close
+func (tr *jsTranslator) object(code []jsToken, open, close int, path string) orderedObject {
+	obj := make(orderedObject, 0)
+	for _, part := range splitTopLevel(code, open, close) {
+		if len(part) == 0 {
+			continue
+		}
+		var name string
+		switch part[0].Kind {
+		case jsIdent, jsNumber:
+			name = part[0].Text
+		case jsString:
+			name = unquoteJS(part[0].Text)
+		}
+		if name == "" || len(part) < 3 || !part[1].is(":") {
+			text := tr.source(part)
+			tr.problem(part[0], joinKey(path, text), "%s is not a key: value property (spread, shorthand, computed key or method)", text)
+			continue
+		}
+		// The JS loader reads the old misspelling; JSON configs need the real name
+		if path == "firebase" && name == "messaginSenderId" {
+			tr.notes = append(tr.notes, fmt.Sprintf("line %d: renamed firebase.messaginSenderId to messagingSenderId", part[0].Line))
+			name = "messagingSenderId"
+		}
+		if value, ok := tr.value(part[2:], joinKey(path, name)); ok {
+			obj = append(obj, orderedField{name, value})
+		}
+	}
+	return obj
+}
+
+// value translates the tokens of one value: a literal, object or array
+func (tr *jsTranslator) value(part []jsToken, path string) (interface{}, bool) {
+	first := part[0]
+	switch {
+	case first.is("{") || first.is("["):
+		end := closingToken(part, 0)
+		if end == len(part)-1 {
+			if first.is("{") {
+				return tr.object(part, 0, end, path), true
+			}
+			list := make([]interface{}, 0)
+			for i, item := range splitTopLevel(part, 0, end) {
+				if len(item) == 0 {
+					continue
+				}
+				value, ok := tr.value(item, fmt.Sprintf("%s[%d]", path, i))
+				if !ok {
+					return nil, false
+				}
+				list = append(list, value)
+			}
+			return list, true
+		}
+	case len(part) == 1:
+		if value, ok := jsLiteral(first); ok {
+			return value, true
+		}
+	case len(part) == 2 && first.is("-") && part[1].Kind == jsNumber:
+		if value, ok := jsLiteral(part[1]); ok {
+			return json.Number("-" + string(value.(json.Number))), true
+		}
+	}
+	tr.problem(first, path, "%s can't be translated", describeJS(part, tr.source(part)))
+	return nil, false
+}
+
+// jsLiteral converts a string, number, plain template, true, false or null token
+func jsLiteral(t jsToken) (interface{}, bool) {
+	switch t.Kind {
+	case jsString:
+		return unquoteJS(t.Text), true
+	case jsTemplate:
+		if !strings.Contains(t.Text, "${") {
+			return unquoteJS(t.Text), true
+		}
+	case jsNumber:
+		if json.Valid([]byte(t.Text)) {
+			return json.Number(t.Text), true
+		}
+		if f, err := strconv.ParseFloat(t.Text, 64); err == nil { // .5, 1., 1_000
+			return json.Number(strconv.FormatFloat(f, 'f', -1, 64)), true
+		}
+		if n, err := strconv.ParseInt(t.Text, 0, 64); err == nil {
+			return json.Number(strconv.FormatInt(n, 10)), true
+		}
+	case jsIdent:
+		switch t.Text {
+		case "true":
+			return true, true
+		case "false":
+			return false, true
+		case "null":
+			return nil, true
+		}
+	}
+	return nil, false
+}
+
+// describeJS names the construct a value uses, for problem reports
+func describeJS(part []jsToken, text string) string {
+	for i, t := range part {
+		switch {
+		case t.is("require"):
+			return "require(...)"
+		case t.is("function") || (t.is("=") && i+1 < len(part) && part[i+1].is(">")):
+			return "a function"
+		case t.is("process") && i+2 < len(part) && part[i+2].is("env"):
+			return "an environment variable (process.env)"
+		case t.Kind == jsTemplate && strings.Contains(t.Text, "${"):
+			return "a template literal with ${...}"
+		}
+	}
+	for i, t := range part {
+		switch {
+		case t.is("+"):
+			return "string concatenation"
+		case t.is("?") || t.is("|") || t.is("&"):
+			return "a conditional expression"
+		case t.Kind == jsIdent && i+1 < len(part) && part[i+1].is("("):
+			return fmt.Sprintf("the function call %s(...)", t.Text)
+		}
+	}
+	variable := true
+	for _, t := range part {
+		variable = variable && (t.Kind == jsIdent || t.is("."))
+	}
+	if variable {
+		return "the variable " + text
+	}
+	return "the expression " + text
+}
+
+// source returns the source text of tokens on one line, shortened for messages
+func (tr *jsTranslator) source(part []jsToken) string {
+	text := strings.Join(strings.Fields(tr.src[part[0].Start:part[len(part)-1].End]), " ")
+	if len(text) > 40 {
+		text = text[:37] + "..."
+	}
+	return text
+}
+
+func joinKey(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// decodeOrderedJSON decodes JSON with objects as orderedObject
+func decodeOrderedJSON(data []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	value, err := decodeOrderedValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, fmt.Errorf("unexpected data after the top-level value")
+	}
+	return value, nil
+}
+
+func decodeOrderedValue(dec *json.Decoder) (interface{}, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		obj := make(orderedObject, 0)
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj = append(obj, orderedField{key.(string), value})
+		}
+		_, err := dec.Token() // }
+		return obj, err
+	case json.Delim('['):
+		list := make([]interface{}, 0)
+		for dec.More() {
+			value, err := decodeOrderedValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token() // ]
+		return list, err
+	}
+	return token, nil
+}
+
+// convertedFile is the outcome of converting one env config
+type convertedFile struct {
+	Source   string           `json:"source"`
+	Target   string           `json:"target"`
+	Written  bool             `json:"written"`
+	Skipped  string           `json:"skipped,omitempty"` // why nothing was written
+	Problems []convertProblem `json:"problems,omitempty"`
+	Notes    []string         `json:"notes,omitempty"`
+}
+
+// convertResult is the --output json result of `envswitch convert`
+type convertResult struct {
+	From      string          `json:"from"`
+	To        string          `json:"to"`
+	ConfigDir string          `json:"configDir"`
+	DryRun    bool            `json:"dryRun"`
+	Files     []convertedFile `json:"files"`
+}
+
+// convertConfig renders the content of a config file in the other type and
+// reports what the JS → JSON translation left out or changed
+func convertConfig(path, to string) ([]byte, *jsTranslator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if to == "json" {
+		tree, tr, err := translateJSConfig(string(data))
+		if err != nil {
+			return nil, nil, err
+		}
+		out, err := json.MarshalIndent(tree, "", "  ")
+		return append(out, '\n'), tr, err
+	}
+
+	tree, err := decodeOrderedJSON(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The function form gulp configs use, so gulp can keep calling it
+	out, err := json.MarshalIndent(tree, "    ", "    ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte("module.exports = function () {\n    return " + string(out) + ";\n};\n"), &jsTranslator{}, nil
+}
+
+// convertConfigs converts every env config of one type in configDir to the
+// other. Existing targets are only replaced with force, and files with
+// untranslatable parts only with partial.
+func convertConfigs(configDir, from, to string, dryRun, force, partial bool) ([]convertedFile, error) {
+	files := make([]convertedFile, 0)
+	for _, env := range listEnvs(configDir) {
+		for _, ext := range configExtensions(from) {
+			source := filepath.Join(configDir, "config."+env+ext)
+			if _, err := os.Stat(source); err != nil {
+				continue
+			}
+			file := convertedFile{Source: source, Target: filepath.Join(configDir, "config."+env+configExtensions(to)[0])}
+
+			out, tr, err := convertConfig(source, to)
+			if tr != nil {
+				file.Problems, file.Notes = tr.problems, tr.notes
+			}
+			switch {
+			case err != nil:
+				file.Skipped = err.Error()
+			case len(file.Problems) > 0 && !partial:
+				file.Skipped = "it has parts that can't be translated (use --partial to write the rest)"
+			default:
+				if _, statErr := os.Stat(file.Target); statErr == nil && !force {
+					file.Skipped = "the target exists (use --force to replace it)"
+				} else if !dryRun {
+					if err := os.WriteFile(file.Target, out, 0644); err != nil {
+						return files, err
+					}
+					file.Written = true
+				}
+			}
+			files = append(files, file)
+		}
+	}
+	return files, nil
+}
+
+// runConvert implements `envswitch convert --from js --to json --config-dir dir`
+func runConvert(args []string) error {
+	fs := flag.NewFlagSet("convert", flag.ContinueOnError)
+	from := fs.String("from", "js", "Config type to convert from: js or json")
+	to := fs.String("to", "json", "Config type to convert to: json or js")
+	configDir := fs.String("config-dir", "./configs", "Directory containing the config.<env>.* files")
+	app := fs.String("app", "", "Use the config directory of a saved app")
+	dryRun := fs.Bool("dry-run", false, "Report what would be converted without writing files")
+	force := fs.Bool("force", false, "Replace target files that already exist")
+	partial := fs.Bool("partial", false, "Write files even when some of their parts can't be translated")
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 || !((*from == "js" && *to == "json") || (*from == "json" && *to == "js")) {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch convert --from js --to json | --from json --to js [--config-dir dir | --app name] [--dry-run] [--force] [--partial]"))
+	}
+	if *app != "" && !flagWasSet(fs, "config-dir") {
+		config, err := loadPersistentConfig()
+		if err != nil {
+			return err
+		}
+		saved, exists := config.Apps[*app]
+		if !exists {
+			return fmt.Errorf("app '%s' not found in the saved apps", *app)
+		}
+		*configDir = saved.ConfigDir
+	}
+
+	files, err := convertConfigs(*configDir, *from, *to, *dryRun, *force, *partial)
+	if err == nil && len(files) == 0 {
+		err = withCode(codeConfigMissing, fmt.Errorf("no %s configs in %s", *from, *configDir))
+	}
+	if err == nil {
+		for _, f := range files {
+			if f.Skipped != "" {
+				err = withCode(codeValidationFailed, fmt.Errorf("some configs were not converted"))
+				break
+			}
+		}
+	}
+	if jsonOutput() {
+		return printJSON("convert", convertResult{*from, *to, *configDir, *dryRun, files}, nil, err)
+	}
+
+	for _, f := range files {
+		switch {
+		case f.Skipped != "":
+			fmt.Printf("✗ %s: not converted, %s\n", f.Source, f.Skipped)
+		case f.Written:
+			fmt.Printf("✓ %s → %s\n", f.Source, f.Target)
+		default:
+			fmt.Printf("· %s → %s (dry run)\n", f.Source, f.Target)
+		}
+		for _, p := range f.Problems {
+			fmt.Printf("    ⚠️  %s\n", p)
+		}
+		for _, note := range f.Notes {
+			fmt.Printf("    · %s\n", note)
+		}
+	}
+	return err
+}
+
+// flagWasSet reports whether a flag was given on the command line
+func flagWasSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) { set = set || f.Name == name })
+	return set
+}
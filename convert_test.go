@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTranslateJSConfig(t *testing.T) {
+	src := `'use strict';
+var base = require('./base');
+
+module.exports = function () {
+    return {
+        server: {
+            quest: 'https://q.example.com',   // comment
+            agents: base.agents,
+            bo: "https://" + host,
+            tpv: ` + "`https://${env}.example.com`" + `,
+        },
+        timeout: -1.5,
+        retries: 0x10,
+        flags: [true, null, 'a'],
+        walkmeUrl: process.env.WALKME_URL || 'x',
+        build: getBuild(),
+        ...overrides,
+    };
+};`
+	tree, tr, err := translateJSConfig(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(tree)
+	want := `{"server":{"quest":"https://q.example.com"},"timeout":-1.5,"retries":16,"flags":[true,null,"a"]}`
+	if string(data) != want {
+		t.Errorf("got  %s\nwant %s", data, want)
+	}
+
+	wantProblems := []string{
+		"line 8: the variable base.agents can't be translated (server.agents left out)",
+		"line 9: string concatenation can't be translated (server.bo left out)",
+		"line 10: a template literal with ${...} can't be translated (server.tpv left out)",
+		"line 15: an environment variable (process.env) can't be translated (walkmeUrl left out)",
+		"line 16: the function call getBuild(...) can't be translated (build left out)",
+		"line 17: ...overrides is not a key: value property (spread, shorthand, computed key or method) (...overrides left out)",
+	}
+	got := make([]string, 0)
+	for _, p := range tr.problems {
+		got = append(got, p.String())
+	}
+	if !reflect.DeepEqual(got, wantProblems) {
+		t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(wantProblems, "\n"))
+	}
+}
+
+func TestConvertConfigs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config.cfg.js", "config.prod.js", "config.stress.json"} {
+		data, err := os.ReadFile(filepath.Join(testConfigDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		os.WriteFile(filepath.Join(dir, name), data, 0644)
+	}
+
+	// JS → JSON: the JSON configs load like the JS ones
+	files, err := convertConfigs(dir, "js", "json", false, false, false)
+	if err != nil || len(files) != 2 {
+		t.Fatalf("converted %v, %v", files, err)
+	}
+	for _, f := range files {
+		if !f.Written {
+			t.Errorf("%s not written: %s", f.Source, f.Skipped)
+			continue
+		}
+		fromJS, _ := readConfigFile(f.Source, configTypeAuto)
+		fromJSON, err := readConfigFile(f.Target, configTypeAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(fromJS.Server, fromJSON.Server) || fromJS.Firebase != fromJSON.Firebase || fromJS.Google != fromJSON.Google ||
+			strings.Join(fromJS.orderedServerKeys(), ",") != strings.Join(fromJSON.orderedServerKeys(), ",") {
+			t.Errorf("%s loads differently:\n%+v\n%+v", f.Target, fromJS, fromJSON)
+		}
+	}
+
+	// A second run leaves the targets alone
+	files, _ = convertConfigs(dir, "js", "json", false, false, false)
+	for _, f := range files {
+		if f.Written || !strings.Contains(f.Skipped, "--force") {
+			t.Errorf("%s: existing target not kept: %+v", f.Source, f)
+		}
+	}
+
+	// JSON → JS keeps the values and the key order
+	os.Remove(filepath.Join(dir, "config.stress.js"))
+	files, err = convertConfigs(dir, "json", "js", false, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := readConfigFile(filepath.Join(dir, "config.stress.js"), configTypeAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := loadTestEnv(t, "stress")
+	if !reflect.DeepEqual(back.Server, want.Server) || back.WalkmeUrl != want.WalkmeUrl ||
+		strings.Join(back.orderedServerKeys(), ",") != strings.Join(want.orderedServerKeys(), ",") {
+		t.Errorf("config.stress.js loads differently:\n%+v\n%+v", back, want)
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// addCorpusSeeds seeds a fuzz target with the files of the golden corpus
+func addCorpusSeeds(f *testing.F, pattern string, add func(content string)) {
+	paths, err := filepath.Glob(filepath.Join("testdata", pattern))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		add(string(data))
+	}
+}
+
+// jsBalanced reports whether content tokenizes and every bracket is closed
+func jsBalanced(content string) bool {
+	tokens, err := tokenizeJS("{" + content + "\n}")
+	return err == nil && closingToken(tokens, 0) == len(tokens)-1
+}
+
+// untouchedPrefix returns how much of content comes before the first of the
+// markers, i.e. the part no replacement may change
+func untouchedPrefix(content string, markers ...string) int {
+	prefix := len(content)
+	for _, marker := range markers {
+		if i := strings.Index(content, marker); i >= 0 && i < prefix {
+			prefix = i
+		}
+	}
+	return prefix
+}
+
+func FuzzParseJSConfig(f *testing.F) {
+	addCorpusSeeds(f, "configs/*.js", func(content string) { f.Add(content) })
+	f.Add(`server: 'it\'s', walkmeUrl: "a\\"`)
+	f.Add(`server: {quest: '`)
+
+	f.Fuzz(func(t *testing.T, content string) {
+		config := parseJSConfig(content)
+		// Every string value comes from the source, so re-parsing it finds the same value
+		if server, ok := config.Server.(string); ok {
+			again := parseJSConfig("server: " + quoteJS(server, '"'))
+			if again.Server != server {
+				t.Errorf("server %q read back as %q", server, again.Server)
+			}
+		}
+	})
+}
+
+func FuzzApplyReplacements(f *testing.F) {
+	addCorpusSeeds(f, "targets/serverConfig*.js", func(content string) {
+		f.Add(content, "https://api.example.com", false)
+	})
+	f.Add(`baseUrl: "a", isDist: true`, `$1 "quoted" \ back`, true)
+	f.Add("baseUrl: 'x\r\n", "y", false)
+
+	f.Fuzz(func(t *testing.T, content, value string, isDist bool) {
+		config := &Config{Server: value, QuestServer: value, QuestFront: value, Google: GoogleConf{Recaptcha: value}}
+		got := applyReplacements(content, config, isDist)
+
+		if again := applyReplacements(got, config, isDist); again != got {
+			t.Errorf("not idempotent:\n%q\n%q", got, again)
+		}
+		prefix := untouchedPrefix(content, "baseUrl", "questUrl", "questFront", "isDist", "recaptchaApiKey")
+		if !strings.HasPrefix(got, content[:prefix]) {
+			t.Errorf("changed bytes before the first key:\n%q\n%q", content, got)
+		}
+		if jsBalanced(content) && !jsBalanced(got) {
+			t.Errorf("balanced target became unbalanced:\n%q\n%q", content, got)
+		}
+	})
+}
+
+// envJsRewriteStart returns where the first region applyEnvJsReplacements may
+// rewrite starts, found the way it finds them: the urls object of
+// findVarObject, or the first match of a simple replacement
+func envJsRewriteStart(t *testing.T, content string, isDist bool) int {
+	start := len(content)
+	tokens, _ := tokenizeJS(content)
+	code := skipComments(tokens)
+	if open, close := findVarObject(code, "urls"); close >= 0 {
+		if !code[close].is("}") {
+			t.Errorf("the urls object ends at %q:\n%q", code[close].Text, content)
+		}
+		start = code[open].Start
+	}
+	for _, r := range envJsReplacements(&Config{}, isDist) {
+		if loc := r.Pattern.FindStringIndex(content); loc != nil && loc[0] < start {
+			start = loc[0]
+		}
+	}
+	return start
+}
+
+func FuzzApplyEnvJsReplacements(f *testing.F) {
+	addCorpusSeeds(f, "targets/env*.js", func(content string) {
+		f.Add(content, "https://quest.example.com", false)
+	})
+	f.Add(`var urls = {"a": "}"}; var isDist = true`, "}{", true)
+	f.Add(`var urls = { // }`+"\n"+`"a": 1 }; var walkMeUrl= "w"`, `$0`, false)
+	f.Add(`var urls = {{}; var recaptchaKey = "k"`, "v", false)
+
+	f.Fuzz(func(t *testing.T, content, value string, isDist bool) {
+		config := &Config{
+			Server:    map[string]interface{}{"quest": value},
+			WalkmeUrl: value,
+			Google:    GoogleConf{Recaptcha: value},
+		}
+		got := applyEnvJsReplacements(content, config, isDist)
+
+		if again := applyEnvJsReplacements(got, config, isDist); again != got {
+			t.Errorf("not idempotent:\n%q\n%q", got, again)
+		}
+		prefix := envJsRewriteStart(t, content, isDist)
+		if !strings.HasPrefix(got, content[:prefix]) {
+			t.Errorf("changed bytes before the first rewritten value:\n%q\n%q", content, got)
+		}
+		if jsBalanced(content) && !jsBalanced(got) {
+			t.Errorf("balanced target became unbalanced:\n%q\n%q", content, got)
+		}
+	})
+}
+
+func FuzzEvalJSConfig(f *testing.F) {
+	addCorpusSeeds(f, "configs/*.js", func(content string) { f.Add(content) })
+	f.Add("const a = `x${[1, 2].map(n => n * 2)}`; module.exports = { server: a + 1 };")
+	f.Add("export default { ...{ a: 1 }, b: typeof c ?? 'd' };")
+
+	dir := f.TempDir()
+	f.Fuzz(func(t *testing.T, content string) {
+		path := filepath.Join(dir, "config.fuzz.js")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		// Any input either loads or fails, within the limits
+		evalJSConfig(path)
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// gitGuardMarker identifies the pre-commit hook written by `git-guard install`
+const gitGuardMarker = "# envswitch git-guard"
+
+// gitOutput runs git inside dir and returns its trimmed stdout
+func gitOutput(dir string, args ...string) (string, error) {
+	out, err := gitRaw(dir, args...)
+	return strings.TrimRight(out, "\r\n"), err
+}
+
+// gitRaw is gitOutput without trimming, for file contents
+func gitRaw(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", err
+	}
+	return string(out), nil
+}
+
+// isGitTracked reports whether a file is tracked by the git repo it lives in
+// (false when git isn't installed or the file is outside a repo)
+func isGitTracked(path string) bool {
+	_, err := gitOutput(filepath.Dir(path), "ls-files", "--error-unmatch", "--", filepath.Base(path))
+	return err == nil
+}
+
+// setSkipWorktree sets or clears git's skip-worktree bit on a tracked file
+func setSkipWorktree(path string, skip bool) error {
+	flagName := "--no-skip-worktree"
+	if skip {
+		flagName = "--skip-worktree"
+	}
+	_, err := gitOutput(filepath.Dir(path), "update-index", flagName, "--", filepath.Base(path))
+	return err
+}
+
+// isAtDefaultEnv decides whether a switched target points at its default env:
+// by env name when a default env is designated, otherwise by comparing the
+// new content with the committed (HEAD) version of the file
+func isAtDefaultEnv(env, defaultEnv, targetPath, content string) bool {
+	if defaultEnv != "" {
+		return env == defaultEnv
+	}
+	committed, err := gitOutput(filepath.Dir(targetPath), "show", "HEAD:./"+filepath.Base(targetPath))
+	return err == nil && committed == strings.TrimRight(content, "\r\n")
+}
+
+// guardTarget marks a tracked target skip-worktree while it points at a
+// non-default env and clears the mark when it is back on the default env.
+// It returns a short note for the user, or "" when the target isn't tracked.
+func guardTarget(targetPath, env, defaultEnv, content string) (string, error) {
+	if !isGitTracked(targetPath) {
+		return "", nil
+	}
+	if isAtDefaultEnv(env, defaultEnv, targetPath, content) {
+		if err := setSkipWorktree(targetPath, false); err != nil {
+			return "", err
+		}
+		return "git: skip-worktree cleared (target is back on its default env)", nil
+	}
+	if err := setSkipWorktree(targetPath, true); err != nil {
+		return "", err
+	}
+	return "git: target marked skip-worktree so the switch isn't committed by accident", nil
+}
+
+// runGitGuard implements `envswitch git-guard install|check|status`
+func runGitGuard(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch git-guard install|check"))
+	}
+
+	fs := flag.NewFlagSet("git-guard "+args[0], flag.ContinueOnError)
+	repo := fs.String("repo", ".", "Any directory inside the git repository")
+	force := fs.Bool("force", false, "Replace an existing pre-commit hook that wasn't written by envswitch")
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return withCode(codeUsage, err)
+	}
+
+	switch args[0] {
+	case "install":
+		return installGitGuard(*repo, *force)
+	case "check":
+		if err := checkGitGuard(*repo); err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printDone("git-guard", "No staged target differs from its default env")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown git-guard command '%s' (use install or check)", args[0])
+	}
+}
+
+// installGitGuard writes a pre-commit hook that runs `envswitch git-guard check`
+func installGitGuard(repo string, force bool) error {
+	hooksDir, err := gitOutput(repo, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(repo, hooksDir)
+	}
+	hookPath := filepath.Join(hooksDir, "pre-commit")
+
+	if existing, err := os.ReadFile(hookPath); err == nil && !strings.Contains(string(existing), gitGuardMarker) && !force {
+		return fmt.Errorf("%s already exists; add `envswitch git-guard check` to it or rerun with --force", hookPath)
+	}
+
+	// Prefer the envswitch on PATH; fall back to this binary
+	bin := "envswitch"
+	if _, err := exec.LookPath(bin); err != nil {
+		if self, err := os.Executable(); err == nil {
+			bin = self
+		}
+	}
+
+	script := fmt.Sprintf("#!/bin/sh\n%s\n# Refuses commits of switched targets that differ from their default env\nexec %q git-guard check\n", gitGuardMarker, bin)
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(hookPath, []byte(script), 0755); err != nil {
+		return err
+	}
+
+	return printDone("git-guard", "Installed pre-commit hook: "+hookPath,
+		"Commits are refused when a staged target differs from its app's defaultEnv")
+}
+
+// checkGitGuard fails when a staged target of a saved app (with a defaultEnv)
+// differs from what its default env would render
+func checkGitGuard(repo string) error {
+	root, err := gitOutput(repo, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return err
+	}
+	staged, err := gitOutput(root, "diff", "--cached", "--name-only", "-z")
+	if err != nil {
+		return err
+	}
+	stagedFiles := make(map[string]bool)
+	for _, name := range strings.Split(staged, "\x00") {
+		if name != "" {
+			stagedFiles[filepath.Clean(filepath.Join(root, name))] = true
+		}
+	}
+
+	config, err := loadPersistentConfig()
+	if err != nil {
+		return err
+	}
+
+	problems := make([]string, 0)
+	for name, app := range config.Apps {
+		if app.DefaultEnv == "" || app.TargetPath == "" {
+			continue
+		}
+		target, err := filepath.Abs(app.TargetPath)
+		if err != nil || !stagedFiles[filepath.Clean(target)] {
+			continue
+		}
+		rel, err := filepath.Rel(root, target)
+		if err != nil {
+			continue
+		}
+
+		content, err := gitRaw(root, "show", ":"+filepath.ToSlash(rel))
+		if err != nil {
+			return err
+		}
+		configPath := envConfigPath(app.ConfigDir, app.DefaultEnv, app.configType())
+		config, err := loadEnvConfig(configPath, app.configType(), app.KeyFile)
+		if err != nil {
+			return fmt.Errorf("%s: loading default env config %s: %v", name, configPath, err)
+		}
+		onDefault, err := isOnDefaultEnv(content, app, config, target)
+		if err != nil {
+			return fmt.Errorf("%s: rendering template %s: %v", name, app.Template, err)
+		}
+		if !onDefault {
+			problems = append(problems, fmt.Sprintf("  %s (%s) is not on its default env '%s'", rel, name, app.DefaultEnv))
+		}
+	}
+
+	if len(problems) > 0 {
+		return withCode(codeValidationFailed, fmt.Errorf("commit refused by envswitch git-guard:\n%s\nSwitch back with `envswitch --app <name> --env <default>` or unstage the file", strings.Join(problems, "\n")))
+	}
+	return nil
+}
+
+// isOnDefaultEnv reports whether switching the staged content to the app's default
+// env leaves it as is. isDist isn't part of the env (the build sets it), so a
+// target passes with either value.
+func isOnDefaultEnv(content string, app AppConfig, config *Config, target string) (bool, error) {
+	protected := isProtected(config, app.DefaultEnv, app.ProtectedEnvs)
+	for _, isDist := range []bool{false, true} {
+		rendered := renderTarget(content, config, app.Format, isDist)
+		if app.Template != "" {
+			var err error
+			if rendered, err = renderTemplate(app.Template, config, app.DefaultEnv, isDist); err != nil {
+				return false, err
+			}
+		}
+		if markProtected(rendered, target, app.DefaultEnv, protected) == content {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repo with serverConfig.js committed on the test env
+func gitRepo(t *testing.T) (repo, target string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo = t.TempDir()
+	target = filepath.Join(repo, "serverConfig.js")
+	content, err := os.ReadFile(filepath.Join(testGoldenDir, "serverConfig.js.test.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(target, content, 0644)
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "serverConfig.js"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+	} {
+		if _, err := gitOutput(repo, args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repo, target
+}
+
+// skipWorktree reports whether git has the skip-worktree bit on a file
+func skipWorktree(t *testing.T, repo, name string) bool {
+	t.Helper()
+	out, err := gitOutput(repo, "ls-files", "-v", "--", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.HasPrefix(out, "S ")
+}
+
+func TestGuardTarget(t *testing.T) {
+	repo, target := gitRepo(t)
+	committed, _ := os.ReadFile(target)
+	stress, _ := os.ReadFile(filepath.Join(testGoldenDir, "serverConfig.js.stress.golden"))
+
+	for _, tt := range []struct {
+		env, defaultEnv, content string
+		skip                     bool
+	}{
+		{"stress", "", string(stress), true},
+		{"test", "", string(committed), false},
+		{"stress", "stress", string(stress), false},
+		{"test", "stress", string(committed), true},
+	} {
+		note, err := guardTarget(target, tt.env, tt.defaultEnv, tt.content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := skipWorktree(t, repo, "serverConfig.js"); got != tt.skip || note == "" {
+			t.Errorf("%s (default %q): skip-worktree = %v, want %v (note %q)", tt.env, tt.defaultEnv, got, tt.skip, note)
+		}
+	}
+
+	untracked := filepath.Join(repo, "env.js")
+	os.WriteFile(untracked, stress, 0644)
+	if note, err := guardTarget(untracked, "stress", "", string(stress)); note != "" || err != nil {
+		t.Errorf("untracked target: note %q, err %v", note, err)
+	}
+}
+
+// The check loads the default env with the app's keyfile and refuses a staged
+// target that isn't on it, whatever its isDist
+func TestCheckGitGuard(t *testing.T) {
+	repo, target := gitRepo(t)
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv(secretKeyEnvVar, "")
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(home, "config.json"))
+
+	// The default env has a secret only the app's keyfile opens
+	configDir := filepath.Join(home, "configs")
+	os.MkdirAll(configDir, 0755)
+	keyFile := filepath.Join(home, "vault.key")
+	os.WriteFile(keyFile, []byte("vault passphrase\n"), 0600)
+	encrypted, err := encryptSecret("test-maps-key", "vault passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(filepath.Join(testConfigDir, "config.test.json"))
+	os.WriteFile(filepath.Join(configDir, "config.test.json"), []byte(strings.Replace(string(data), `"test-maps-key"`, `"`+encrypted+`"`, 1)), 0644)
+	data, _ = os.ReadFile(filepath.Join(testConfigDir, "config.stress.json"))
+	os.WriteFile(filepath.Join(configDir, "config.stress.json"), data, 0644)
+
+	app := AppConfig{ConfigDir: configDir, TargetPath: target, Format: "serverConfig", DefaultEnv: "test", KeyFile: keyFile}
+	if err := savePersistentConfig(PersistentConfig{Apps: map[string]AppConfig{"Vault": app}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		env    string
+		isDist bool
+		refuse bool
+	}{
+		{"test", false, false},
+		{"test", true, false},
+		{"stress", false, true},
+	} {
+		opts := switchOptions{ConfigDir: configDir, TargetPath: target, Env: tt.env, Format: "serverConfig", IsDist: tt.isDist, KeyFile: keyFile}
+		if _, err := executeSwitch(opts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gitOutput(repo, "add", "serverConfig.js"); err != nil {
+			t.Fatal(err)
+		}
+		err := checkGitGuard(repo)
+		if !tt.refuse && err != nil {
+			t.Errorf("%s (isDist %v) refused: %v", tt.env, tt.isDist, err)
+		}
+		if tt.refuse && (errorCode(err) != codeValidationFailed || !strings.Contains(err.Error(), "serverConfig.js (Vault) is not on its default env 'test'")) {
+			t.Errorf("%s (isDist %v): err = %v, want a refused commit", tt.env, tt.isDist, err)
+		}
+	}
+
+	// Without the keyfile the default env can't be loaded
+	app.KeyFile = ""
+	if err := savePersistentConfig(PersistentConfig{Apps: map[string]AppConfig{"Vault": app}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkGitGuard(repo); err == nil || !strings.Contains(err.Error(), "no secrets key") {
+		t.Errorf("err = %v, want a missing key", err)
+	}
+}
+
+func TestInstallGitGuard(t *testing.T) {
+	repo, _ := gitRepo(t)
+	hookPath := filepath.Join(repo, ".git", "hooks", "pre-commit")
+	os.MkdirAll(filepath.Dir(hookPath), 0755)
+	os.WriteFile(hookPath, []byte("#!/bin/sh\nnpm test\n"), 0755)
+
+	if err := installGitGuard(repo, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("err = %v, want an existing hook refused", err)
+	}
+	if data, _ := os.ReadFile(hookPath); string(data) != "#!/bin/sh\nnpm test\n" {
+		t.Fatalf("hook overwritten without --force: %q", data)
+	}
+
+	if _, err := captureStdout(t, func() error { return installGitGuard(repo, true) }); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(hookPath)
+	if !strings.Contains(string(data), gitGuardMarker) || !strings.Contains(string(data), "git-guard check") {
+		t.Errorf("hook = %q", data)
+	}
+	// Its own hook is replaced without --force
+	if _, err := captureStdout(t, func() error { return installGitGuard(repo, false) }); err != nil {
+		t.Errorf("reinstall: %v", err)
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+const (
+	testConfigDir = "testdata/configs"
+	testTargetDir = "testdata/targets"
+	testGoldenDir = "testdata/golden"
+
+	testTemplateDir = "testdata/templates"
+)
+
+// targetFormat picks the format of a testdata target by its name
+func targetFormat(name string) string {
+	if strings.HasPrefix(name, "env") {
+		return "envJs"
+	}
+	return "serverConfig"
+}
+
+// loadTestEnv loads the testdata/configs/config.<env>.* file of an env
+func loadTestEnv(t *testing.T, env string) *Config {
+	t.Helper()
+	config, err := loadEnvConfig(envConfigPath(testConfigDir, env, configTypeAuto), configTypeAuto, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// checkGolden compares got with a golden file, or rewrites it with -update
+func checkGolden(t *testing.T, path, got string) {
+	t.Helper()
+	if *update {
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("output differs from %s (run go test -update if the change is intended)\n--- got ---\n%s\n--- want ---\n%s", path, got, want)
+	}
+}
+
+// TestGoldenTargets renders every testdata target against every env
+func TestGoldenTargets(t *testing.T) {
+	envs := listEnvs(testConfigDir)
+	targets, err := filepath.Glob(filepath.Join(testTargetDir, "*.js"))
+	if err != nil || len(targets) == 0 || len(envs) == 0 {
+		t.Fatalf("empty testdata corpus: %v", err)
+	}
+
+	for _, target := range targets {
+		name := filepath.Base(target)
+		content, err := os.ReadFile(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, env := range envs {
+			t.Run(name+"/"+env, func(t *testing.T) {
+				config := loadTestEnv(t, env)
+				got := renderTarget(string(content), config, targetFormat(name), false)
+				checkGolden(t, filepath.Join(testGoldenDir, name+"."+env+".golden"), got)
+
+				// Switching again to the same env changes nothing
+				if again := renderTarget(got, config, targetFormat(name), false); again != got {
+					t.Errorf("second switch to %s changed the target:\n%s", env, again)
+				}
+			})
+		}
+	}
+}
+
+// TestGoldenTemplates renders every testdata template against every env
+func TestGoldenTemplates(t *testing.T) {
+	templates, err := filepath.Glob(filepath.Join(testTemplateDir, "*.tmpl"))
+	if err != nil || len(templates) == 0 {
+		t.Fatalf("no templates in %s: %v", testTemplateDir, err)
+	}
+
+	for _, path := range templates {
+		for _, env := range listEnvs(testConfigDir) {
+			t.Run(filepath.Base(path)+"/"+env, func(t *testing.T) {
+				got, err := renderTemplate(path, loadTestEnv(t, env), env, env == "prod")
+				if err != nil {
+					t.Fatal(err)
+				}
+				checkGolden(t, filepath.Join(testGoldenDir, filepath.Base(path)+"."+env+".golden"), got)
+			})
+		}
+	}
+}
+
+// TestGoldenJSConfigs checks what LoadConfigFromJS reads from the JS configs
+func TestGoldenJSConfigs(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join(testConfigDir, "*.js"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no JS configs in %s: %v", testConfigDir, err)
+	}
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			config, err := LoadConfigFromJS(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.MarshalIndent(config, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, filepath.Join(testGoldenDir, filepath.Base(path)+".json.golden"), string(data)+"\n")
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// defaultHookTimeout applies when neither --hook-timeout nor "hookTimeout" is set
+const defaultHookTimeout = 2 * time.Minute
+
+// hookConfig holds the commands run around writing the target
+type hookConfig struct {
+	PreSwitch         []string
+	PostSwitch        []string
+	Timeout           time.Duration
+	RollbackOnFailure bool // restore the target when a post-switch hook fails
+
+	// Untrusted is the workspace file whose hooks were skipped because it
+	// isn't trusted, if any
+	Untrusted string
+}
+
+// hooks returns the saved hook settings of an app
+func (a AppConfig) hooks() hookConfig {
+	timeout, err := time.ParseDuration(a.HookTimeout)
+	if err != nil || timeout <= 0 {
+		timeout = defaultHookTimeout
+	}
+	return hookConfig{
+		PreSwitch:         a.PreSwitch,
+		PostSwitch:        a.PostSwitch,
+		Timeout:           timeout,
+		RollbackOnFailure: a.RollbackOnPostFailure,
+		Untrusted:         untrustedWorkspace(a),
+	}
+}
+
+// stringList is a repeatable string flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// hookFlags are the hook flags of commands that write the target
+type hookFlags struct {
+	preSwitch  stringList
+	postSwitch stringList
+	timeout    *time.Duration
+	rollback   *bool
+}
+
+// addHookFlags registers the hook flags on a flag set
+func addHookFlags(fs *flag.FlagSet) *hookFlags {
+	h := &hookFlags{}
+	fs.Var(&h.preSwitch, "pre-switch", "Command to run before writing the target; a failure aborts the switch (repeatable)")
+	fs.Var(&h.postSwitch, "post-switch", "Command to run after writing the target (repeatable)")
+	h.timeout = fs.Duration("hook-timeout", 0, "Time limit for each hook command (default 2m)")
+	h.rollback = fs.Bool("rollback-on-failure", false, "Restore the target if a post-switch hook fails")
+	return h
+}
+
+// config merges the flags with the saved app hooks; flags given explicitly win
+func (h *hookFlags) config(saved AppConfig) hookConfig {
+	hooks := saved.hooks()
+	if len(h.preSwitch) > 0 {
+		hooks.PreSwitch = h.preSwitch
+	}
+	if len(h.postSwitch) > 0 {
+		hooks.PostSwitch = h.postSwitch
+	}
+	if *h.timeout > 0 {
+		hooks.Timeout = *h.timeout
+	}
+	if *h.rollback {
+		hooks.RollbackOnFailure = true
+	}
+	return hooks
+}
+
+// runHooks runs each command of a stage in order and stops at the first failure.
+// Hooks get ENVSWITCH_ENV, ENVSWITCH_CONFIG_PATH, ENVSWITCH_TARGET_PATH and ENVSWITCH_HOOK.
+func runHooks(stage string, commands []string, timeout time.Duration, opts switchOptions, configPath string) error {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+
+	for _, command := range commands {
+		fmt.Fprintf(out, "▸ %s: %s\n", stage, command)
+		if err := runHook(command, timeout, out, []string{
+			"ENVSWITCH_ENV=" + opts.Env,
+			"ENVSWITCH_CONFIG_PATH=" + configPath,
+			"ENVSWITCH_TARGET_PATH=" + opts.TargetPath,
+			"ENVSWITCH_HOOK=" + stage,
+		}); err != nil {
+			return fmt.Errorf("%s hook '%s' failed: %v", stage, command, err)
+		}
+	}
+	return nil
+}
+
+// runHook runs one command through the system shell, streaming its output
+func runHook(command string, timeout time.Duration, out io.Writer, env []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdout = out
+	cmd.Stderr = out
+	// Don't wait forever on background children still holding the output open
+	cmd.WaitDelay = 2 * time.Second
+	// A timeout kills what the hook started too, not only the shell
+	killProcessGroup(cmd)
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// hookSwitch sets up a target on the test env and the options of a switch to
+// stress with hooks
+func hookSwitch(t *testing.T, hooks hookConfig) (switchOptions, string, *strings.Builder) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks in these tests are sh commands")
+	}
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	original, err := os.ReadFile("testdata/golden/serverConfig.js.test.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "serverConfig.js")
+	os.WriteFile(target, original, 0644)
+	if hooks.Timeout == 0 {
+		hooks.Timeout = 10 * time.Second
+	}
+	out := &strings.Builder{}
+	opts := switchOptions{ConfigDir: "testdata/configs", TargetPath: target, Env: "stress", Hooks: hooks, Output: out}
+	return opts, string(original), out
+}
+
+func readTarget(t *testing.T, opts switchOptions) string {
+	t.Helper()
+	content, err := os.ReadFile(opts.TargetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestPreSwitchHookAborts(t *testing.T) {
+	opts, original, out := hookSwitch(t, hookConfig{PreSwitch: []string{"echo checking", "exit 3", "echo never"}})
+	_, err := executeSwitch(opts)
+	if errorCode(err) != codeHookFailed || !strings.Contains(err.Error(), "switch aborted") {
+		t.Fatalf("err = %v, want a hook failure", err)
+	}
+	if readTarget(t, opts) != original {
+		t.Error("the target was written after a failed pre-switch hook")
+	}
+	if !strings.Contains(out.String(), "checking") || strings.Contains(out.String(), "never") {
+		t.Errorf("output:\n%s", out)
+	}
+}
+
+// Hooks get the switch in ENVSWITCH_* variables and their output is streamed
+func TestHookEnv(t *testing.T) {
+	opts, _, out := hookSwitch(t, hookConfig{
+		PreSwitch:  []string{`echo "pre $ENVSWITCH_ENV $ENVSWITCH_HOOK"`},
+		PostSwitch: []string{`echo "post $ENVSWITCH_HOOK $ENVSWITCH_TARGET_PATH $(basename "$ENVSWITCH_CONFIG_PATH")"`},
+	})
+	if _, err := executeSwitch(opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"▸ pre-switch: echo",
+		"pre stress pre-switch\n",
+		"post post-switch " + opts.TargetPath + " config.stress.json\n",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output misses %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestPostSwitchHookRollback(t *testing.T) {
+	hooks := hookConfig{PostSwitch: []string{"exit 1"}, RollbackOnFailure: true}
+	opts, original, _ := hookSwitch(t, hooks)
+	_, err := executeSwitch(opts)
+	if errorCode(err) != codeHookFailed || !strings.Contains(err.Error(), "rolled back") {
+		t.Fatalf("err = %v, want a rolled back hook failure", err)
+	}
+	if readTarget(t, opts) != original {
+		t.Error("the target wasn't restored")
+	}
+
+	// Without rollback, the switch stays
+	hooks.RollbackOnFailure = false
+	opts, original, _ = hookSwitch(t, hooks)
+	if _, err := executeSwitch(opts); errorCode(err) != codeHookFailed {
+		t.Fatalf("err = %v, want a hook failure", err)
+	}
+	if content := readTarget(t, opts); content == original || !strings.Contains(content, "stress") {
+		t.Error("the target was restored without rollback")
+	}
+}
+
+// A hook that runs past its timeout is killed, with what it started
+func TestHookTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the hook is a sh command")
+	}
+	marker := filepath.Join(t.TempDir(), "marker")
+	start := time.Now()
+	err := runHook("(sleep 1; touch '"+marker+"') & sleep 5", 200*time.Millisecond, &strings.Builder{}, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out after 200ms") {
+		t.Fatalf("err = %v, want a timeout", err)
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("took %v to time out", took)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if _, err := os.Stat(marker); !os.IsNotExist(err) {
+		t.Error("a child of the hook kept running after the timeout")
+	}
+}
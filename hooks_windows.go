@@ -0,0 +1,7 @@
+package main
+
+import "os/exec"
+
+// killProcessGroup keeps the default cancellation on Windows, which only
+// kills cmd.exe
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -3,6 +3,8 @@ package main
 import (
 	"os"
 	"regexp"
+	"strconv"
+	"strings"
 )
 
 // LoadConfigFromJS parses your existing JavaScript config files directly
@@ -20,16 +22,22 @@ func LoadConfigFromJS(path string) (*Config, error) {
 	if err != nil {
 		return nil, err
 	}
+	return parseJSConfig(string(data)), nil
+}
 
-	content := string(data)
+// parseJSConfig extracts the known config fields from JS source
+func parseJSConfig(content string) *Config {
 	config := &Config{}
 
 	// Try to extract server - could be a string or an object
-	serverStringRe := regexp.MustCompile(`server:\s*['"]([^'"]+)['"]`)
-	if matches := serverStringRe.FindStringSubmatch(content); len(matches) > 1 {
-		config.Server = matches[1]
+	if value, ok := jsStringField(content, "server"); ok {
+		config.Server = value
+	} else if values, keys := jsServerObject(content); len(keys) > 0 {
+		// Every string property of server: {...}, in file order
+		config.Server = values
+		config.serverKeys = keys
 	} else {
-		// Extract server as an object by finding individual fields
+		// Files the tokenizer can't read: look for the known server fields
 		serverMap := make(map[string]interface{})
 
 		// Known server object fields
@@ -37,9 +45,8 @@ func LoadConfigFromJS(path string) (*Config, error) {
 
 		for _, field := range serverFields {
 			// Match patterns like: quest: 'value' or quest: "value"
-			re := regexp.MustCompile(field + `:\s*['"]([^'"]+)['"]`)
-			if matches := re.FindStringSubmatch(content); len(matches) > 1 {
-				serverMap[field] = matches[1]
+			if value, ok := jsStringField(content, field); ok {
+				serverMap[field] = value
 			}
 		}
 
@@ -50,57 +57,190 @@ func LoadConfigFromJS(path string) (*Config, error) {
 
 	// Simple extractors for top-level string values
 	simpleExtractors := []struct {
-		pattern string
-		target  *string
+		key    string
+		target *string
 	}{
-		{`questServer:\s*['"]([^'"]+)['"]`, &config.QuestServer},
-		{`questFront:\s*['"]([^'"]+)['"]`, &config.QuestFront},
-		{`walkmeUrl:\s*['"]([^'"]+)['"]`, &config.WalkmeUrl},
+		{"questServer", &config.QuestServer},
+		{"questFront", &config.QuestFront},
+		{"walkmeUrl", &config.WalkmeUrl},
 	}
 
 	for _, ext := range simpleExtractors {
-		re := regexp.MustCompile(ext.pattern)
-		if matches := re.FindStringSubmatch(content); len(matches) > 1 {
-			*ext.target = matches[1]
+		if value, ok := jsStringField(content, ext.key); ok {
+			*ext.target = value
 		}
 	}
 
 	// Extract Firebase config
 	firebaseExtractors := []struct {
-		pattern string
-		target  *string
+		key    string
+		target *string
 	}{
-		{`apiKey:\s*['"]([^'"]+)['"]`, &config.Firebase.ApiKey},
-		{`authDomain:\s*['"]([^'"]+)['"]`, &config.Firebase.AuthDomain},
-		{`databaseURL:\s*['"]([^'"]+)['"]`, &config.Firebase.DatabaseURL},
-		{`storageBucket:\s*['"]([^'"]+)['"]`, &config.Firebase.StorageBucket},
-		{`messaginSenderId:\s*['"]([^'"]+)['"]`, &config.Firebase.MessagingSenderId}, // Note: typo in original
-		{`messagingSenderId:\s*['"]([^'"]+)['"]`, &config.Firebase.MessagingSenderId},
+		{"apiKey", &config.Firebase.ApiKey},
+		{"authDomain", &config.Firebase.AuthDomain},
+		{"databaseURL", &config.Firebase.DatabaseURL},
+		{"storageBucket", &config.Firebase.StorageBucket},
+		{"messaginSenderId", &config.Firebase.MessagingSenderId}, // Note: typo in original
+		{"messagingSenderId", &config.Firebase.MessagingSenderId},
 	}
 
 	for _, ext := range firebaseExtractors {
-		re := regexp.MustCompile(ext.pattern)
-		if matches := re.FindStringSubmatch(content); len(matches) > 1 {
-			*ext.target = matches[1]
+		if value, ok := jsStringField(content, ext.key); ok {
+			*ext.target = value
 		}
 	}
 
 	// Extract Google config
 	googleExtractors := []struct {
-		pattern string
-		target  *string
+		key    string
+		target *string
 	}{
-		{`mapsKey:\s*['"]([^'"]+)['"]`, &config.Google.MapsKey},
-		{`analytics:\s*['"]([^'"]+)['"]`, &config.Google.Analytics},
-		{`recaptcha:\s*['"]([^'"]+)['"]`, &config.Google.Recaptcha},
+		{"mapsKey", &config.Google.MapsKey},
+		{"analytics", &config.Google.Analytics},
+		{"recaptcha", &config.Google.Recaptcha},
 	}
 
 	for _, ext := range googleExtractors {
-		re := regexp.MustCompile(ext.pattern)
-		if matches := re.FindStringSubmatch(content); len(matches) > 1 {
-			*ext.target = matches[1]
+		if value, ok := jsStringField(content, ext.key); ok {
+			*ext.target = value
 		}
 	}
 
-	return config, nil
+	config.Protected = jsBoolField(content, "protected")
+
+	return config
+}
+
+// jsServerObject returns the string properties of the `server: {...}` object
+// and their order, or no keys when there is none (or the file doesn't tokenize)
+func jsServerObject(content string) (map[string]interface{}, []string) {
+	tokens, err := tokenizeJS(content)
+	if err != nil {
+		return nil, nil
+	}
+	code := skipComments(tokens)
+	for i := 0; i+2 < len(code); i++ {
+		key := code[i]
+		isServer := key.is("server") || (key.Kind == jsString && unquoteJS(key.Text) == "server")
+		if !isServer || !code[i+1].is(":") || !code[i+2].is("{") {
+			continue
+		}
+		props, ok := objectProperties(code, i+2, closingToken(code, i+2))
+		if !ok {
+			return nil, nil
+		}
+		values := make(map[string]interface{})
+		keys := make([]string, 0, len(props))
+		for _, prop := range props {
+			if _, dup := values[prop.Key]; dup || len(prop.Value) != 1 || prop.Value[0].Kind != jsString {
+				continue
+			}
+			values[prop.Key] = unquoteJS(prop.Value[0].Text)
+			keys = append(keys, prop.Key)
+		}
+		return values, keys
+	}
+	return nil, nil
+}
+
+// jsStringField finds the first `key: 'value'` or `"key": "value"` in content
+// (key as a whole word) and returns the unquoted value
+func jsStringField(content, key string) (string, bool) {
+	re := regexp.MustCompile(`['"]?\b` + regexp.QuoteMeta(key) + `\b['"]?\s*:\s*(` + jsStringValue + `)`)
+	matches := re.FindStringSubmatch(content)
+	if matches == nil {
+		return "", false
+	}
+	return unquoteJS(matches[1]), true
+}
+
+// jsBoolField reports whether the config object of content (see
+// configObject) has `key: true` as one of its own properties. A key of a
+// nested object, or one in a comment or a string, doesn't count.
+func jsBoolField(content, key string) bool {
+	tokens, err := tokenizeJS(content)
+	if err != nil {
+		return false
+	}
+	code := skipComments(tokens)
+	open := configObject(code)
+	if open < 0 {
+		return false
+	}
+	end := closingToken(code, open)
+	if end < 0 {
+		return false
+	}
+	for i := open + 1; i+2 < end; i++ {
+		switch tok := code[i]; {
+		case tok.is("{") || tok.is("[") || tok.is("("):
+			if i = closingToken(code, i); i < 0 {
+				return false
+			}
+		case code[i-1].is("{") || code[i-1].is(","):
+			isKey := tok.is(key) || (tok.Kind == jsString && unquoteJS(tok.Text) == key)
+			if isKey && code[i+1].is(":") && code[i+2].is("true") && (i+3 == end || code[i+3].is(",")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// configObject returns the index of the { of the first object literal in
+// code that is assigned, returned, exported or passed (`= {`, `return {`,
+// `default {`, `({`), which is the config object of a config file, or -1
+func configObject(code []jsToken) int {
+	for i, tok := range code {
+		if !tok.is("{") {
+			continue
+		}
+		if i == 0 {
+			return i
+		}
+		prev := code[i-1]
+		if prev.is("=") || prev.is("return") || prev.is("default") || prev.is("(") {
+			return i
+		}
+	}
+	return -1
+}
+
+// unquoteJS strips the quotes of a JS string literal and resolves the simple
+// escapes (\n, \t, \uXXXX, \', \", \\)
+func unquoteJS(literal string) string {
+	body := literal[1 : len(literal)-1]
+	if !strings.Contains(body, `\`) {
+		return body
+	}
+	var s strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' || i+1 == len(body) {
+			s.WriteByte(body[i])
+			continue
+		}
+		i++
+		switch body[i] {
+		case 'n':
+			s.WriteByte('\n')
+		case 'r':
+			s.WriteByte('\r')
+		case 't':
+			s.WriteByte('\t')
+		case 'b':
+			s.WriteByte('\b')
+		case 'f':
+			s.WriteByte('\f')
+		case 'u':
+			if r, err := strconv.ParseUint(body[i+1:min(i+5, len(body))], 16, 32); err == nil && i+5 <= len(body) {
+				s.WriteRune(rune(r))
+				i += 4
+			} else {
+				s.WriteByte('u')
+			}
+		default:
+			s.WriteByte(body[i])
+		}
+	}
+	return s.String()
 }
@@ -0,0 +1,515 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja/parser"
+)
+
+// The js-eval config type runs JS configs in goja, a JS engine written in Go,
+// instead of reading their literals, so computed values (base + '/api',
+// require('./common')) work without Node.js. Configs run sandboxed: goja has
+// no filesystem or network access of its own, require only loads files of
+// the config dir, and every run is interrupted after jsEvalTimeout.
+
+const (
+	jsEvalTimeout  = 2 * time.Second
+	jsEvalMaxDepth = 1000 // nested function calls
+)
+
+// jsSandbox runs the modules of one config evaluation
+type jsSandbox struct {
+	vm      *goja.Runtime
+	root    string                  // the config dir, which require can't leave
+	main    string                  // the config file, named "line N" in errors
+	modules map[string]*goja.Object // the module object of every file run, for require
+}
+
+// evalJSConfig runs a JS config in the sandbox and returns the config it
+// exports (calling it first when it exports a function)
+func evalJSConfig(path string) (*Config, error) {
+	root, err := filepath.Abs(filepath.Dir(path))
+	if err == nil {
+		root, err = filepath.EvalSymlinks(root)
+	}
+	if err != nil {
+		return nil, err
+	}
+	vm := goja.New()
+	vm.SetMaxCallStackSize(jsEvalMaxDepth)
+	timer := time.AfterFunc(jsEvalTimeout, func() { vm.Interrupt("timeout") })
+	defer timer.Stop()
+
+	sb := &jsSandbox{vm: vm, root: root, main: filepath.Base(path), modules: make(map[string]*goja.Object)}
+	if err := sb.globals(); err != nil {
+		return nil, err
+	}
+	exported, err := sb.runModule(filepath.Join(root, sb.main))
+	if err != nil {
+		return nil, sb.error(err)
+	}
+	if fn, ok := goja.AssertFunction(exported); ok {
+		if exported, err = fn(goja.Undefined()); err != nil {
+			return nil, sb.error(err)
+		}
+	}
+	obj, ok := exported.(*goja.Object)
+	if !ok || obj.ClassName() == "Function" || obj.ClassName() == "Array" {
+		return nil, fmt.Errorf("the config exports %s, not an object", jsTypeOf(exported))
+	}
+
+	// Legacy configs misspell firebase.messagingSenderId, as parseJSConfig knows
+	if firebase, ok := obj.Get("firebase").(*goja.Object); ok {
+		value := firebase.Get("messaginSenderId")
+		if value != nil && firebase.Get("messagingSenderId") == nil {
+			firebase.Set("messagingSenderId", value)
+		}
+	}
+
+	// JSON keeps the key order of the server map
+	stringify, _ := goja.AssertFunction(vm.Get("JSON").ToObject(vm).Get("stringify"))
+	text, err := stringify(goja.Undefined(), obj)
+	if err != nil {
+		return nil, fmt.Errorf("the config can't be turned into JSON: %v", sb.error(err))
+	}
+	var config Config
+	if err := json.Unmarshal([]byte(text.String()), &config); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// jsEnvAllowVar lists the variables configs see in process.env (comma
+// separated, NAME or PREFIX_*); by default they see none
+const jsEnvAllowVar = "ENVSWITCH_JS_ENV"
+
+// jsEnvVisible reports whether a config sees an environment variable. The
+// variables of envswitch itself ($ENVSWITCH_SECRET_KEY...) are never visible.
+func jsEnvVisible(key, allow string) bool {
+	if strings.HasPrefix(key, "ENVSWITCH_") {
+		return false
+	}
+	for _, pattern := range strings.Split(allow, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if prefix, wildcard := strings.CutSuffix(pattern, "*"); wildcard && strings.HasPrefix(key, prefix) || key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// globals sets the globals configs get besides the JS builtins: process.env
+// and a console that prints nothing
+func (sb *jsSandbox) globals() error {
+	env := sb.vm.NewObject()
+	vars := os.Environ()
+	sort.Strings(vars)
+	allow := os.Getenv(jsEnvAllowVar)
+	for _, kv := range vars {
+		if key, value, ok := strings.Cut(kv, "="); ok && jsEnvVisible(key, allow) {
+			env.Set(key, value)
+		}
+	}
+	process := sb.vm.NewObject()
+	process.Set("env", env)
+
+	// console output would end up in the middle of envswitch's own
+	console := sb.vm.NewObject()
+	for _, name := range []string{"log", "info", "warn", "error", "debug"} {
+		console.Set(name, func(goja.FunctionCall) goja.Value { return goja.Undefined() })
+	}
+
+	if err := sb.vm.Set("process", process); err != nil {
+		return err
+	}
+	return sb.vm.Set("console", console)
+}
+
+// runModule runs a JS file as a CommonJS module and returns its exports
+func (sb *jsSandbox) runModule(path string) (goja.Value, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	name := sb.name(path)
+	// The wrapper keeps the code on its own lines, so errors point at them
+	src := "(function (exports, require, module, __filename, __dirname) {" + esmToCommonJS(string(data)) + "\n})"
+	ast, err := parser.ParseFile(nil, name, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	program, err := goja.CompileAST(ast, false)
+	if err != nil {
+		return nil, err
+	}
+	wrapper, err := sb.vm.RunProgram(program)
+	if err != nil {
+		return nil, err
+	}
+	fn, _ := goja.AssertFunction(wrapper)
+
+	module := sb.vm.NewObject()
+	exports := sb.vm.NewObject()
+	module.Set("exports", exports)
+	sb.modules[path] = module
+	dir := filepath.Dir(path)
+	require := func(call goja.FunctionCall) goja.Value {
+		return sb.require(dir, call.Argument(0).String())
+	}
+	if _, err := fn(goja.Undefined(), exports, sb.vm.ToValue(require), module, sb.vm.ToValue(name), sb.vm.ToValue(".")); err != nil {
+		return nil, err
+	}
+	return module.Get("exports"), nil
+}
+
+// require loads a ./file of the config dir: JS files are run once, JSON
+// files parsed. Failures are thrown into the calling module.
+func (sb *jsSandbox) require(dir, spec string) goja.Value {
+	if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") {
+		sb.throw(fmt.Errorf("require('%s'): only files of the config dir can be required (./file)", spec))
+	}
+	base := filepath.Join(dir, filepath.FromSlash(spec))
+	path := ""
+	for _, candidate := range []string{base, base + ".js", base + ".json", base + ".mjs", base + ".cjs", filepath.Join(base, "index.js")} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			path = candidate
+			break
+		}
+	}
+	if path == "" {
+		sb.throw(fmt.Errorf("require('%s'): no such file", spec))
+	}
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		sb.throw(err)
+	}
+	rel, err := filepath.Rel(sb.root, real)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		sb.throw(fmt.Errorf("require('%s'): the file is outside the config dir", spec))
+	}
+
+	// A module being run (a require cycle) returns what it exported so far, as in Node
+	if module, ok := sb.modules[real]; ok {
+		return module.Get("exports")
+	}
+	if filepath.Ext(real) == ".json" {
+		data, err := os.ReadFile(real)
+		if err != nil {
+			sb.throw(err)
+		}
+		parse, _ := goja.AssertFunction(sb.vm.Get("JSON").ToObject(sb.vm).Get("parse"))
+		value, err := parse(goja.Undefined(), sb.vm.ToValue(string(data)))
+		if err != nil {
+			sb.throw(fmt.Errorf("%s: %v", filepath.ToSlash(rel), sb.error(err)))
+		}
+		module := sb.vm.NewObject()
+		module.Set("exports", value)
+		sb.modules[real] = module
+		return value
+	}
+	exports, err := sb.runModule(real)
+	if err != nil {
+		sb.throw(err)
+	}
+	return exports
+}
+
+// throw raises err in the running JS code; errors of goja (exceptions of a
+// required module, the interrupt) go through unchanged
+func (sb *jsSandbox) throw(err error) {
+	switch err.(type) {
+	case *goja.Exception, *goja.InterruptedError, *goja.StackOverflowError:
+		panic(err)
+	}
+	panic(sb.vm.NewGoError(err))
+}
+
+// name is how errors name a file: relative to the config dir
+func (sb *jsSandbox) name(path string) string {
+	if rel, err := filepath.Rel(sb.root, path); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// error turns an error of goja into "file line N: message", like the errors
+// of the other config loaders (the config itself is just "line N")
+func (sb *jsSandbox) error(err error) error {
+	var interrupted *goja.InterruptedError
+	var overflow *goja.StackOverflowError
+	var exception *goja.Exception
+	var syntax *goja.CompilerSyntaxError
+	var parseErrors parser.ErrorList
+	switch {
+	case errors.As(err, &interrupted):
+		return fmt.Errorf("the config took longer than %v to evaluate", jsEvalTimeout)
+	case errors.As(err, &overflow):
+		return fmt.Errorf("too much recursion (more than %d nested calls)", jsEvalMaxDepth)
+	case errors.As(err, &parseErrors) && len(parseErrors) > 0:
+		pos := parseErrors[0].Position
+		return fmt.Errorf("%s: SyntaxError: %s", sb.where(pos.Filename, pos.Line), parseErrors[0].Message)
+	case errors.As(err, &syntax):
+		if syntax.File == nil {
+			return fmt.Errorf("SyntaxError: %s", syntax.Message)
+		}
+		pos := syntax.File.Position(syntax.Offset)
+		return fmt.Errorf("%s: SyntaxError: %s", sb.where(pos.Filename, pos.Line), syntax.Message)
+	case errors.As(err, &exception):
+		message := exception.Value().String()
+		if cause := exception.Unwrap(); cause != nil {
+			message = cause.Error()
+		}
+		for _, frame := range exception.Stack() {
+			if pos := frame.Position(); pos.Line > 0 {
+				return fmt.Errorf("%s: %s", sb.where(pos.Filename, pos.Line), message)
+			}
+		}
+		return errors.New(message)
+	}
+	return err
+}
+
+// where names a line of a file for errors
+func (sb *jsSandbox) where(file string, line int) string {
+	if file == sb.main {
+		return fmt.Sprintf("line %d", line)
+	}
+	return fmt.Sprintf("%s line %d", file, line)
+}
+
+// jsTypeOf returns the typeof of a value, "null" and "an array" included
+func jsTypeOf(value goja.Value) string {
+	switch {
+	case value == nil || goja.IsUndefined(value):
+		return "undefined"
+	case goja.IsNull(value):
+		return "null"
+	}
+	if obj, ok := value.(*goja.Object); ok {
+		if obj.ClassName() == "Array" {
+			return "an array"
+		}
+		if _, ok := goja.AssertFunction(obj); ok {
+			return "function"
+		}
+		return "object"
+	}
+	switch value.Export().(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		return "number"
+	}
+}
+
+// esmToCommonJS rewrites the top-level import and export statements of an ES
+// module into require and exports, the part of ESM configs use:
+//
+//	import a from './a'              const a = require('./a')
+//	import { b, c as d } from './b'  const { b, c: d } = require('./b')
+//	export default {...}             module.exports = {...}
+//	export const e = 1               const e = 1 (+ exports.e = e at the end)
+//	export { e as f }                (exports.f = e at the end)
+//
+// Replaced statements keep their line breaks, so errors point at the source.
+// Code without import/export (CommonJS) comes back unchanged.
+func esmToCommonJS(src string) string {
+	tokens, err := tokenizeJS(src)
+	if err != nil {
+		return src // goja reports the syntax error
+	}
+	code := skipComments(tokens)
+
+	var out strings.Builder
+	var exported []string // "exports.name = local" run at the end of the module
+	last, depth := 0, 0
+	replace := func(start, end int, text string) {
+		out.WriteString(src[last:start])
+		out.WriteString(text)
+		out.WriteString(strings.Repeat("\n", strings.Count(src[start:end], "\n")))
+		last = end
+	}
+
+	for i := 0; i < len(code); i++ {
+		t := code[i]
+		switch {
+		case t.is("{") || t.is("(") || t.is("["):
+			depth++
+			continue
+		case t.is("}") || t.is(")") || t.is("]"):
+			depth--
+			continue
+		}
+		if depth != 0 || t.Kind != jsIdent || (t.Text != "import" && t.Text != "export") || i+1 >= len(code) {
+			continue
+		}
+		// Only statements: not a.import, import(...) or import.meta
+		if i > 0 && (code[i-1].is(".") || code[i-1].Line == t.Line && !code[i-1].is(";") && !code[i-1].is("}")) {
+			continue
+		}
+		next := code[i+1]
+		if next.is("(") || next.is(".") {
+			continue
+		}
+
+		if t.Text == "import" {
+			if next.Kind == jsString {
+				replace(t.Start, next.End, "require("+next.Text+")")
+				i++
+				continue
+			}
+			from := i + 1
+			for from < len(code) && !(code[from].is("from") && from+1 < len(code) && code[from+1].Kind == jsString) {
+				from++
+			}
+			if from >= len(code) {
+				continue
+			}
+			source := "require(" + code[from+1].Text + ")"
+			var names []string
+			for j := i + 1; j < from; j++ {
+				switch tok := code[j]; {
+				case tok.is("*") && j+2 < from && code[j+1].is("as"):
+					names = append(names, code[j+2].Text)
+					j += 2
+				case tok.is("{"):
+					end := j
+					for end < from && !code[end].is("}") {
+						end++
+					}
+					names = append(names, strings.ReplaceAll(src[tok.Start:code[end].End], " as ", ": "))
+					j = end
+				case tok.Kind == jsIdent:
+					names = append(names, tok.Text)
+				}
+			}
+			decls := make([]string, 0, len(names))
+			for k, name := range names {
+				init := source
+				if k > 0 && !strings.HasPrefix(names[0], "{") {
+					init = names[0] // import a, { b } from: b is a property of a
+				}
+				decls = append(decls, name+" = "+init)
+			}
+			end := code[from+1].End
+			if from+2 < len(code) && code[from+2].is(";") {
+				end = code[from+2].End
+			}
+			replace(t.Start, end, "const "+strings.Join(decls, ", ")+";")
+			i = from + 1
+			continue
+		}
+
+		switch {
+		case next.is("default"):
+			replace(t.Start, next.End, "module.exports =")
+			i++
+
+		case next.is("const") || next.is("let") || next.is("var"):
+			replace(t.Start, next.Start, "")
+			exported = append(exported, declaredJSNames(code, i+2)...)
+			i++
+
+		case next.is("function") || next.is("class") || next.is("async"):
+			j := i + 2
+			for j < len(code) && (code[j].is("function") || code[j].is("*")) {
+				j++
+			}
+			if j < len(code) && code[j].Kind == jsIdent {
+				exported = append(exported, code[j].Text)
+			}
+			replace(t.Start, next.Start, "")
+			i++
+
+		case next.is("*"):
+			// export * from './file'
+			if i+3 < len(code) && code[i+2].is("from") && code[i+3].Kind == jsString {
+				replace(t.Start, code[i+3].End, "Object.assign(exports, require("+code[i+3].Text+"))")
+				i += 3
+			}
+
+		case next.is("{"):
+			close := closingToken(code, i+1)
+			if close < 0 {
+				continue
+			}
+			end := code[close].End
+			source := ""
+			if close+2 < len(code) && code[close+1].is("from") && code[close+2].Kind == jsString {
+				source = "require(" + code[close+2].Text + ")."
+				end = code[close+2].End
+			}
+			var now []string
+			for _, spec := range strings.Split(src[next.End:code[close].Start], ",") {
+				local, as, found := strings.Cut(strings.TrimSpace(spec), " as ")
+				if !found {
+					as = local
+				}
+				if local = strings.TrimSpace(local); local == "" {
+					continue
+				}
+				assign := "exports." + strings.TrimSpace(as) + " = " + source + local
+				if source != "" {
+					now = append(now, assign)
+				} else {
+					exported = append(exported, strings.TrimSpace(as)+" = "+local)
+				}
+			}
+			replace(t.Start, end, strings.Join(now, "; "))
+			i = close
+		}
+	}
+	if last == 0 {
+		return src
+	}
+	out.WriteString(src[last:])
+	if len(exported) > 0 {
+		out.WriteString("\n")
+	}
+	for _, name := range exported {
+		if !strings.Contains(name, " = ") {
+			name += " = " + name
+		}
+		out.WriteString("; exports." + name)
+	}
+	return out.String()
+}
+
+// declaredJSNames returns the names a var/let/const declaration starting at
+// code[start] declares (destructuring patterns aside): the first one and
+// those after a top-level comma, up to the end of the statement
+func declaredJSNames(code []jsToken, start int) []string {
+	var names []string
+	if start < len(code) && code[start].Kind == jsIdent {
+		names = append(names, code[start].Text)
+	}
+	depth := 0
+	for j := start + 1; j < len(code); j++ {
+		t := code[j]
+		switch {
+		case t.is("{") || t.is("(") || t.is("["):
+			depth++
+		case t.is("}") || t.is(")") || t.is("]"):
+			depth--
+		case depth > 0:
+		case t.is(";"), t.Line != code[j-1].Line && !t.is(",") && !code[j-1].is(",") && !code[j-1].is("="):
+			return names
+		case t.is(",") && j+1 < len(code) && code[j+1].Kind == jsIdent:
+			names = append(names, code[j+1].Text)
+		}
+		if depth < 0 {
+			return names
+		}
+	}
+	return names
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFiles writes name → content files into a new temp dir
+func writeFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestEvalJSConfig(t *testing.T) {
+	t.Setenv("TEST_REGION", "eu")
+	t.Setenv(jsEnvAllowVar, "TEST_REGION")
+	tests := []struct {
+		name  string
+		files map[string]string // config.js plus what it requires
+		want  string            // the config as JSON
+	}{
+		{
+			name: "computed values",
+			files: map[string]string{"config.js": `
+				const base = 'https://api.example.com';
+				var version = 2;
+				module.exports = function () {
+				    return {
+				        server: { quest: base + '/quest', agents: ` + "`${base}/v${version}/agents`" + ` },
+				        questServer: base.replace('api', 'quest'),
+				        walkmeUrl: process.env.TEST_REGION === 'eu' ? base + '/eu.js' : base + '/us.js'
+				    };
+				};`},
+			want: `{"server":{"quest":"https://api.example.com/quest","agents":"https://api.example.com/v2/agents"},"questServer":"https://quest.example.com","walkmeUrl":"https://api.example.com/eu.js"}`,
+		},
+		{
+			name: "require of JS and JSON files",
+			files: map[string]string{
+				"config.js": `
+					const common = require('./common');
+					const { recaptcha } = require('./keys.json');
+					module.exports = {
+					    ...common,
+					    server: Object.assign({}, common.server, { vault: common.host('vault') }),
+					    google: { recaptcha }
+					};`,
+				"common.js": `
+					function host(name) { return 'https://' + name + '.example.com'; }
+					module.exports = { host, server: { quest: host('quest') }, questFront: host('front') };`,
+				"keys.json": `{"recaptcha": "site-key"}`,
+			},
+			want: `{"server":{"quest":"https://quest.example.com","vault":"https://vault.example.com"},"questFront":"https://front.example.com","google":{"recaptcha":"site-key"}}`,
+		},
+		{
+			name: "ESM with imports and arrow functions",
+			files: map[string]string{
+				"config.mjs": `
+					import { hosts } from './shared/hosts.mjs';
+					const url = (name) => ` + "`https://${name}.example.com`" + `;
+					export default () => ({
+					    server: Object.fromEntries ? undefined : null,
+					    questServer: hosts.map(url).join(' '),
+					});`,
+				"shared/hosts.mjs": `export const hosts = ['a', 'b'].concat(['c']);`,
+			},
+			want: `{"server":null,"questServer":"https://a.example.com https://b.example.com https://c.example.com"}`,
+		},
+		{
+			name: "loops, classes and exceptions",
+			files: map[string]string{"config.js": `
+				class Hosts {
+				    constructor(domain) { this.domain = domain; }
+				    url(name) { return 'https://' + name + '.' + this.domain; }
+				}
+				const hosts = new Hosts('example.com');
+				const server = {};
+				for (const name of ['quest', 'agents']) server[name] = hosts.url(name);
+				let tries = 0;
+				while (tries < 3) tries++;
+				let front;
+				try {
+				    throw new Error('no front');
+				} catch (e) {
+				    front = hosts.url('front') + '#' + e.message.split(' ').length + tries;
+				}
+				switch (server.quest.length) {
+				default:
+				    module.exports = { server, questFront: front };
+				}`},
+			want: `{"server":{"quest":"https://quest.example.com","agents":"https://agents.example.com"},"questFront":"https://front.example.com#23"}`,
+		},
+		{
+			name: "named ESM exports",
+			files: map[string]string{
+				"config.mjs": `
+					import * as urls from './urls.mjs';
+					import base, { quest as q } from './urls.mjs';
+					export const questServer = q, questFront = base.front;
+					export function unused() {}
+					const walkme = urls.front + '/walkme.js';
+					export { walkme as walkmeUrl };`,
+				"urls.mjs": `
+					export const quest = 'https://quest.example.com';
+					export let front = 'https://front.example.com';`,
+			},
+			want: `{"questServer":"https://quest.example.com","questFront":"https://front.example.com","walkmeUrl":"https://front.example.com/walkme.js"}`,
+		},
+		{
+			name:  "misspelt messaginSenderId",
+			files: map[string]string{"config.js": `module.exports = { firebase: { messaginSenderId: String(5 * 111) } };`},
+			want:  `{"firebase":{"messagingSenderId":"555"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, tt.files)
+			name := "config.js"
+			if _, ok := tt.files["config.mjs"]; ok {
+				name = "config.mjs"
+			}
+			got, err := evalJSConfig(filepath.Join(dir, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := loadConfigJSON([]byte(tt.want))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v\nwant %+v", got, want)
+			}
+		})
+	}
+}
+
+// loadConfigJSON decodes a config like loadConfig does
+func loadConfigJSON(data []byte) (*Config, error) {
+	var config Config
+	err := json.Unmarshal(data, &config)
+	return &config, err
+}
+
+func TestEvalJSConfigErrors(t *testing.T) {
+	outside := writeFiles(t, map[string]string{"secret.js": `module.exports = { server: 'leaked' };`})
+	tests := []struct {
+		name   string
+		config string
+		want   string // part of the error
+	}{
+		{"undefined variable", "module.exports = {\n  server: base + '/api'\n};", "line 2: ReferenceError: base is not defined"},
+		{"thrown error", "if (!process.env.TEST_UNSET) {\n  throw new Error('set the API base');\n}", "line 2: Error: set the API base"},
+		{"syntax error", "module.exports = {\n  server: 'a' 'b'\n};", "line 2: SyntaxError"},
+		{"node module", "const fs = require('fs');", "require('fs'): only files of the config dir"},
+		{"file outside the config dir", "module.exports = require('" + filepath.ToSlash(outside) + "/secret.js');", "only files of the config dir"},
+		{"missing file", "module.exports = require('./common');", "require('./common'): no such file"},
+		{"endless loop", "for (;;) {}", "took longer than 2s"},
+		{"endless recursion", "function f(n) { return f(n + 1); }\nmodule.exports = f(0);", "too much recursion"},
+		{"circular object", "const o = { a: 1 };\no.self = o;\nmodule.exports = o;", "circular"},
+		{"constant", "const a = 1;\na = 2;", "line 2: TypeError: Assignment to constant variable"},
+		{"not an object", "module.exports = function () { return 'x'; };", "exports string, not an object"},
+		{"an array", "module.exports = ['x'];", "exports an array, not an object"},
+		{"error in a callback", "module.exports = { server: [1].map(n => n.x.y).join() };", "line 1: TypeError: Cannot read property 'y' of undefined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeFiles(t, map[string]string{"config.js": tt.config})
+			_, err := evalJSConfig(filepath.Join(dir, "config.js"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvalJSConfigEnv(t *testing.T) {
+	t.Setenv(secretKeyEnvVar, "passphrase")
+	t.Setenv("API_BASE", "https://api.example.com")
+	t.Setenv("API_REGION", "eu")
+	t.Setenv("HOSTNAME", "build-42")
+	dir := writeFiles(t, map[string]string{"config.js": `module.exports = {
+		server: { a: String(process.env.ENVSWITCH_SECRET_KEY), b: String(process.env.API_BASE), c: String(process.env.HOSTNAME) },
+		questServer: Object.keys(process.env).filter(k => k.startsWith('ENVSWITCH_')).join()
+	};`})
+
+	tests := []struct {
+		allow string
+		want  map[string]interface{}
+	}{
+		{"", map[string]interface{}{"a": "undefined", "b": "undefined", "c": "undefined"}},
+		{"*", map[string]interface{}{"a": "undefined", "b": "https://api.example.com", "c": "build-42"}},
+		{"API_*", map[string]interface{}{"a": "undefined", "b": "https://api.example.com", "c": "undefined"}},
+		{"HOSTNAME, " + secretKeyEnvVar, map[string]interface{}{"a": "undefined", "b": "undefined", "c": "build-42"}},
+	}
+	for _, tt := range tests {
+		t.Setenv(jsEnvAllowVar, tt.allow)
+		config, err := evalJSConfig(filepath.Join(dir, "config.js"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(config.Server, tt.want) || config.QuestServer != "" {
+			t.Errorf("$%s=%q: server %v, ENVSWITCH_ variables %q", jsEnvAllowVar, tt.allow, config.Server, config.QuestServer)
+		}
+	}
+}
+
+func TestEvalJSConfigRequireOutside(t *testing.T) {
+	root := writeFiles(t, map[string]string{
+		"secret.js":         `module.exports = { server: 'leaked' };`,
+		"configs/config.js": `module.exports = require('../secret');`,
+		"configs/linked.js": `module.exports = require('./secret');`,
+	})
+	configs := filepath.Join(root, "configs")
+	if _, err := evalJSConfig(filepath.Join(configs, "config.js")); err == nil || !strings.Contains(err.Error(), "outside the config dir") {
+		t.Errorf("../secret: error = %v, want the file to be outside the config dir", err)
+	}
+
+	if err := os.Symlink(filepath.Join(root, "secret.js"), filepath.Join(configs, "secret.js")); err != nil {
+		t.Skip("symlinks not available:", err)
+	}
+	if _, err := evalJSConfig(filepath.Join(configs, "linked.js")); err == nil || !strings.Contains(err.Error(), "outside the config dir") {
+		t.Errorf("symlink: error = %v, want the file to be outside the config dir", err)
+	}
+}
+
+// Literal configs load the same whether they are read or evaluated
+func TestEvalJSConfigMatchesReader(t *testing.T) {
+	for _, env := range []string{"cfg", "prod"} {
+		path := filepath.Join(testConfigDir, "config."+env+".js")
+		read, err := readConfigFile(path, "js")
+		if err != nil {
+			t.Fatal(err)
+		}
+		evaluated, err := readConfigFile(path, configTypeJSEval)
+		if err != nil {
+			t.Fatalf("%s: %v", env, err)
+		}
+		if !reflect.DeepEqual(read, evaluated) {
+			t.Errorf("%s: evaluated %+v\nread %+v", env, evaluated, read)
+		}
+	}
+}
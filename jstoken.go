@@ -0,0 +1,237 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// jsTokenKind classifies the tokens of tokenizeJS
+type jsTokenKind int
+
+const (
+	jsPunct    jsTokenKind = iota // one character: { } [ ] ( ) , : ; = ...
+	jsString                      // '...' or "..."
+	jsTemplate                    // `...` (with any ${...} inside)
+	jsNumber
+	jsIdent // identifiers and keywords
+	jsComment
+)
+
+// jsToken is a token with its byte offsets in the source
+type jsToken struct {
+	Kind  jsTokenKind
+	Text  string
+	Start int
+	End   int
+	Line  int
+}
+
+// is reports whether the token is the given punctuation or identifier
+func (t jsToken) is(text string) bool {
+	return (t.Kind == jsPunct || t.Kind == jsIdent) && t.Text == text
+}
+
+// tokenizeJS splits JS source into tokens, skipping whitespace. It knows
+// enough JS for config files: strings, template literals, comments, numbers
+// and identifiers. Regex literals are not recognised. On an unterminated
+// string or comment it returns the tokens before it and an error.
+func tokenizeJS(src string) ([]jsToken, error) {
+	tokens := make([]jsToken, 0, len(src)/4)
+	line := 1
+	for i := 0; i < len(src); {
+		c := src[i]
+		start, startLine := i, line
+
+		switch {
+		case c == '\n':
+			line++
+			i++
+			continue
+		case c == ' ' || c == '\t' || c == '\r' || c == '\f' || c == '\v':
+			i++
+			continue
+
+		case c == '"' || c == '\'':
+			i++
+			for i < len(src) && src[i] != c && src[i] != '\n' {
+				if src[i] == '\\' && i+1 < len(src) {
+					if src[i+1] == '\n' {
+						line++
+					}
+					i++
+				}
+				i++
+			}
+			if i >= len(src) || src[i] != c {
+				return tokens, fmt.Errorf("line %d: unterminated string", startLine)
+			}
+			i++
+			tokens = append(tokens, jsToken{Kind: jsString, Text: src[start:i], Start: start, End: i, Line: startLine})
+
+		case c == '`':
+			end, lines, ok := templateEnd(src, i)
+			line += lines
+			if !ok {
+				return tokens, fmt.Errorf("line %d: unterminated template literal", startLine)
+			}
+			i = end
+			tokens = append(tokens, jsToken{Kind: jsTemplate, Text: src[start:i], Start: start, End: i, Line: startLine})
+
+		case strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			tokens = append(tokens, jsToken{Kind: jsComment, Text: src[start:i], Start: start, End: i, Line: startLine})
+
+		case strings.HasPrefix(src[i:], "/*"):
+			end := strings.Index(src[i+2:], "*/")
+			if end < 0 {
+				return tokens, fmt.Errorf("line %d: unterminated comment", startLine)
+			}
+			i += end + 4
+			line += strings.Count(src[start:i], "\n")
+			tokens = append(tokens, jsToken{Kind: jsComment, Text: src[start:i], Start: start, End: i, Line: startLine})
+
+		case isJSIdentChar(c) || c >= 0x80:
+			kind := jsIdent
+			if c >= '0' && c <= '9' || c == '.' {
+				kind = jsNumber
+			}
+			for i < len(src) && (isJSIdentChar(src[i]) || src[i] >= 0x80 || (kind == jsNumber && src[i] == '.')) {
+				i++
+			}
+			tokens = append(tokens, jsToken{Kind: kind, Text: src[start:i], Start: start, End: i, Line: startLine})
+
+		default:
+			i++
+			tokens = append(tokens, jsToken{Kind: jsPunct, Text: src[start:i], Start: start, End: i, Line: startLine})
+		}
+	}
+	return tokens, nil
+}
+
+func isJSIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// templateEnd returns the offset after the template literal starting at
+// start, and how many newlines it spans. Braces inside ${...} are counted
+// so a } in an expression doesn't end it early.
+func templateEnd(src string, start int) (int, int, bool) {
+	lines := 0
+	depth := 0 // nesting of ${ ... }
+	for i := start + 1; i < len(src); i++ {
+		switch c := src[i]; {
+		case c == '\n':
+			lines++
+		case c == '\\':
+			i++
+		case depth == 0 && c == '`':
+			return i + 1, lines, true
+		case depth == 0 && c == '$' && i+1 < len(src) && src[i+1] == '{':
+			depth++
+			i++
+		case depth > 0 && c == '{':
+			depth++
+		case depth > 0 && c == '}':
+			depth--
+		}
+	}
+	return len(src), lines, false
+}
+
+// skipComments returns the tokens without comments
+func skipComments(tokens []jsToken) []jsToken {
+	code := make([]jsToken, 0, len(tokens))
+	for _, t := range tokens {
+		if t.Kind != jsComment {
+			code = append(code, t)
+		}
+	}
+	return code
+}
+
+// closingToken returns the index of the token closing the { [ or ( at open,
+// or -1 when it is never closed or a bracket of another kind closes first
+func closingToken(tokens []jsToken, open int) int {
+	pairs := map[string]string{"}": "{", "]": "[", ")": "("}
+	var stack []string
+	for i := open; i < len(tokens); i++ {
+		if tokens[i].Kind != jsPunct {
+			continue
+		}
+		switch text := tokens[i].Text; text {
+		case "{", "[", "(":
+			stack = append(stack, text)
+		case "}", "]", ")":
+			if len(stack) == 0 || stack[len(stack)-1] != pairs[text] {
+				return -1
+			}
+			stack = stack[:len(stack)-1]
+			if len(stack) == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// findVarObject finds `var|let|const <name> = {` and returns the indexes of
+// the { and its closing } in tokens (comments removed), or -1, -1
+func findVarObject(tokens []jsToken, name string) (int, int) {
+	for i := 0; i+3 < len(tokens); i++ {
+		if (tokens[i].is("var") || tokens[i].is("let") || tokens[i].is("const")) &&
+			tokens[i+1].is(name) && tokens[i+2].is("=") && tokens[i+3].is("{") {
+			return i + 3, closingToken(tokens, i+3)
+		}
+	}
+	return -1, -1
+}
+
+// jsProperty is a `key: value` of an object literal
+type jsProperty struct {
+	Key   string
+	Value []jsToken // the tokens of the value
+}
+
+// objectProperties lists the properties of the object literal between the
+// tokens open and close. It fails on anything but plain `key: value`
+// properties (shorthand, spread, computed keys, methods).
+func objectProperties(tokens []jsToken, open, close int) ([]jsProperty, bool) {
+	props := make([]jsProperty, 0)
+	for i := open + 1; i < close; {
+		key := tokens[i]
+		var name string
+		switch key.Kind {
+		case jsIdent, jsNumber:
+			name = key.Text
+		case jsString:
+			name = unquoteJS(key.Text)
+		default:
+			return nil, false
+		}
+		if i+1 >= close || !tokens[i+1].is(":") {
+			return nil, false
+		}
+
+		// The value runs to the next comma outside brackets
+		start := i + 2
+		end := start
+		for end < close && !tokens[end].is(",") {
+			if t := tokens[end]; t.is("{") || t.is("[") || t.is("(") {
+				closing := closingToken(tokens, end)
+				if closing < 0 || closing > close {
+					return nil, false
+				}
+				end = closing
+			}
+			end++
+		}
+		if end == start {
+			return nil, false
+		}
+		props = append(props, jsProperty{Key: name, Value: tokens[start:end]})
+		i = end + 1
+	}
+	return props, true
+}
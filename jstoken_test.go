@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTokenizeJS(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // token texts joined by spaces
+	}{
+		{`var urls = {"a": 'b'};`, `var urls = { "a" : 'b' } ;`},
+		{"a: 'x}' // c }\n}", `a : 'x}' // c } }`},
+		{"/* { */ b: `t ${ {x: 1}.x } }` }", "/* { */ b : `t ${ {x: 1}.x } }` }"},
+		{`x: "it\"s", n: 1.5e3`, `x : "it\"s" , n : 1.5e3`},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenizeJS(tt.src)
+		if err != nil {
+			t.Errorf("tokenizeJS(%q): %v", tt.src, err)
+			continue
+		}
+		texts := make([]string, len(tokens))
+		for i, token := range tokens {
+			texts[i] = token.Text
+			if tt.src[token.Start:token.End] != token.Text {
+				t.Errorf("token %q has wrong offsets %d-%d", token.Text, token.Start, token.End)
+			}
+		}
+		if got := strings.Join(texts, " "); got != tt.want {
+			t.Errorf("tokenizeJS(%q)\n got %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestTokenizeJSErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"a: 1,\nb: 'open", "line 2: unterminated string"},
+		{"a: \"no\nnewlines\"", "line 1: unterminated string"},
+		{"/* never\nclosed", "line 1: unterminated comment"},
+		{"\n\nx: `a ${ b", "line 3: unterminated template literal"},
+	}
+	for _, tt := range tests {
+		if _, err := tokenizeJS(tt.src); err == nil || err.Error() != tt.want {
+			t.Errorf("tokenizeJS(%q) error = %v, want %s", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestTokenLines(t *testing.T) {
+	tokens, err := tokenizeJS("a\n/* x\ny */\n`1\n2`\nb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := make([]int, len(tokens))
+	for i, token := range tokens {
+		lines[i] = token.Line
+	}
+	if want := []int{1, 2, 4, 6}; len(lines) != len(want) || lines[0] != 1 || lines[1] != 2 || lines[2] != 4 || lines[3] != 6 {
+		t.Errorf("lines = %v, want %v", lines, want)
+	}
+}
+
+func TestClosingToken(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int // index of the closing token, -1 for none
+	}{
+		{"{ a: [1, (2)] }", 10},
+		{"{ a: '}' }", 4},
+		{"{ a: 1 ) }", -1},
+		{"{ a: [1 } ]", -1},
+		{"{)", -1},
+		{"{ a: 1", -1},
+	}
+	for _, tt := range tests {
+		tokens, err := tokenizeJS(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := closingToken(tokens, 0); got != tt.want {
+			t.Errorf("closingToken(%q) = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+
+	// An object closed by the wrong bracket is not found
+	tokens, _ := tokenizeJS("var\vurls={)")
+	if open, close := findVarObject(tokens, "urls"); close != -1 {
+		t.Errorf("findVarObject = %d, %d, want no closing brace", open, close)
+	}
+}
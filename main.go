@@ -1,23 +1,96 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"time"
 )
 
 // Config represents the environment configuration
 type Config struct {
-	Server      interface{} `json:"server"` // Can be string or object
-	QuestServer string      `json:"questServer"`
-	QuestFront  string      `json:"questFront"`
+	Server      interface{}  `json:"server"` // Can be string or object
+	QuestServer string       `json:"questServer"`
+	QuestFront  string       `json:"questFront"`
 	Firebase    FirebaseConf `json:"firebase"`
 	Google      GoogleConf   `json:"google"`
 	WalkmeUrl   string       `json:"walkmeUrl"`
+
+	// Protected envs need confirmation to switch to (see protected.go)
+	Protected bool `json:"protected,omitempty"`
+
+	// decrypted holds the plain values of enc:v1: secrets so output can mask them
+	decrypted []string
+
+	// serverKeys is the key order of the server object in the config file
+	// (Go maps don't keep it)
+	serverKeys []string
+}
+
+// UnmarshalJSON decodes a config and remembers the key order of its server object
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type plain Config
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return err
+	}
+	var raw struct {
+		Server json.RawMessage `json:"server"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	c.serverKeys = jsonObjectKeys(raw.Server)
+	return nil
+}
+
+// jsonObjectKeys returns the keys of a JSON object in document order
+func jsonObjectKeys(data []byte) []string {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return nil
+	}
+	keys := make([]string, 0)
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		key, _ := token.(string)
+		keys = append(keys, key)
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+	}
+	return keys
+}
+
+// orderedServerKeys returns the keys of the server object in file order
+// (any key added since, e.g. in code, follows in sorted order)
+func (c *Config) orderedServerKeys() []string {
+	values, _ := c.Server.(map[string]interface{})
+	keys := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	for _, key := range c.serverKeys {
+		if _, exists := values[key]; exists && !seen[key] {
+			keys = append(keys, key)
+			seen[key] = true
+		}
+	}
+	rest := make([]string, 0)
+	for key := range values {
+		if !seen[key] {
+			rest = append(rest, key)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
 }
 
 type FirebaseConf struct {
@@ -34,22 +107,258 @@ type GoogleConf struct {
 	Recaptcha string `json:"recaptcha"`
 }
 
-// Replacement defines a regex pattern and its replacement value
+// mapConfigStrings calls fn for every string value in the config (including the
+// server object) and stores what it returns. Names are JSON paths like "google.recaptcha".
+func mapConfigStrings(config *Config, fn func(name, value string) (string, error)) error {
+	fields := []struct {
+		name  string
+		value *string
+	}{
+		{"questServer", &config.QuestServer},
+		{"questFront", &config.QuestFront},
+		{"walkmeUrl", &config.WalkmeUrl},
+		{"firebase.apiKey", &config.Firebase.ApiKey},
+		{"firebase.authDomain", &config.Firebase.AuthDomain},
+		{"firebase.databaseURL", &config.Firebase.DatabaseURL},
+		{"firebase.storageBucket", &config.Firebase.StorageBucket},
+		{"firebase.messagingSenderId", &config.Firebase.MessagingSenderId},
+		{"google.mapsKey", &config.Google.MapsKey},
+		{"google.analytics", &config.Google.Analytics},
+		{"google.recaptcha", &config.Google.Recaptcha},
+	}
+
+	for _, f := range fields {
+		value, err := fn(f.name, *f.value)
+		if err != nil {
+			return err
+		}
+		*f.value = value
+	}
+
+	switch server := config.Server.(type) {
+	case string:
+		value, err := fn("server", server)
+		if err != nil {
+			return err
+		}
+		config.Server = value
+	case map[string]interface{}:
+		for key, raw := range server {
+			if str, ok := raw.(string); ok {
+				value, err := fn("server."+key, str)
+				if err != nil {
+					return err
+				}
+				server[key] = value
+			}
+		}
+	}
+
+	return nil
+}
+
+// configEntry is a single named value of a loaded config
+type configEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// configEntries lists the non-empty string values of a config, sorted by name
+func configEntries(config *Config) []configEntry {
+	entries := make([]configEntry, 0)
+	mapConfigStrings(config, func(name, value string) (string, error) {
+		if value != "" {
+			entries = append(entries, configEntry{name, value})
+		}
+		return value, nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Replacement sets one value in the target. Pattern captures the text before
+// the value (group 1) and the current value (group 2); everything around them,
+// like trailing commas or semicolons, is left as it is.
 type Replacement struct {
-	Pattern     *regexp.Regexp
-	Replacement string
+	Name    string // the key it sets, for the match report
+	Pattern *regexp.Regexp
+	Value   string
+	Literal bool // Value is a JS literal (true/false), not a string
+}
+
+// jsStringValue matches a single- or double-quoted JS string on one line
+const jsStringValue = `'(?:[^'\\\n]|\\.)*'|"(?:[^"\\\n]|\\.)*"`
+
+// apply replaces every match of the pattern in content
+func (r Replacement) apply(content string) string {
+	return r.Pattern.ReplaceAllStringFunc(content, func(match string) string {
+		groups := r.Pattern.FindStringSubmatch(match)
+		if r.Literal {
+			return groups[1] + r.Value
+		}
+		return groups[1] + quoteJS(r.Value, groups[2][0])
+	})
+}
+
+// quoteJS quotes a value as a JS string with the given quote character,
+// escaping like encoding/json does so rewritten values match serialized ones
+func quoteJS(value string, quote byte) string {
+	var s strings.Builder
+	s.WriteByte(quote)
+	for _, r := range value { // invalid bytes come out as U+FFFD, one each
+		switch {
+		case r == '\\' || r == rune(quote):
+			s.WriteByte('\\')
+			s.WriteRune(r)
+		case r == '\n':
+			s.WriteString(`\n`)
+		case r == '\r':
+			s.WriteString(`\r`)
+		case r == '\t':
+			s.WriteString(`\t`)
+		case r == '\b':
+			s.WriteString(`\b`)
+		case r == '\f':
+			s.WriteString(`\f`)
+		case r < 0x20 || r == '\u2028' || r == '\u2029':
+			fmt.Fprintf(&s, `\u%04x`, r)
+		default:
+			s.WriteRune(r)
+		}
+	}
+	s.WriteByte(quote)
+	return s.String()
+}
+
+// envFlags are the flags shared by the switch and the commands that load an env config
+type envFlags struct {
+	env        *string
+	configDir  *string
+	targetFile *string
+	useJS      *bool
+	configType *string
+	format     *string
+	template   *string
+	app        *string
+	keyFile    *string
+	reveal     *bool
+
+	// saved holds the --app settings once resolve has run
+	saved AppConfig
+}
+
+// addEnvFlags registers the shared env flags on a flag set
+func addEnvFlags(fs *flag.FlagSet) *envFlags {
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	return &envFlags{
+		env:        fs.String("env", "", "Environment name (test, stress, cfg, prod, etc.)"),
+		configDir:  fs.String("config-dir", "./configs", "Directory containing config.{env}.json files"),
+		targetFile: fs.String("target", "./app/shared/services/web/serverConfig.js", "Target file to modify/generate"),
+		useJS:      fs.Bool("js", false, "Same as --config-type js (kept for existing scripts)"),
+		configType: fs.String("config-type", configTypeAuto, "Config file type: auto (by extension: .json, .js/.mjs, .yaml, .toml), json, js, js-eval (run JS configs that compute values), yaml or toml"),
+		format:     fs.String("format", "serverConfig", "Format: 'serverConfig' (Angular factory) or 'envJs' (var urls = {...})"),
+		template:   fs.String("template", "", "Go text/template that renders the whole target (replaces --format; the target may not exist yet)"),
+		app:        fs.String("app", "", "Use the saved paths and settings of an app from interactive mode"),
+		keyFile:    fs.String("keyfile", "", "Keyfile with the passphrase for enc:v1: secrets (default $ENVSWITCH_SECRET_KEY or ~/.envswitch.key)"),
+		reveal:     fs.Bool("reveal", false, "Show secret values in full instead of masking them"),
+	}
+}
+
+// resolve fills in every flag that wasn't given explicitly from the saved --app settings
+func (f *envFlags) resolve(fs *flag.FlagSet) error {
+	if *f.app == "" {
+		return checkConfigType(f.configTypeValue())
+	}
+
+	config, err := loadPersistentConfig()
+	if err != nil {
+		return err
+	}
+	saved, exists := config.Apps[*f.app]
+	if !exists {
+		return fmt.Errorf("app '%s' not found in the saved apps", *f.app)
+	}
+	f.saved = saved
+
+	setFlags := make(map[string]bool)
+	fs.Visit(func(fl *flag.Flag) { setFlags[fl.Name] = true })
+	if !setFlags["config-dir"] && saved.ConfigDir != "" {
+		*f.configDir = saved.ConfigDir
+	}
+	if !setFlags["target"] && saved.TargetPath != "" {
+		*f.targetFile = saved.TargetPath
+	}
+	if !setFlags["js"] && !setFlags["config-type"] {
+		*f.configType = saved.configType()
+	}
+	if !setFlags["format"] && saved.Format != "" {
+		*f.format = saved.Format
+	}
+	if !setFlags["template"] && saved.Template != "" {
+		*f.template = saved.Template
+	}
+	if !setFlags["keyfile"] && saved.KeyFile != "" {
+		*f.keyFile = saved.KeyFile
+	}
+	if *f.env == "" {
+		*f.env = saved.LastEnv
+	}
+	return checkConfigType(f.configTypeValue())
+}
+
+// configTypeValue returns the config type of --config-type, or js for --js
+func (f *envFlags) configTypeValue() string {
+	if *f.useJS {
+		return "js"
+	}
+	return *f.configType
+}
+
+// switchOptions returns the switch described by the resolved flags
+func (f *envFlags) switchOptions() switchOptions {
+	return switchOptions{
+		ConfigDir:  *f.configDir,
+		TargetPath: *f.targetFile,
+		Env:        *f.env,
+		ConfigType: f.configTypeValue(),
+		Format:     *f.format,
+		Template:   *f.template,
+		KeyFile:    *f.keyFile,
+		App:        *f.app,
+
+		ProtectedEnvs: f.saved.ProtectedEnvs,
+	}
+}
+
+// secrets returns the values to mask in output (none with --reveal)
+func (f *envFlags) secrets(config *Config) []string {
+	if *f.reveal {
+		return nil
+	}
+	return config.secretValues(f.saved.SecretFields)
 }
 
 func main() {
 	// CLI flags
-	env := flag.String("env", "", "Environment name (test, stress, cfg, prod, etc.)")
-	configDir := flag.String("config-dir", "./configs", "Directory containing config.{env}.json files")
-	targetFile := flag.String("target", "./app/shared/services/web/serverConfig.js", "Target file to modify/generate")
+	flags := addEnvFlags(flag.CommandLine)
 	isDist := flag.Bool("dist", false, "Set isDist to true")
-	useJS := flag.Bool("js", false, "Use .js config files instead of .json (parses your existing JS configs)")
 	dryRun := flag.Bool("dry-run", false, "Show what would be changed without modifying the file")
 	interactive := flag.Bool("i", false, "Run in interactive mode with visual CLI")
-	format := flag.String("format", "serverConfig", "Format: 'serverConfig' (Angular factory) or 'envJs' (var urls = {...})")
+	hooks := addHookFlags(flag.CommandLine)
+	confirmProtected := addProtectedFlag(flag.CommandLine)
+	skipWorktree := flag.Bool("skip-worktree", false, "If the target is tracked by git, mark it skip-worktree while it points at a non-default env")
+	defaultEnv := flag.String("default-env", "", "The env the committed target should point at (used by --skip-worktree and git-guard)")
+	check := flag.Bool("check", false, "After switching, check that the URLs of the env respond")
+	checkTimeout := flag.Duration("check-timeout", 5*time.Second, "Time limit for each --check request")
+
+	// Subcommands (completion, ...) take over before the switch flags are parsed
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		if err := runSubcommand(os.Args[1], os.Args[2:]); err != nil {
+			exitWithError(os.Args[1], err)
+		}
+		return
+	}
 	flag.Parse()
 
 	// Interactive mode
@@ -61,66 +370,272 @@ func main() {
 		return
 	}
 
-	if *env == "" {
+	// Saved app settings fill in every flag that wasn't given explicitly
+	if err := flags.resolve(flag.CommandLine); err != nil {
+		exitWithError("switch", err)
+	}
+
+	if *flags.env == "" {
+		if jsonOutput() {
+			exitWithError("switch", withCode(codeUsage, fmt.Errorf("usage: envswitch --env <env> [flags] (--env flag is required)")))
+		}
 		fmt.Fprintln(os.Stderr, "Error: --env flag is required (or use -i for interactive mode)")
-		fmt.Fprintln(os.Stderr, "Usage: envswitch --env test [--config-dir ./configs] [--target ./path/to/file.js] [--format serverConfig|envJs] [--dist] [--js] [--dry-run]")
+		fmt.Fprintln(os.Stderr, "Usage: envswitch --env test [--app name] [--config-dir ./configs] [--target ./path/to/file.js] [--format serverConfig|envJs] [--template file] [--dist] [--js] [--dry-run] [--reveal] [--yes-i-mean-prod] [--pre-switch cmd] [--post-switch cmd] [--check] [--output json]")
 		fmt.Fprintln(os.Stderr, "       envswitch -i  (interactive mode)")
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "       envswitch show --env test [--app name] [--reveal]")
+		fmt.Fprintln(os.Stderr, "       envswitch watch --env test [--app name] [--debounce 300ms]")
+		fmt.Fprintln(os.Stderr, "       envswitch check test [--app name] [--timeout 5s]")
+		fmt.Fprintln(os.Stderr, "       envswitch mock serve [--env offline] [--from test] [--fixtures ./mocks]")
+		fmt.Fprintln(os.Stderr, "       envswitch proxy init|serve|switch|status|off [--app name] [--port 7700]")
+		fmt.Fprintln(os.Stderr, "       envswitch profile apply <name>")
+		fmt.Fprintln(os.Stderr, "       envswitch apps export [names...] > apps.json | apps import apps.json")
+		fmt.Fprintln(os.Stderr, "       envswitch git-guard install")
+		fmt.Fprintln(os.Stderr, "       envswitch workspace status|trust|untrust")
+		fmt.Fprintln(os.Stderr, "       envswitch log [--app name] [--env env] [--since 7d]")
+		fmt.Fprintln(os.Stderr, "       envswitch convert --from js --to json [--config-dir dir] [--dry-run]")
+		fmt.Fprintln(os.Stderr, "       envswitch completion bash|zsh|fish|powershell")
+		os.Exit(exitStatuses[codeUsage])
 	}
 
-	// Load config file (JSON or JS)
-	var configPath string
-	var config *Config
-	var err error
+	result := switchResult{Env: *flags.env, Target: *flags.targetFile, Format: *flags.format, Template: *flags.template, DryRun: *dryRun}
+	warnings := make([]string, 0)
 
-	if *useJS {
-		configPath = filepath.Join(*configDir, fmt.Sprintf("config.%s.js", *env))
-		config, err = LoadConfigFromJS(configPath)
-	} else {
-		configPath = filepath.Join(*configDir, fmt.Sprintf("config.%s.json", *env))
-		config, err = loadConfig(configPath)
+	// Proxy mode: the target already points at the proxy, so only the proxy switches
+	if port := flags.saved.ProxyPort; port != 0 {
+		result.ProxyPort = port
+		if *dryRun {
+			if jsonOutput() {
+				printJSON("switch", result, nil, nil)
+				return
+			}
+			fmt.Printf("Dry-run mode - %s is in proxy mode; the proxy on port %d would forward to: %s\n", *flags.app, port, *flags.env)
+			return
+		}
+		opts := flags.switchOptions()
+		opts.ConfirmProtected = *confirmProtected
+		status, err := switchAppProxy(opts, port)
+		if err == nil {
+			err = saveProxyEnv(*flags.app, status.Env)
+		}
+		if err != nil {
+			exitWithError("switch", err)
+		}
+		if jsonOutput() {
+			printJSON("switch", result, nil, nil)
+			return
+		}
+		fmt.Printf("✓ Switched to environment: %s (through the proxy on port %d, no files changed)\n", status.Env, port)
+		return
 	}
 
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error loading config %s: %v\n", configPath, err)
-		os.Exit(1)
+	opts := flags.switchOptions()
+	opts.IsDist = *isDist
+	opts.Hooks = hooks.config(flags.saved)
+	opts.ConfirmProtected = *confirmProtected
+	if jsonOutput() {
+		// Keep stdout for the JSON result
+		opts.Output = os.Stderr
+	}
+
+	// Dry-run mode: show diff and exit
+	if *dryRun {
+		plan, err := planSwitch(opts)
+		if err != nil {
+			exitWithError("switch", err)
+		}
+		secrets := flags.secrets(plan.Config)
+		if jsonOutput() {
+			result.fill(plan, secrets)
+			result.Diff = diffLines(plan.Original, plan.Result, secrets)
+			printJSON("switch", result, unmatchedRules(plan.Matches), nil)
+			return
+		}
+		fmt.Printf("Dry-run mode - showing changes for environment: %s\n", opts.Env)
+		if plan.Protected {
+			fmt.Printf("🛑 %s is a protected env: the switch needs --%s\n", opts.Env, protectedFlag)
+		}
+		fmt.Printf("Config: %s\n", plan.ConfigPath)
+		fmt.Printf("Target: %s\n\n", opts.TargetPath)
+		printDiff(plan.Original, plan.Result, secrets)
+		return
 	}
 
-	// Read target file
-	content, err := os.ReadFile(*targetFile)
+	plan, err := executeSwitch(opts)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error reading target file %s: %v\n", *targetFile, err)
-		os.Exit(1)
+		exitWithError("switch", err)
+	}
+	secrets := flags.secrets(plan.Config)
+	result.fill(plan, secrets)
+	warnings = append(warnings, unmatchedRules(plan.Matches)...)
+
+	if !jsonOutput() {
+		fmt.Printf("✓ Switched to environment: %s\n", opts.Env)
+		fmt.Printf("  Config: %s\n", plan.ConfigPath)
+		fmt.Printf("  Target: %s\n", opts.TargetPath)
+		if plan.Protected {
+			fmt.Printf("  🛑 %s is a protected env: requests from this app now reach it\n", opts.Env)
+		}
 	}
 
-	// Apply replacements based on format
-	var result string
-	switch *format {
-	case "envJs":
-		result = applyEnvJsReplacements(string(content), config, *isDist)
-	default: // "serverConfig"
-		result = applyReplacements(string(content), config, *isDist)
+	// Git guard: keep switched targets out of commits
+	if *defaultEnv == "" {
+		*defaultEnv = flags.saved.DefaultEnv
+	}
+	if *skipWorktree || flags.saved.SkipWorktree {
+		note, err := guardTarget(opts.TargetPath, opts.Env, *defaultEnv, plan.Result)
+		switch {
+		case err != nil && jsonOutput():
+			warnings = append(warnings, err.Error())
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "Warning: %v\n", err)
+		case note != "" && !jsonOutput():
+			fmt.Printf("  %s\n", note)
+		}
+	} else if isGitTracked(opts.TargetPath) && !isAtDefaultEnv(opts.Env, *defaultEnv, opts.TargetPath, plan.Result) {
+		note := "the target is tracked by git; add --skip-worktree to keep this switch out of commits"
+		if jsonOutput() {
+			warnings = append(warnings, note)
+		} else {
+			fmt.Printf("  Note: %s\n", note)
+		}
 	}
 
-	// Dry-run mode: show diff and exit
-	if *dryRun {
-		fmt.Printf("Dry-run mode - showing changes for environment: %s\n", *env)
-		fmt.Printf("Config: %s\n", configPath)
-		fmt.Printf("Target: %s\n\n", *targetFile)
-		printDiff(string(content), result)
-		return
+	var checkErr error
+	if *check {
+		results := checkEndpoints(&http.Client{Timeout: *checkTimeout}, configEndpoints(plan.Config))
+		checkErr = checkFailure(results)
+		if jsonOutput() {
+			result.Checks = checkReports(results, secrets)
+		} else {
+			fmt.Println()
+			printCheckResults(results, secrets)
+		}
+	}
+
+	if jsonOutput() {
+		checkErr = printJSON("switch", result, warnings, checkErr)
+	}
+	if checkErr != nil {
+		exitWithError("switch", checkErr)
+	}
+}
+
+// switchResult is the --output json result of a switch
+type switchResult struct {
+	Env          string        `json:"env"`
+	ConfigPath   string        `json:"configPath,omitempty"`
+	Target       string        `json:"target"`
+	Format       string        `json:"format"`
+	Template     string        `json:"template,omitempty"`
+	DryRun       bool          `json:"dryRun"`
+	Protected    bool          `json:"protected,omitempty"`
+	ProxyPort    int           `json:"proxyPort,omitempty"` // switched through the proxy, target untouched
+	Changed      bool          `json:"changed"`
+	ChangedLines int           `json:"changedLines"`
+	Rules        []ruleMatch   `json:"rules,omitempty"`
+	Diff         []diffLine    `json:"diff,omitempty"` // dry-run only, secrets masked
+	Checks       []checkReport `json:"checks,omitempty"`
+}
+
+// fill copies what a switch plan found into the result
+func (r *switchResult) fill(plan *switchPlan, secrets []string) {
+	r.ConfigPath = plan.ConfigPath
+	r.Protected = plan.Protected
+	r.Changed = plan.Result != plan.Original
+	r.ChangedLines = len(diffLines(plan.Original, plan.Result, secrets))
+	r.Rules = plan.Matches
+}
+
+// unmatchedRules lists a warning for every rule that matched nothing
+func unmatchedRules(matches []ruleMatch) []string {
+	warnings := make([]string, 0)
+	for _, m := range matches {
+		if m.Matches == 0 {
+			warnings = append(warnings, fmt.Sprintf("rule %s matched nothing in the target", m.Rule))
+		}
+	}
+	return warnings
+}
+
+// subcommandNames lists the user-facing subcommands (used by shell completion)
+var subcommandNames = []string{"show", "watch", "check", "mock", "proxy", "profile", "apps", "git-guard", "log", "convert", "workspace", "completion", "secrets"}
+
+// runSubcommand dispatches `envswitch <command> [args...]`
+func runSubcommand(name string, args []string) error {
+	switch name {
+	case "completion":
+		return runCompletion(args)
+	case "show":
+		return runShow(args)
+	case "watch":
+		return runWatch(args)
+	case "check":
+		return runCheck(args)
+	case "mock":
+		return runMock(args)
+	case "proxy":
+		return runProxy(args)
+	case "profile":
+		return runProfile(args)
+	case "apps":
+		return runApps(args)
+	case "git-guard":
+		return runGitGuard(args)
+	case "secrets":
+		return runSecrets(args)
+	case "log":
+		return runLog(args)
+	case "convert":
+		return runConvert(args)
+	case "workspace":
+		return runWorkspace(args)
+	case "__complete":
+		return runComplete(args)
+	default:
+		return withCode(codeUsage, fmt.Errorf("unknown command '%s' (available: %s)", name, strings.Join(subcommandNames, ", ")))
+	}
+}
+
+// parseInterspersed parses flags that may come before or after positional
+// arguments (`envswitch show test --reveal`) and returns the positional ones
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := make([]string, 0)
+	for {
+		if err := parseFlags(fs, args); err != nil {
+			return nil, withCode(codeUsage, err)
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
 	}
+}
 
-	// Write back to file
-	err = os.WriteFile(*targetFile, []byte(result), 0644)
+// loadCommandConfig loads an env config for a command, with the error codes
+// of a switch (config-missing, validation-failed)
+func loadCommandConfig(configPath, configType, keyFile string) (*Config, error) {
+	if _, err := os.Stat(configPath); os.IsNotExist(err) {
+		return nil, withCode(codeConfigMissing, fmt.Errorf("config file not found: %s", configPath))
+	}
+	config, err := loadEnvConfig(configPath, configType, keyFile)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Error writing target file %s: %v\n", *targetFile, err)
-		os.Exit(1)
+		return nil, withCode(codeValidationFailed, fmt.Errorf("loading config %s: %v", configPath, err))
+	}
+	return config, nil
+}
+
+// loadEnvConfig loads a config file and decrypts its enc:v1: secrets
+func loadEnvConfig(configPath, configType, keyFile string) (*Config, error) {
+	config, err := readConfigFile(configPath, configType)
+	if err != nil {
+		return nil, err
 	}
 
-	fmt.Printf("✓ Switched to environment: %s\n", *env)
-	fmt.Printf("  Config: %s\n", configPath)
-	fmt.Printf("  Target: %s\n", *targetFile)
+	if err := decryptConfig(config, keyFile); err != nil {
+		return nil, err
+	}
+	return config, nil
 }
 
 func loadConfig(path string) (*Config, error) {
@@ -137,117 +652,303 @@ func loadConfig(path string) (*Config, error) {
 	return &config, nil
 }
 
+// envJsReplacements are the envJs rules besides the urls object
+func envJsReplacements(config *Config, isDist bool) []Replacement {
+	return []Replacement{
+		{
+			// var recaptchaKey = "...";
+			Name:    "recaptchaKey",
+			Pattern: regexp.MustCompile(`(\bvar recaptchaKey\s*=\s*)(` + jsStringValue + `)`),
+			Value:   config.Google.Recaptcha,
+		},
+		{
+			// var isDist = true/false;
+			Name:    "isDist",
+			Pattern: regexp.MustCompile(`(\bvar isDist\s*=\s*)(true|false)\b`),
+			Value:   fmt.Sprint(isDist),
+			Literal: true,
+		},
+		{
+			// var walkMeUrl= "..." (no space before = in the original, and usually last)
+			Name:    "walkMeUrl",
+			Pattern: regexp.MustCompile(`(\bvar walkMeUrl\s*=\s*)(` + jsStringValue + `)`),
+			Value:   config.WalkmeUrl,
+		},
+	}
+}
+
 // applyEnvJsReplacements applies replacements for env.js format (var urls = {...}; var recaptchaKey = "..."; etc.)
 func applyEnvJsReplacements(content string, config *Config, isDist bool) string {
-	// Serialize the server/urls object to JSON
-	serverJSON, err := json.Marshal(config.Server)
-	if err != nil {
-		serverJSON = []byte(`{}`)
+	result := content
+
+	// Replace var urls = {...} - the tokenizer finds where the object ends
+	// (braces in strings and comments don't count). An object that never
+	// closes is left alone.
+	tokens, _ := tokenizeJS(result)
+	code := skipComments(tokens)
+	if open, close := findVarObject(code, "urls"); close >= 0 {
+		if updated, ok := replaceObjectValues(result, code, open, close, config.Server); ok {
+			// Same keys as the target: only the values change, in place
+			result = updated
+		} else {
+			object := renderURLsObject(result, code, open, close, config)
+			result = result[:code[open].Start] + object + result[code[close].End:]
+		}
 	}
 
-	result := content
+	// Simple replacements for the rest
+	for _, r := range envJsReplacements(config, isDist) {
+		result = r.apply(result)
+	}
 
-	// Replace var urls = {...}; - need to find matching braces
-	urlsPattern := regexp.MustCompile(`var urls\s*=\s*\{`)
-	if loc := urlsPattern.FindStringIndex(result); loc != nil {
-		// Find the matching closing brace
-		start := loc[1] - 1 // position of opening {
-		depth := 0
-		end := start
-		for i := start; i < len(result); i++ {
-			if result[i] == '{' {
-				depth++
-			} else if result[i] == '}' {
-				depth--
-				if depth == 0 {
-					end = i
-					break
-				}
+	return result
+}
+
+// replaceObjectValues rewrites the string values of the object literal
+// between the tokens open and close in place, keeping key order, quotes and
+// layout. It only applies when the object has exactly the keys of server,
+// all with string values; otherwise it returns false.
+func replaceObjectValues(content string, tokens []jsToken, open, close int, server interface{}) (string, bool) {
+	values, ok := server.(map[string]interface{})
+	if !ok {
+		return "", false
+	}
+	props, ok := objectProperties(tokens, open, close)
+	if !ok || len(props) != len(values) {
+		return "", false
+	}
+
+	seen := make(map[string]bool)
+	for _, prop := range props {
+		_, isString := values[prop.Key].(string)
+		if !isString || seen[prop.Key] || len(prop.Value) != 1 || prop.Value[0].Kind != jsString {
+			return "", false
+		}
+		seen[prop.Key] = true
+	}
+
+	// From the end, so earlier offsets stay valid
+	for i := len(props) - 1; i >= 0; i-- {
+		token := props[i].Value[0]
+		content = content[:token.Start] + quoteJS(values[props[i].Key].(string), token.Text[0]) + content[token.End:]
+	}
+	return content, true
+}
+
+// objectStyle is how an object literal in a target is written
+type objectStyle struct {
+	KeyQuote    byte   // 0 for bare identifier keys
+	ValueQuote  byte   // quote of string values
+	Colon       string // between key and value, e.g. ": "
+	Multiline   bool
+	Newline     string // line ending (multi-line): "\n" or "\r\n"
+	Indent      string // before each property (multi-line)
+	CloseIndent string // before the closing } (multi-line)
+	Comma       string // between properties (single-line), e.g. ", "
+	Pad         string // after { and before } (single-line)
+	Trailing    bool   // comma after the last property
+}
+
+// compactStyle writes objects the way encoding/json does: {"a":"b","c":"d"}
+var compactStyle = objectStyle{KeyQuote: '"', ValueQuote: '"', Colon: ":", Comma: ","}
+
+// detectObjectStyle reads the style of the object literal between the tokens
+// open and close, falling back to compactStyle for what it can't tell
+func detectObjectStyle(content string, tokens []jsToken, open, close int) objectStyle {
+	style := compactStyle
+	props, ok := objectProperties(tokens, open, close)
+	if !ok || len(props) == 0 {
+		return style
+	}
+	first := props[0]
+	key := tokens[indexOfToken(tokens, first.Value[0])-2]
+
+	style.KeyQuote = 0
+	if key.Kind == jsString {
+		style.KeyQuote = key.Text[0]
+	}
+	for _, prop := range props {
+		if prop.Value[0].Kind == jsString {
+			style.ValueQuote = prop.Value[0].Text[0]
+			break
+		}
+	}
+	style.Colon = content[key.End:first.Value[0].Start]
+	style.Trailing = tokens[close-1].is(",")
+
+	body := content[tokens[open].End:tokens[close].Start]
+	if strings.Contains(body, "\n") {
+		style.Multiline = true
+		style.Newline = "\n"
+		if strings.Contains(body, "\r\n") {
+			style.Newline = "\r\n"
+		}
+		style.Indent = lineIndent(content, key.Start)
+		style.CloseIndent = lineIndent(content, tokens[close].Start)
+	} else {
+		style.Pad = content[tokens[open].End:key.Start]
+		if len(props) > 1 {
+			last := first.Value[len(first.Value)-1]
+			next := tokens[indexOfToken(tokens, last)+2]
+			style.Comma = content[last.End:next.Start]
+		}
+	}
+	return style
+}
+
+// indexOfToken finds a token by its offset
+func indexOfToken(tokens []jsToken, token jsToken) int {
+	return sort.Search(len(tokens), func(i int) bool { return tokens[i].Start >= token.Start })
+}
+
+// lineIndent returns the whitespace between the start of the line and offset,
+// or "" when there is other text before it
+func lineIndent(content string, offset int) string {
+	start := strings.LastIndexByte(content[:offset], '\n') + 1
+	indent := content[start:offset]
+	if strings.TrimLeft(indent, " \t") != "" {
+		return ""
+	}
+	return indent
+}
+
+// renderURLsObject writes the server object of a config in the style of the
+// target's urls object, with the target's keys first (in its order) followed
+// by new keys in config order. A server that isn't an object is written as JSON.
+func renderURLsObject(content string, tokens []jsToken, open, close int, config *Config) string {
+	values, ok := config.Server.(map[string]interface{})
+	if !ok {
+		return jsonValue(config.Server)
+	}
+	style := detectObjectStyle(content, tokens, open, close)
+
+	keys := make([]string, 0, len(values))
+	seen := make(map[string]bool)
+	if props, ok := objectProperties(tokens, open, close); ok {
+		for _, prop := range props {
+			if _, exists := values[prop.Key]; exists && !seen[prop.Key] {
+				keys = append(keys, prop.Key)
+				seen[prop.Key] = true
 			}
 		}
-		// Check for trailing semicolon
-		if end+1 < len(result) && result[end+1] == ';' {
-			end++
+	}
+	for _, key := range config.orderedServerKeys() {
+		if !seen[key] {
+			keys = append(keys, key)
 		}
-		// Replace
-		result = result[:loc[0]] + fmt.Sprintf(`var urls = %s;`, string(serverJSON)) + result[end+1:]
 	}
 
-	// Simple replacements for the rest
-	replacements := []Replacement{
-		{
-			// var recaptchaKey = "...";
-			Pattern:     regexp.MustCompile(`var recaptchaKey\s*=\s*"[^"]*";?`),
-			Replacement: fmt.Sprintf(`var recaptchaKey = "%s";`, config.Google.Recaptcha),
-		},
-		{
-			// var isDist = true/false;
-			Pattern:     regexp.MustCompile(`var isDist\s*=\s*(true|false);?`),
-			Replacement: fmt.Sprintf(`var isDist = %t;`, isDist),
-		},
-		{
-			// var walkMeUrl= "..."; (note: no space before = in original)
-			Pattern:     regexp.MustCompile(`var walkMeUrl\s*=\s*"[^"]*"$`),
-			Replacement: fmt.Sprintf(`var walkMeUrl= "%s"`, config.WalkmeUrl),
-		},
+	items := make([]string, len(keys))
+	for i, key := range keys {
+		name := key
+		if style.KeyQuote != 0 || !isJSIdentifier(key) {
+			quote := style.KeyQuote
+			if quote == 0 {
+				quote = style.ValueQuote
+			}
+			name = quoteJS(key, quote)
+		}
+		value := jsonValue(values[key])
+		if s, isString := values[key].(string); isString {
+			value = quoteJS(s, style.ValueQuote)
+		}
+		items[i] = name + style.Colon + value
 	}
 
-	for _, r := range replacements {
-		result = r.Pattern.ReplaceAllString(result, r.Replacement)
+	trailing := ""
+	if style.Trailing && len(items) > 0 {
+		trailing = ","
+	}
+	if len(items) == 0 {
+		return "{}"
 	}
+	if style.Multiline {
+		nl := style.Newline
+		return "{" + nl + style.Indent + strings.Join(items, ","+nl+style.Indent) + trailing + nl + style.CloseIndent + "}"
+	}
+	return "{" + style.Pad + strings.Join(items, style.Comma) + trailing + style.Pad + "}"
+}
 
-	return result
+// isJSIdentifier reports whether a key can be written without quotes
+func isJSIdentifier(key string) bool {
+	if key == "" || key[0] >= '0' && key[0] <= '9' {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if !isJSIdentChar(key[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// jsonValue serializes a value as JSON, leaving & < > as they are
+func jsonValue(value interface{}) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "{}"
+	}
+	return strings.TrimRight(buf.String(), "\n")
 }
 
 // applyReplacements applies all environment-specific replacements to content (serverConfig format)
 func applyReplacements(content string, config *Config, isDist bool) string {
+	result := content
+	for _, r := range serverConfigReplacements(config, isDist) {
+		result = r.apply(result)
+	}
+
+	return result
+}
+
+// serverConfigReplacements are the rules of the serverConfig format
+func serverConfigReplacements(config *Config, isDist bool) []Replacement {
 	// Handle Server as string (for serverConfig format)
 	serverStr := ""
 	if s, ok := config.Server.(string); ok {
 		serverStr = s
 	}
 
-	replacements := []Replacement{
+	return []Replacement{
 		{
-			Pattern:     regexp.MustCompile(`baseUrl:\s*['"][^'"]*['"],?`),
-			Replacement: fmt.Sprintf(`baseUrl: "%s",`, serverStr),
+			Name:    "baseUrl",
+			Pattern: regexp.MustCompile(`(\bbaseUrl:\s*)(` + jsStringValue + `)`),
+			Value:   serverStr,
 		},
 		{
-			Pattern:     regexp.MustCompile(`questUrl:\s*['"][^'"]*['"],?`),
-			Replacement: fmt.Sprintf(`questUrl: "%s",`, config.QuestServer),
+			Name:    "questUrl",
+			Pattern: regexp.MustCompile(`(\bquestUrl:\s*)(` + jsStringValue + `)`),
+			Value:   config.QuestServer,
 		},
 		{
-			Pattern:     regexp.MustCompile(`questFront:\s*['"][^'"]*['"],?`),
-			Replacement: fmt.Sprintf(`questFront: "%s",`, config.QuestFront),
+			Name:    "questFront",
+			Pattern: regexp.MustCompile(`(\bquestFront:\s*)(` + jsStringValue + `)`),
+			Value:   config.QuestFront,
 		},
 		{
-			Pattern:     regexp.MustCompile(`isDist:\s*(true|false),?`),
-			Replacement: fmt.Sprintf(`isDist: %t,`, isDist),
+			Name:    "isDist",
+			Pattern: regexp.MustCompile(`(\bisDist:\s*)(true|false)\b`),
+			Value:   fmt.Sprint(isDist),
+			Literal: true,
 		},
 		{
-			Pattern:     regexp.MustCompile(`recaptchaApiKey:\s*['"][^'"]*['"],?`),
-			Replacement: fmt.Sprintf(`recaptchaApiKey: "%s",`, config.Google.Recaptcha),
+			Name:    "recaptchaApiKey",
+			Pattern: regexp.MustCompile(`(\brecaptchaApiKey:\s*)(` + jsStringValue + `)`),
+			Value:   config.Google.Recaptcha,
 		},
 	}
-
-	result := content
-	for _, r := range replacements {
-		result = r.Pattern.ReplaceAllString(result, r.Replacement)
-	}
-
-	return result
 }
 
-// Helper to print what will be replaced (dry-run mode)
-func printDiff(original, modified string) {
-	origLines := strings.Split(original, "\n")
-	modLines := strings.Split(modified, "\n")
-
-	for i := 0; i < len(origLines) && i < len(modLines); i++ {
-		if origLines[i] != modLines[i] {
-			fmt.Printf("- %s\n", origLines[i])
-			fmt.Printf("+ %s\n", modLines[i])
+// Helper to print what will be replaced (dry-run mode). Secret values are masked.
+func printDiff(original, modified string, secrets []string) {
+	for _, line := range diffLines(original, modified, secrets) {
+		if line.Old != nil {
+			fmt.Printf("- %s\n", *line.Old)
+		}
+		if line.New != nil {
+			fmt.Printf("+ %s\n", *line.New)
 		}
 	}
 }
-
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// mockRoute is a local stand-in for one URL field of a config
+type mockRoute struct {
+	Key   string `json:"key"`   // fixture directory name: the urls key, "server", "questServer"...
+	Field string `json:"field"` // the config field, as listed by configEndpoints
+	Port  int    `json:"port"`
+}
+
+// URL is the local address the generated config points the field at
+func (r mockRoute) URL() string {
+	return fmt.Sprintf("http://localhost:%d", r.Port)
+}
+
+// mockRoutes gives every URL field of the config its own port, counting up from basePort
+func mockRoutes(config *Config, basePort int) []mockRoute {
+	routes := make([]mockRoute, 0)
+	for i, e := range configEndpoints(config) {
+		routes = append(routes, mockRoute{
+			Key:   strings.TrimPrefix(e.Name, "server."),
+			Field: e.Name,
+			Port:  basePort + i,
+		})
+	}
+	return routes
+}
+
+// withLocalURLs returns a copy of config where every field in local points at
+// the local address given for it
+func withLocalURLs(config *Config, local map[string]string, keepPath bool) *Config {
+	copied := *config
+	if server, ok := config.Server.(map[string]interface{}); ok {
+		values := make(map[string]interface{}, len(server))
+		for key, value := range server {
+			values[key] = value
+		}
+		copied.Server = values
+	}
+
+	mapConfigStrings(&copied, func(name, value string) (string, error) {
+		base, ok := local[name]
+		if !ok {
+			return value, nil
+		}
+		if u, err := url.Parse(value); err == nil && keepPath {
+			return base + strings.TrimSuffix(u.EscapedPath(), "/"), nil
+		}
+		return base, nil
+	})
+	return &copied
+}
+
+// offlineConfig returns a copy of config with every routed URL pointing at its
+// mock. Paths are kept, so https://cdn.example.com/w.js becomes
+// http://localhost:8797/w.js and fixtures mirror the real URLs.
+func offlineConfig(config *Config, routes []mockRoute) *Config {
+	local := make(map[string]string, len(routes))
+	for _, route := range routes {
+		local[route.Field] = route.URL()
+	}
+	offline := withLocalURLs(config, local, true)
+	offline.Protected = false // it only reaches the mocks
+	return offline
+}
+
+// marshalConfig writes a config as indented JSON, keeping the server key order
+func marshalConfig(config *Config) ([]byte, error) {
+	out := *config
+	if server, ok := config.Server.(map[string]interface{}); ok {
+		var buf bytes.Buffer
+		buf.WriteString("{")
+		for i, key := range config.orderedServerKeys() {
+			if i > 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString(jsonValue(key) + ":" + jsonValue(server[key]))
+		}
+		buf.WriteString("}")
+		out.Server = json.RawMessage(buf.Bytes())
+	}
+	return json.MarshalIndent(&out, "", "  ")
+}
+
+// offlineConfigPath returns the file the generated config goes to: the env's
+// JSON or JS config (JSON when there is none yet). YAML and TOML aren't written.
+func offlineConfigPath(configDir, env, configType string) (string, error) {
+	path := envConfigPath(configDir, env, configType)
+	switch filepath.Ext(path) {
+	case ".json", ".js", ".mjs", ".cjs":
+		return path, nil
+	}
+	if configType == "yaml" || configType == "toml" {
+		return "", withCode(codeUsage, fmt.Errorf("mock serve writes JSON or JS configs; use --config-type auto, json or js"))
+	}
+	return envConfigPath(configDir, env, "json"), nil
+}
+
+// mockConfigHeader starts the JS configs mock serve writes
+const mockConfigHeader = "// Generated by `envswitch mock serve`; it is rewritten every time the mock starts\n"
+
+// mockMarkerPath is the file next to a generated JSON config that marks it as
+// generated (JSON has no comments)
+func mockMarkerPath(path string) string {
+	return filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".envswitch-mock")
+}
+
+// checkOfflineConfig refuses to replace a config that an earlier mock run
+// didn't write, unless force
+func checkOfflineConfig(path string, force bool) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) || force {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	generated := strings.HasPrefix(string(data), mockConfigHeader)
+	if filepath.Ext(path) == ".json" {
+		_, err := os.Stat(mockMarkerPath(path))
+		generated = err == nil
+	}
+	if !generated {
+		return fmt.Errorf("%s exists and wasn't written by mock serve; pick another --env or pass --force to replace it", path)
+	}
+	return nil
+}
+
+// writeOfflineConfig writes the generated config as JSON (with its marker
+// file), as module.exports for .js/.cjs or as export default for .mjs
+func writeOfflineConfig(path string, config *Config) error {
+	data, err := marshalConfig(config)
+	if err != nil {
+		return err
+	}
+	switch filepath.Ext(path) {
+	case ".js", ".cjs":
+		data = []byte(mockConfigHeader + "module.exports = " + string(data) + ";\n")
+	case ".mjs":
+		data = []byte(mockConfigHeader + "export default " + string(data) + ";\n")
+	default:
+		data = append(data, '\n')
+		marker := "Marks " + filepath.Base(path) + " as generated by `envswitch mock serve`, which may rewrite it\n"
+		if err := os.WriteFile(mockMarkerPath(path), []byte(marker), 0644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// fixturePath maps a request path to a file under dir: the exact file,
+// the path with .json added, or its index.json
+func fixturePath(dir, requestPath string) (string, bool) {
+	clean := filepath.FromSlash(path.Clean("/" + requestPath))
+	base := filepath.Join(dir, clean)
+	for _, candidate := range []string{base, base + ".json", filepath.Join(base, "index.json")} {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// statusRecorder remembers the status code a handler wrote
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// fixtureHandler serves the fixtures of one route from dir. CORS is open so
+// the app can call it from its own dev server port.
+func fixtureHandler(key, dir string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			fmt.Fprintf(logOutput(), "· %s %-12s %s %s → %d\n", time.Now().Format("15:04:05"), key, r.Method, r.URL.Path, rec.status)
+		}()
+
+		header := w.Header()
+		header.Set("Access-Control-Allow-Origin", "*")
+		header.Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		header.Set("Access-Control-Allow-Headers", "*")
+		if r.Method == http.MethodOptions {
+			rec.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		file, ok := fixturePath(dir, r.URL.Path)
+		if !ok {
+			header.Set("Content-Type", "application/json")
+			rec.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(rec).Encode(map[string]string{
+				"error":   "no fixture",
+				"fixture": filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path))) + ".json",
+			})
+			return
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			http.Error(rec, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if strings.HasSuffix(file, ".json") {
+			header.Set("Content-Type", "application/json")
+		}
+		rec.Write(data)
+	})
+}
+
+// mockServeResult is the --output json line `mock serve` prints once it listens
+type mockServeResult struct {
+	Env        string      `json:"env"`
+	From       string      `json:"from"`
+	ConfigPath string      `json:"configPath"`
+	Fixtures   string      `json:"fixtures"`
+	Routes     []mockRoute `json:"routes"`
+}
+
+// runMock implements `envswitch mock serve`
+func runMock(args []string) error {
+	if len(args) == 0 || args[0] != "serve" {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch mock serve [--env offline] [--from test] [--fixtures ./mocks] [--port 8790]"))
+	}
+
+	fs := flag.NewFlagSet("mock serve", flag.ContinueOnError)
+	flags := addEnvFlags(fs)
+	from := fs.String("from", "test", "Env whose config is copied, with its URLs pointed at the mocks")
+	fixtures := fs.String("fixtures", "./mocks", "Directory with one folder of fixtures per URL key (mocks/quest/api/users.json)")
+	port := fs.Int("port", 8790, "Port of the first mock; each URL key gets the next one")
+	force := fs.Bool("force", false, "Replace a config.<env> file that mock serve didn't write")
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if *flags.env == "" && len(positional) > 0 {
+		*flags.env = positional[0]
+	}
+	if *flags.env == "" {
+		*flags.env = "offline"
+	}
+	if err := flags.resolve(fs); err != nil {
+		return err
+	}
+	if *flags.env == *from {
+		return fmt.Errorf("--env and --from are both '%s'; the mock config would overwrite its source", *from)
+	}
+
+	// Read the source without decrypting it, so enc:v1: secrets stay encrypted in the copy
+	sourcePath := envConfigPath(*flags.configDir, *from, flags.configTypeValue())
+	source, err := readConfigFile(sourcePath, flags.configTypeValue())
+	if err != nil {
+		return fmt.Errorf("loading config %s: %v", sourcePath, err)
+	}
+	routes := mockRoutes(source, *port)
+	if len(routes) == 0 {
+		return fmt.Errorf("%s has no http(s) URLs to mock", sourcePath)
+	}
+
+	offlinePath, err := offlineConfigPath(*flags.configDir, *flags.env, flags.configTypeValue())
+	if err != nil {
+		return err
+	}
+	if err := checkOfflineConfig(offlinePath, *force); err != nil {
+		return err
+	}
+
+	// Listen on every port first, so a busy port fails before anything is written
+	listeners := make([]net.Listener, 0, len(routes))
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+	for _, route := range routes {
+		l, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", route.Port))
+		if err != nil {
+			return fmt.Errorf("mock for %s: %v", route.Key, err)
+		}
+		listeners = append(listeners, l)
+	}
+
+	if err := writeOfflineConfig(offlinePath, offlineConfig(source, routes)); err != nil {
+		return fmt.Errorf("writing %s: %v", offlinePath, err)
+	}
+
+	if jsonOutput() {
+		printJSON("mock", mockServeResult{*flags.env, *from, offlinePath, *fixtures, routes}, nil, nil)
+	} else {
+		fmt.Printf("🧪 Mocking environment: %s (from %s)\n", *flags.env, *from)
+		fmt.Printf("   Config: %s\n", offlinePath)
+		fmt.Printf("   Fixtures: %s\n\n", *fixtures)
+		for _, route := range routes {
+			fmt.Printf("   %-14s %s  ← %s\n", route.Key, route.URL(), filepath.Join(*fixtures, route.Key))
+		}
+		fmt.Printf("\n   Switch the app with --env %s. Press Ctrl+C to stop\n", *flags.env)
+	}
+
+	servers := make([]*http.Server, len(routes))
+	errs := make(chan error, len(routes))
+	for i, route := range routes {
+		servers[i] = &http.Server{Handler: fixtureHandler(route.Key, filepath.Join(*fixtures, route.Key))}
+		go func(s *http.Server, l net.Listener) {
+			errs <- s.Serve(l)
+		}(servers[i], listeners[i])
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	var serveErr error
+	select {
+	case <-interrupt:
+		fmt.Fprintln(logOutput(), "\n👋 Stopped the mocks")
+	case err := <-errs:
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr = err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, s := range servers {
+		s.Shutdown(ctx)
+	}
+	return serveErr
+}
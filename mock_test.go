@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOfflineConfig(t *testing.T) {
+	source := &Config{
+		Server:      map[string]interface{}{"vault": "https://v", "quest": "https://q"},
+		QuestServer: "https://qs/api/v2/",
+		QuestFront:  "https://front",
+		Google:      GoogleConf{Recaptcha: "enc:v1:abc"},
+		serverKeys:  []string{"vault", "quest"},
+	}
+	routes := mockRoutes(source, 9000)
+	want := []mockRoute{
+		{"vault", "server.vault", 9000},
+		{"quest", "server.quest", 9001},
+		{"questServer", "questServer", 9002},
+	}
+	if len(routes) != len(want) {
+		t.Fatalf("routes = %v, want %v", routes, want)
+	}
+	for i := range want {
+		if routes[i] != want[i] {
+			t.Errorf("route %d = %v, want %v", i, routes[i], want[i])
+		}
+	}
+
+	offline := offlineConfig(source, routes)
+	if source.Server.(map[string]interface{})["quest"] != "https://q" {
+		t.Error("offlineConfig changed the source config")
+	}
+
+	dir := t.TempDir()
+	for _, ext := range []string{".json", ".js", ".mjs"} {
+		path := filepath.Join(dir, "config.offline"+ext)
+		if err := writeOfflineConfig(path, offline); err != nil {
+			t.Fatal(err)
+		}
+		back, err := readConfigFile(path, configTypeAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := back.Server.(map[string]interface{})
+		if server["quest"] != "http://localhost:9001" || back.QuestServer != "http://localhost:9002/api/v2" {
+			t.Errorf("%s: URLs not local: %v %s", path, server, back.QuestServer)
+		}
+		if back.QuestFront != "https://front" || back.Google.Recaptcha != "enc:v1:abc" {
+			t.Errorf("%s: other values changed: %s %s", path, back.QuestFront, back.Google.Recaptcha)
+		}
+		if got := strings.Join(back.orderedServerKeys(), ","); got != "vault,quest" {
+			t.Errorf("%s: server keys = %s, want vault,quest", path, got)
+		}
+	}
+}
+
+func TestFixtureHandler(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "quest")
+	files := map[string]string{
+		"api/users.json":        `[{"id":1}]`,
+		"api/orders/index.json": `{"orders":[]}`,
+		"health":                "ok",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(root, "outside.json"), []byte("secret"), 0644)
+
+	server := httptest.NewServer(fixtureHandler("quest", dir))
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/api/users", 200, `[{"id":1}]`},
+		{"POST", "/api/users.json", 200, `[{"id":1}]`},
+		{"GET", "/api/orders", 200, `{"orders":[]}`},
+		{"GET", "/health", 200, "ok"},
+		{"GET", "/api/missing", 404, `"error":"no fixture"`},
+		{"GET", "/../outside", 404, `"error":"no fixture"`},
+		{"OPTIONS", "/api/users", 204, ""},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(tt.method, server.URL+tt.path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || !strings.Contains(string(body), tt.body) {
+			t.Errorf("%s %s = %d %s, want %d %s", tt.method, tt.path, resp.StatusCode, body, tt.status, tt.body)
+		}
+		if resp.Header.Get("Access-Control-Allow-Origin") != "*" {
+			t.Errorf("%s %s: no CORS header", tt.method, tt.path)
+		}
+	}
+}
+
+// mock serve only replaces the configs it wrote itself, unless forced
+func TestCheckOfflineConfig(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{QuestServer: "http://localhost:9000"}
+	for _, ext := range []string{".json", ".js", ".mjs"} {
+		path := filepath.Join(dir, "config.offline"+ext)
+		if err := checkOfflineConfig(path, false); err != nil {
+			t.Errorf("%s: missing file refused: %v", ext, err)
+		}
+
+		os.WriteFile(path, []byte("module.exports = {questServer: 'https://mine'};\n"), 0644)
+		if err := checkOfflineConfig(path, false); err == nil || !strings.Contains(err.Error(), "--force") {
+			t.Errorf("%s: hand-written config: err = %v", ext, err)
+		}
+		if err := checkOfflineConfig(path, true); err != nil {
+			t.Errorf("%s: --force refused: %v", ext, err)
+		}
+
+		if err := writeOfflineConfig(path, config); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkOfflineConfig(path, false); err != nil {
+			t.Errorf("%s: generated config refused: %v", ext, err)
+		}
+	}
+
+	// The marker only vouches for the file it sits next to
+	os.WriteFile(filepath.Join(dir, "config.local.json"), []byte(`{"questServer": "https://mine"}`), 0644)
+	if err := checkOfflineConfig(filepath.Join(dir, "config.local.json"), false); err == nil {
+		t.Error("config.local.json accepted without a marker")
+	}
+	if envs := listEnvs(dir); strings.Join(envs, ",") != "local,offline" {
+		t.Errorf("envs = %v: the marker shows up as an env", envs)
+	}
+}
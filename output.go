@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Output formats of --output
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// outputFormat is set by the --output flag every command has
+var outputFormat = outputText
+
+// addOutputFlag registers --output on a flag set
+func addOutputFlag(fs *flag.FlagSet) {
+	fs.Var(outputValue{}, "output", "Output format: text, or json for scripts (one JSON document per command)")
+}
+
+// outputValue sets outputFormat, refusing formats other than text and json
+type outputValue struct{}
+
+func (outputValue) String() string { return outputFormat }
+
+func (outputValue) Set(value string) error {
+	if value != outputText && value != outputJSON {
+		return fmt.Errorf("unknown output format '%s' (use %s or %s)", value, outputText, outputJSON)
+	}
+	outputFormat = value
+	return nil
+}
+
+// jsonOutput reports whether results should be printed as JSON
+func jsonOutput() bool {
+	return outputFormat == outputJSON
+}
+
+// logOutput is where progress lines of long-running commands go: stdout, or
+// stderr with --output json so stdout only has JSON
+func logOutput() io.Writer {
+	if jsonOutput() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// Stable error codes, reported by --output json and mapped to exit statuses
+const (
+	codeError            = "error"
+	codeUsage            = "usage"
+	codeConfigMissing    = "config-missing"
+	codeTargetMissing    = "target-missing"
+	codeValidationFailed = "validation-failed"
+	codeNoMatch          = "no-match"
+	codeHookFailed       = "hook-failed"
+	codeEndpointDown     = "endpoint-down"
+	codeProtectedEnv     = "protected-env"
+)
+
+// exitStatuses maps every error code to the exit status of the process
+var exitStatuses = map[string]int{
+	codeError:            1,
+	codeUsage:            2,
+	codeConfigMissing:    3,
+	codeTargetMissing:    4,
+	codeValidationFailed: 5,
+	codeNoMatch:          6,
+	codeHookFailed:       7,
+	codeEndpointDown:     8,
+	codeProtectedEnv:     9,
+}
+
+// codedError is an error with a stable code for scripts
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withCode attaches an error code to err (nil stays nil)
+func withCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code, err}
+}
+
+// errorCode returns the code of err: its own, or "error"
+func errorCode(err error) string {
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+	return codeError
+}
+
+// jsonResult is the document a command prints with --output json
+type jsonResult struct {
+	OK       bool        `json:"ok"`
+	Command  string      `json:"command"`
+	Result   interface{} `json:"result,omitempty"`
+	Warnings []string    `json:"warnings,omitempty"`
+	Error    *jsonError  `json:"error,omitempty"`
+}
+
+type jsonError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// printedError is an error that was already reported in a JSON result
+type printedError struct{ error }
+
+func (e printedError) Unwrap() error { return e.error }
+
+// printJSON prints the result of a command as one line of JSON. A non-nil err
+// is reported in it and returned, so the command still fails but main
+// doesn't report it a second time.
+func printJSON(command string, result interface{}, warnings []string, err error) error {
+	out := jsonResult{OK: err == nil, Command: command, Result: result, Warnings: warnings}
+	if err != nil {
+		out.Error = &jsonError{Code: errorCode(err), Message: err.Error()}
+	}
+	data, marshalErr := json.Marshal(out)
+	if marshalErr != nil {
+		return marshalErr
+	}
+	fmt.Println(string(data))
+	if err != nil {
+		return printedError{err}
+	}
+	return nil
+}
+
+// exitWithError reports a failed command and exits with the status of its code
+func exitWithError(command string, err error) {
+	var printed printedError
+	if !errors.As(err, &printed) {
+		if jsonOutput() {
+			printJSON(command, nil, nil, err)
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+	}
+	os.Exit(exitStatuses[errorCode(err)])
+}
+
+// messageResult is the JSON result of commands that only report what they did
+type messageResult struct {
+	Message string `json:"message"`
+}
+
+// printDone prints the confirmation of a simple command (text or JSON)
+func printDone(command, message string, details ...string) error {
+	if jsonOutput() {
+		return printJSON(command, messageResult{message}, nil, nil)
+	}
+	fmt.Printf("✓ %s\n", message)
+	for _, line := range details {
+		fmt.Printf("  %s\n", line)
+	}
+	return nil
+}
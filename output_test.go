@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("boom"), codeError},
+		{fmt.Errorf("usage: envswitch show --env <name>"), codeError},
+		{withCode(codeUsage, fmt.Errorf("usage: envswitch show --env <name>")), codeUsage},
+		{withCode(codeNoMatch, fmt.Errorf("no rule matched")), codeNoMatch},
+		{fmt.Errorf("wrapped: %w", withCode(codeHookFailed, errors.New("exit 1"))), codeHookFailed},
+		{printedError{withCode(codeEndpointDown, errors.New("down"))}, codeEndpointDown},
+		{protectedError("prod"), codeProtectedEnv},
+	}
+	for _, tt := range tests {
+		if got := errorCode(tt.err); got != tt.want {
+			t.Errorf("errorCode(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+		if _, ok := exitStatuses[tt.want]; !ok {
+			t.Errorf("no exit status for %s", tt.want)
+		}
+	}
+}
+
+func TestUsageErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	t.Cleanup(func() { outputFormat = outputText })
+
+	for _, args := range [][]string{
+		{"show"},
+		{"show", "test", "--output", "yaml"},
+		{"profile"},
+		{"profile", "apply"},
+		{"workspace", "status", "--output", "JSON"},
+		{"secrets", "keygen", "--nope"},
+		{"nope"},
+	} {
+		if err := runSubcommand(args[0], args[1:]); errorCode(err) != codeUsage {
+			t.Errorf("%v: err = %v, want code %s", args, err, codeUsage)
+		}
+	}
+	if outputFormat != outputText {
+		t.Errorf("outputFormat = %q after invalid values", outputFormat)
+	}
+}
+
+func TestPlanSwitchErrorCodes(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "serverConfig.js")
+	os.WriteFile(filepath.Join(dir, "config.test.json"), []byte(`{"server": "https://test.example.com"}`), 0644)
+
+	tests := []struct {
+		name    string
+		env     string
+		target  string
+		content string
+		want    string
+	}{
+		{"missing config", "nope", target, "", codeConfigMissing},
+		{"missing target", "test", filepath.Join(dir, "missing.js"), "", codeTargetMissing},
+		{"no rule matched", "test", target, "module.exports = {};\n", codeNoMatch},
+	}
+	for _, tt := range tests {
+		if tt.content != "" {
+			os.WriteFile(tt.target, []byte(tt.content), 0644)
+		}
+		_, err := planSwitch(switchOptions{ConfigDir: dir, TargetPath: tt.target, Env: tt.env})
+		if err == nil {
+			t.Errorf("%s: no error, want code %s", tt.name, tt.want)
+		} else if got := errorCode(err); got != tt.want {
+			t.Errorf("%s: err = %v (%s), want code %s", tt.name, err, got, tt.want)
+		}
+	}
+}
+
+// captureStdout runs fn and returns what it printed on stdout
+func captureStdout(t *testing.T, fn func() error) (string, error) {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	out := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		out <- data
+	}()
+	fnErr := fn()
+	w.Close()
+	return string(<-out), fnErr
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// profileResult is the outcome of switching one app of a profile
+type profileResult struct {
+	App    string
+	Env    string
+	Target string
+	Output string // hook output
+	Err    error
+}
+
+// profileNames returns the sorted profile names
+func profileNames(config PersistentConfig) []string {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// findApp looks an app up by exact name, then case-insensitively
+// (so a profile can say "backoffice" for an app saved as "Backoffice")
+func findApp(config PersistentConfig, name string) (string, AppConfig, bool) {
+	if app, exists := config.Apps[name]; exists {
+		return name, app, true
+	}
+	for appName, app := range config.Apps {
+		if strings.EqualFold(appName, name) {
+			return appName, app, true
+		}
+	}
+	return "", AppConfig{}, false
+}
+
+// applyProfile switches every app of a profile in parallel and records the
+// new last-used envs. Results are sorted by app name. Apps whose env is
+// protected are only switched with confirmProtected.
+func applyProfile(config PersistentConfig, profile string, dryRun, confirmProtected bool) ([]profileResult, error) {
+	apps, exists := config.Profiles[profile]
+	if !exists {
+		return nil, fmt.Errorf("profile '%s' not found", profile)
+	}
+
+	// Names match apps case-insensitively, so one app can be listed twice
+	// ("backoffice" and "Backoffice"): switch it once, and never to two envs
+	results := make([]profileResult, 0, len(apps))
+	names := make([]string, 0, len(apps))
+	for name := range apps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	listed := make(map[string]string)
+	for _, name := range names {
+		env := apps[name]
+		if appName, _, found := findApp(config, name); found {
+			if other, seen := listed[appName]; seen {
+				if apps[other] != env {
+					return nil, fmt.Errorf("profile '%s' lists '%s' twice, as '%s' (%s) and '%s' (%s)", profile, appName, other, apps[other], name, env)
+				}
+				continue
+			}
+			listed[appName] = name
+		}
+		results = append(results, profileResult{App: name, Env: env})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].App < results[j].App })
+	if err := checkProfileTargets(config, profile, results); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	for i := range results {
+		appName, app, found := findApp(config, results[i].App)
+		if !found {
+			results[i].Err = fmt.Errorf("app not found")
+			continue
+		}
+		results[i].App = appName
+		results[i].Target = app.TargetPath
+
+		wg.Add(1)
+		go func(r *profileResult, app AppConfig) {
+			defer wg.Done()
+			var output bytes.Buffer
+			opts := switchOptions{
+				ConfigDir:  app.ConfigDir,
+				TargetPath: app.TargetPath,
+				Env:        r.Env,
+				ConfigType: app.configType(),
+				Format:     app.Format,
+				Template:   app.Template,
+				Hooks:      app.hooks(),
+				Output:     &output,
+				App:        r.App,
+				Source:     sourceProfile,
+
+				ProtectedEnvs:    app.ProtectedEnvs,
+				ConfirmProtected: confirmProtected,
+			}
+			switch {
+			case dryRun:
+				_, r.Err = planSwitch(opts)
+			case app.ProxyPort != 0:
+				_, r.Err = switchAppProxy(opts, app.ProxyPort)
+			default:
+				_, r.Err = executeSwitch(opts)
+			}
+			r.Output = strings.TrimSpace(output.String())
+		}(&results[i], app)
+	}
+	wg.Wait()
+
+	if !dryRun {
+		_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+			for _, r := range results {
+				if app, exists := config.Apps[r.App]; exists && r.Err == nil {
+					app.LastEnv = r.Env
+					config.Apps[r.App] = app
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return results, err
+		}
+	}
+	return results, nil
+}
+
+// checkProfileTargets refuses a profile where two apps write the same target:
+// they switch in parallel, so the file would end up with either env
+func checkProfileTargets(config PersistentConfig, profile string, results []profileResult) error {
+	writers := make(map[string]string)
+	for _, r := range results {
+		appName, app, found := findApp(config, r.App)
+		if !found || app.ProxyPort != 0 {
+			continue
+		}
+		target, err := filepath.Abs(app.TargetPath)
+		if err != nil {
+			return err
+		}
+		if other, exists := writers[target]; exists {
+			return fmt.Errorf("profile '%s' switches '%s' and '%s', which write the same target %s", profile, other, appName, app.TargetPath)
+		}
+		writers[target] = appName
+	}
+	return nil
+}
+
+// protectedProfileApps lists the apps a profile switches to a protected env,
+// as "app → env"
+func protectedProfileApps(config PersistentConfig, profile string) []string {
+	protected := make([]string, 0)
+	for name, env := range config.Profiles[profile] {
+		appName, app, found := findApp(config, name)
+		if found && envProtected(app.ConfigDir, env, app.configType(), app.ProtectedEnvs) {
+			protected = append(protected, fmt.Sprintf("%s → %s", appName, env))
+		}
+	}
+	sort.Strings(protected)
+	return slices.Compact(protected)
+}
+
+// formatProfileReport renders the combined report of a profile run
+func formatProfileReport(profile string, results []profileResult) string {
+	var s strings.Builder
+	ok := 0
+	fmt.Fprintf(&s, "Profile: %s\n", profile)
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Fprintf(&s, "  ✗ %-20s %-10s %v\n", r.App, r.Env, r.Err)
+		} else {
+			ok++
+			fmt.Fprintf(&s, "  ✓ %-20s %-10s %s\n", r.App, r.Env, r.Target)
+		}
+		if r.Output != "" {
+			s.WriteString(indentLines(r.Output, "      "))
+			s.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&s, "%d/%d apps switched", ok, len(results))
+	return s.String()
+}
+
+// profileFailure returns an error when an app of the profile failed; it
+// carries the code of the first failure
+func profileFailure(profile string, results []profileResult) error {
+	for _, r := range results {
+		if r.Err != nil {
+			return withCode(errorCode(r.Err), fmt.Errorf("profile '%s' did not switch every app", profile))
+		}
+	}
+	return nil
+}
+
+// profileListResult is the --output json result of `profile list`
+type profileListResult struct {
+	Profiles map[string]map[string]string `json:"profiles"`
+}
+
+// profileApplyResult is the --output json result of `profile apply`
+type profileApplyResult struct {
+	Profile string          `json:"profile"`
+	DryRun  bool            `json:"dryRun"`
+	Apps    []profileReport `json:"apps"`
+}
+
+// profileReport is the --output json form of a profileResult
+type profileReport struct {
+	App    string     `json:"app"`
+	Env    string     `json:"env"`
+	Target string     `json:"target,omitempty"`
+	Output string     `json:"output,omitempty"`
+	Error  *jsonError `json:"error,omitempty"`
+}
+
+func profileReports(results []profileResult) []profileReport {
+	reports := make([]profileReport, 0, len(results))
+	for _, r := range results {
+		report := profileReport{App: r.App, Env: r.Env, Target: r.Target, Output: r.Output}
+		if r.Err != nil {
+			report.Error = &jsonError{Code: errorCode(r.Err), Message: r.Err.Error()}
+		}
+		reports = append(reports, report)
+	}
+	return reports
+}
+
+// runProfile implements `envswitch profile list|apply|set|delete`
+func runProfile(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch profile list|apply|set|delete"))
+	}
+
+	fs := flag.NewFlagSet("profile "+args[0], flag.ContinueOnError)
+	dryRun := fs.Bool("dry-run", false, "Check every app of the profile without writing targets")
+	confirmProtected := addProtectedFlag(fs)
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	config, err := loadPersistentConfig()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		if jsonOutput() {
+			profiles := config.Profiles
+			if profiles == nil {
+				profiles = make(map[string]map[string]string)
+			}
+			return printJSON("profile", profileListResult{profiles}, nil, nil)
+		}
+		for _, name := range profileNames(config) {
+			apps := config.Profiles[name]
+			pairs := make([]string, 0, len(apps))
+			for app, env := range apps {
+				pairs = append(pairs, fmt.Sprintf("%s: %s", app, env))
+			}
+			sort.Strings(pairs)
+			fmt.Printf("%s  {%s}\n", name, strings.Join(pairs, ", "))
+		}
+		return nil
+
+	case "apply":
+		if len(positional) != 1 {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch profile apply <name> [--dry-run] [--%s]", protectedFlag))
+		}
+		results, err := applyProfile(config, positional[0], *dryRun, *confirmProtected)
+		if err != nil && results == nil {
+			return err
+		}
+		if err == nil {
+			err = profileFailure(positional[0], results)
+		}
+		if jsonOutput() {
+			return printJSON("profile", profileApplyResult{positional[0], *dryRun, profileReports(results)}, nil, err)
+		}
+		fmt.Println(formatProfileReport(positional[0], results))
+		return err
+
+	case "set":
+		// envswitch profile set fullstack-stress "The Vault=stress" backoffice=stress
+		if len(positional) < 2 {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch profile set <name> <app>=<env>..."))
+		}
+		apps := make(map[string]string)
+		for _, pair := range positional[1:] {
+			app, env, ok := strings.Cut(pair, "=")
+			if !ok || app == "" || env == "" {
+				return fmt.Errorf("expected <app>=<env>, got '%s'", pair)
+			}
+			apps[app] = env
+		}
+		_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+			if config.Profiles == nil {
+				config.Profiles = make(map[string]map[string]string)
+			}
+			config.Profiles[positional[0]] = apps
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return printDone("profile", "Saved profile: "+positional[0])
+
+	case "delete":
+		if len(positional) != 1 {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch profile delete <name>"))
+		}
+		_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+			if _, exists := config.Profiles[positional[0]]; !exists {
+				return fmt.Errorf("profile '%s' not found", positional[0])
+			}
+			delete(config.Profiles, positional[0])
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return printDone("profile", "Deleted profile: "+positional[0])
+
+	default:
+		return fmt.Errorf("unknown profile command '%s' (use list, apply, set or delete)", args[0])
+	}
+}
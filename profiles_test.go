@@ -0,0 +1,162 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Run with -race: the apps of a profile decrypt their configs in parallel.
+// File I/O hides races from the detector, see TestDecryptConcurrent too.
+func TestApplyProfileEncrypted(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	t.Setenv(secretKeyEnvVar, "profile-key")
+	stress, err := os.ReadFile("testdata/configs/config.stress.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := os.ReadFile("testdata/targets/serverConfig.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config := PersistentConfig{Apps: make(map[string]AppConfig), Profiles: make(map[string]map[string]string)}
+	for _, name := range []string{"Backoffice", "Front"} {
+		appDir := filepath.Join(dir, name)
+		os.MkdirAll(appDir, 0755)
+		secret, err := encryptSecret(name+"-recaptcha", "profile-key")
+		if err != nil {
+			t.Fatal(err)
+		}
+		content := strings.Replace(string(stress), "stress-recaptcha-site-key", secret, 1)
+		os.WriteFile(filepath.Join(appDir, "config.stress.json"), []byte(content), 0644)
+		os.WriteFile(filepath.Join(appDir, "serverConfig.js"), target, 0644)
+		config.Apps[name] = AppConfig{ConfigDir: appDir, TargetPath: filepath.Join(appDir, "serverConfig.js"), Format: "serverConfig"}
+	}
+	if err := savePersistentConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// "backoffice" is the same app as "Backoffice": it is switched once
+	config.Profiles["stress"] = map[string]string{"Backoffice": "stress", "backoffice": "stress", "Front": "stress"}
+	results, err := applyProfile(config, "stress", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("results = %+v, want one per app", results)
+	}
+	for _, r := range results {
+		if r.Err != nil {
+			t.Errorf("%s: %v", r.App, r.Err)
+			continue
+		}
+		content, _ := os.ReadFile(r.Target)
+		if !strings.Contains(string(content), r.App+"-recaptcha") {
+			t.Errorf("%s: the secret wasn't decrypted into the target", r.App)
+		}
+	}
+
+	config.Profiles["stress"]["backoffice"] = "test"
+	if _, err := applyProfile(config, "stress", false, false); err == nil || !strings.Contains(err.Error(), "twice") {
+		t.Errorf("one app to two envs: error = %v", err)
+	}
+}
+
+// profileApps saves apps with a copy of the stress config and a target each
+func profileApps(t *testing.T, apps map[string]AppConfig) PersistentConfig {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	stress, _ := os.ReadFile("testdata/configs/config.stress.json")
+	target, _ := os.ReadFile("testdata/targets/serverConfig.js")
+
+	config := PersistentConfig{Apps: make(map[string]AppConfig), Profiles: make(map[string]map[string]string)}
+	for name, app := range apps {
+		appDir := filepath.Join(dir, name)
+		os.MkdirAll(appDir, 0755)
+		os.WriteFile(filepath.Join(appDir, "config.stress.json"), stress, 0644)
+		app.ConfigDir = appDir
+		if app.TargetPath == "" {
+			app.TargetPath = filepath.Join(appDir, "serverConfig.js")
+		} else {
+			app.TargetPath = filepath.Join(dir, app.TargetPath)
+		}
+		os.WriteFile(app.TargetPath, target, 0644)
+		app.Format = "serverConfig"
+		app.LastEnv = "test"
+		config.Apps[name] = app
+	}
+	if err := savePersistentConfig(config); err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+func TestApplyProfileFailures(t *testing.T) {
+	config := profileApps(t, map[string]AppConfig{
+		"Backoffice": {},
+		"Front":      {ProtectedEnvs: []string{"stress"}},
+		"Vault":      {},
+	})
+	os.Remove(filepath.Join(config.Apps["Vault"].ConfigDir, "config.stress.json"))
+	config.Profiles["stress"] = map[string]string{"Backoffice": "stress", "Front": "stress", "Vault": "stress", "Admin": "stress"}
+
+	results, err := applyProfile(config, "stress", false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"Admin": "app not found", "Backoffice": "", "Front": "protected", "Vault": "config.stress"}
+	for _, r := range results {
+		switch {
+		case want[r.App] == "" && r.Err != nil:
+			t.Errorf("%s: %v", r.App, r.Err)
+		case want[r.App] != "" && (r.Err == nil || !strings.Contains(r.Err.Error(), want[r.App])):
+			t.Errorf("%s: err = %v, want %q", r.App, r.Err, want[r.App])
+		}
+	}
+	if len(results) != len(want) {
+		t.Errorf("results = %+v", results)
+	}
+	if err := profileFailure("stress", results); err == nil {
+		t.Error("no failure reported")
+	}
+
+	// Only the switched app records its new env
+	saved, err := loadPersonalConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, env := range map[string]string{"Backoffice": "stress", "Front": "test", "Vault": "test"} {
+		if got := saved.Apps[name].LastEnv; got != env {
+			t.Errorf("%s last env = %s, want %s", name, got, env)
+		}
+	}
+	if content, _ := os.ReadFile(config.Apps["Front"].TargetPath); strings.Contains(string(content), "stress") {
+		t.Error("the protected env was written without confirmation")
+	}
+
+	if _, err := applyProfile(config, "nope", false, false); err == nil {
+		t.Error("unknown profile applied")
+	}
+}
+
+// Apps switch in parallel, so two of them may not write the same target
+func TestApplyProfileSameTarget(t *testing.T) {
+	config := profileApps(t, map[string]AppConfig{
+		"Backoffice": {TargetPath: "serverConfig.js"},
+		"Front":      {TargetPath: "serverConfig.js"},
+	})
+	config.Profiles["stress"] = map[string]string{"Backoffice": "stress", "Front": "stress"}
+	original, _ := os.ReadFile(config.Apps["Front"].TargetPath)
+
+	results, err := applyProfile(config, "stress", false, false)
+	if err == nil || results != nil || !strings.Contains(err.Error(), "'Backoffice' and 'Front', which write the same target") {
+		t.Fatalf("err = %v, results = %+v", err, results)
+	}
+	if content, _ := os.ReadFile(config.Apps["Front"].TargetPath); string(content) != string(original) {
+		t.Error("the target was written")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// protectedFlag confirms a switch to a protected env on the command line
+const protectedFlag = "yes-i-mean-prod"
+
+// protectedMarker is in the warning comment written at the top of targets that
+// point at a protected env, so the next switch can find and remove it
+const protectedMarker = "envswitch: PROTECTED ENV"
+
+// addProtectedFlag registers --yes-i-mean-prod on a flag set
+func addProtectedFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool(protectedFlag, false, "Confirm a switch to a protected env (protected: true in its config, or in the app's protectedEnvs)")
+}
+
+// isProtected reports whether env is protected, by its config or by the
+// app's protectedEnvs setting (config may be nil)
+func isProtected(config *Config, env string, protectedEnvs []string) bool {
+	return (config != nil && config.Protected) || slices.Contains(protectedEnvs, env)
+}
+
+// envProtected loads the config of env just to tell whether it is protected;
+// a config that doesn't load is only protected by protectedEnvs
+func envProtected(configDir, env, configType string, protectedEnvs []string) bool {
+	config, _ := readConfigFile(envConfigPath(configDir, env, configType), configType)
+	return isProtected(config, env, protectedEnvs)
+}
+
+// protectedError refuses a switch to a protected env that wasn't confirmed
+func protectedError(env string) error {
+	return withCode(codeProtectedEnv, fmt.Errorf("'%s' is a protected env: pass --%s to switch to it", env, protectedFlag))
+}
+
+// checkProtected refuses an unconfirmed switch to a protected env for the
+// switches that don't plan a target (proxy mode)
+func checkProtected(opts switchOptions) error {
+	if opts.ConfirmProtected || !envProtected(opts.ConfigDir, opts.Env, opts.ConfigType, opts.ProtectedEnvs) {
+		return nil
+	}
+	return protectedError(opts.Env)
+}
+
+// protectedText is the warning written into targets that point at env
+func protectedText(env string) string {
+	return fmt.Sprintf("⚠️ %s '%s': requests from this app reach it. Switch away before running anything that writes.", protectedMarker, env)
+}
+
+// protectedComment returns the warning line for a target pointing at env, in
+// the comment syntax of the target's file type (none for JSON)
+func protectedComment(target, env string) (string, bool) {
+	text := protectedText(env)
+	base := strings.ToLower(filepath.Base(target))
+	switch ext := filepath.Ext(base); {
+	case ext == ".json":
+		return "", false
+	case strings.HasPrefix(base, ".env"), slices.Contains([]string{".yaml", ".yml", ".toml", ".sh", ".ini", ".conf", ".properties", ".py", ".rb"}, ext):
+		return "# " + text, true
+	case slices.Contains([]string{".html", ".htm", ".xml", ".vue", ".svg"}, ext):
+		return "<!-- " + text + " -->", true
+	case ext == ".css":
+		return "/* " + text + " */", true
+	default:
+		return "// " + text, true
+	}
+}
+
+// stripProtectedWarning removes the warning line a switch to a protected env wrote
+func stripProtectedWarning(content string) string {
+	if !strings.Contains(content, protectedMarker) {
+		return content
+	}
+	lines := strings.SplitAfter(content, "\n")
+	kept := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if !strings.Contains(line, protectedMarker) {
+			kept = append(kept, line)
+		}
+	}
+	return strings.Join(kept, "")
+}
+
+// markProtected returns the target content with the warning line of a
+// protected env at the top (after a shebang or XML declaration), or without
+// any warning line when the env isn't protected
+func markProtected(content, target, env string, protected bool) string {
+	content = stripProtectedWarning(content)
+	comment, ok := protectedComment(target, env)
+	if !protected || !ok {
+		return content
+	}
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+
+	head := ""
+	if strings.HasPrefix(content, "#!") || strings.HasPrefix(content, "<?xml") {
+		end := strings.Index(content, "\n")
+		if end < 0 {
+			return content + newline + comment + newline
+		}
+		head, content = content[:end+1], content[end+1:]
+	}
+	return head + comment + newline + content
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProtectedSwitch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	stress, err := os.ReadFile("testdata/configs/config.stress.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prod := strings.Replace(string(stress), "{", `{"protected": true,`, 1)
+	os.WriteFile(filepath.Join(dir, "config.stress.json"), stress, 0644)
+	os.WriteFile(filepath.Join(dir, "config.prod.json"), []byte(prod), 0644)
+	original, err := os.ReadFile("testdata/targets/serverConfig.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "serverConfig.js")
+	os.WriteFile(target, original, 0644)
+
+	opts := switchOptions{ConfigDir: dir, TargetPath: target, Env: "prod"}
+	if _, err := executeSwitch(opts); errorCode(err) != codeProtectedEnv {
+		t.Fatalf("unconfirmed: err = %v, want code %s", err, codeProtectedEnv)
+	}
+	if content, _ := os.ReadFile(target); string(content) != string(original) {
+		t.Error("unconfirmed: the target was written")
+	}
+
+	opts.ConfirmProtected = true
+	plan, err := executeSwitch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := os.ReadFile(target)
+	if !plan.Protected || !strings.HasPrefix(string(content), "// ⚠️ "+protectedMarker+" 'prod'") {
+		t.Errorf("confirmed: protected = %v, target starts with %q", plan.Protected, firstLine(string(content)))
+	}
+
+	// Switching away takes the warning out again
+	stressOpts := switchOptions{ConfigDir: dir, TargetPath: target, Env: "stress"}
+	if _, err := executeSwitch(stressOpts); err != nil {
+		t.Fatal(err)
+	}
+	content, _ = os.ReadFile(target)
+	if want := renderTarget(string(original), mustReadConfig(t, filepath.Join(dir, "config.stress.json")), "", false); string(content) != want {
+		t.Errorf("after switching away:\n%s", content)
+	}
+
+	// The app's protectedEnvs protect envs whose config doesn't say so
+	stressOpts.ProtectedEnvs = []string{"stress"}
+	if _, err := executeSwitch(stressOpts); errorCode(err) != codeProtectedEnv {
+		t.Errorf("protectedEnvs: err = %v, want code %s", err, codeProtectedEnv)
+	}
+	if err := checkProtected(stressOpts); errorCode(err) != codeProtectedEnv {
+		t.Errorf("checkProtected: err = %v, want code %s", err, codeProtectedEnv)
+	}
+	stressOpts.ConfirmProtected = true
+	if err := checkProtected(stressOpts); err != nil {
+		t.Errorf("checkProtected confirmed: %v", err)
+	}
+}
+
+func TestMarkProtected(t *testing.T) {
+	tests := []struct {
+		target  string
+		content string
+		want    string // the content with the warning (as WARNING), "" for none
+	}{
+		{"serverConfig.js", "var a = 1;\n", "// WARNING\nvar a = 1;\n"},
+		{"app/env.ts", "export {};\r\n", "// WARNING\r\nexport {};\r\n"},
+		{"config.yaml", "api: x\n", "# WARNING\napi: x\n"},
+		{".env.local", "API=x\n", "# WARNING\nAPI=x\n"},
+		{"index.html", "<html></html>\n", "<!-- WARNING -->\n<html></html>\n"},
+		{"run.sh", "#!/bin/sh\necho\n", "#!/bin/sh\n# WARNING\necho\n"},
+		{"settings.json", "{}\n", ""},
+	}
+	for _, tt := range tests {
+		marked := markProtected(tt.content, tt.target, "prod", true)
+		want := tt.content
+		if tt.want != "" {
+			want = strings.Replace(tt.want, "WARNING", protectedText("prod"), 1)
+		}
+		if marked != want {
+			t.Errorf("%s: got %q, want %q", tt.target, marked, want)
+		}
+		if got := markProtected(marked, tt.target, "prod", true); got != marked {
+			t.Errorf("%s: marking twice gives %q", tt.target, got)
+		}
+		if got := markProtected(marked, tt.target, "test", false); got != tt.content {
+			t.Errorf("%s: unmarked %q, want %q", tt.target, got, tt.content)
+		}
+	}
+}
+
+func TestParseJSConfigProtected(t *testing.T) {
+	if !parseJSConfig("module.exports = { protected: true, server: 'https://api.example.com' };").Protected {
+		t.Error("protected: true not read")
+	}
+	if parseJSConfig("module.exports = { 'protected': false };").Protected {
+		t.Error("protected: false read as true")
+	}
+	if !parseJSConfig("module.exports = function () {\n  return {\n    \"protected\": true\n  }\n}").Protected {
+		t.Error("protected: true of a returned object not read")
+	}
+
+	// Only the config object's own property marks the env
+	for _, content := range []string{
+		"module.exports = {\n  // protected: true\n  server: 'https://api.example.com'\n};",
+		"module.exports = { feature: { protected: true }, server: 'https://api.example.com' };",
+		"module.exports = { note: 'protected: true', list: [{ protected: true }] };",
+	} {
+		if parseJSConfig(content).Protected {
+			t.Errorf("not the top level, read as protected: %s", content)
+		}
+	}
+}
+
+// firstLine returns the first line of content
+func firstLine(content string) string {
+	line, _, _ := strings.Cut(content, "\n")
+	return line
+}
+
+// mustReadConfig loads a config file or fails the test
+func mustReadConfig(t *testing.T, path string) *Config {
+	t.Helper()
+	config, err := readConfigFile(path, configTypeAuto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
+
+// The warning line counts as one added line, not as a change of every line
+// below it
+func TestProtectedChangedLines(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "store", "config.json"))
+	original, err := os.ReadFile("testdata/targets/serverConfig.js")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(dir, "serverConfig.js")
+	os.WriteFile(target, original, 0644)
+
+	opts := switchOptions{ConfigDir: testConfigDir, TargetPath: target, Env: "stress"}
+	plan, err := planSwitch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var plain switchResult
+	plain.fill(plan, nil)
+
+	opts.ProtectedEnvs, opts.ConfirmProtected = []string{"stress"}, true
+	plan, err = executeSwitch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var protected switchResult
+	protected.fill(plan, nil)
+	if protected.ChangedLines != plain.ChangedLines+1 || plain.ChangedLines == 0 || plain.ChangedLines > 10 {
+		t.Errorf("changedLines = %d protected, %d not, want one more", protected.ChangedLines, plain.ChangedLines)
+	}
+	diff := diffLines(plan.Original, plan.Result, nil)
+	if first := diff[0]; first.Line != 1 || first.Old != nil || !strings.Contains(*first.New, protectedMarker) {
+		t.Errorf("first diff line = %+v", first)
+	}
+}
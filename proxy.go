@@ -0,0 +1,498 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultProxyPort is where `envswitch proxy` listens unless told otherwise
+const defaultProxyPort = 7700
+
+// proxyAdminPrefix is the path of the admin endpoint; it can't clash with a
+// URL key because keys never start with an underscore
+const proxyAdminPrefix = "/_envswitch/"
+
+// proxyUpstream is where the proxy forwards one path prefix
+type proxyUpstream struct {
+	Key string `json:"key"`
+	URL string `json:"url"`
+}
+
+// proxyStatus is what the admin endpoint reports
+type proxyStatus struct {
+	App       string          `json:"app,omitempty"`
+	Env       string          `json:"env"`
+	Port      int             `json:"port"`
+	Upstreams []proxyUpstream `json:"upstreams"`
+}
+
+// proxyUpstreams lists the URL fields of a config as proxy path prefixes:
+// /quest for server.quest, /questServer, /walkmeUrl...
+func proxyUpstreams(config *Config) []proxyUpstream {
+	upstreams := make([]proxyUpstream, 0)
+	for _, e := range configEndpoints(config) {
+		upstreams = append(upstreams, proxyUpstream{Key: strings.TrimPrefix(e.Name, "server."), URL: e.URL})
+	}
+	return upstreams
+}
+
+// proxyTargetConfig returns a copy of config with every URL pointing at the
+// proxy, e.g. http://localhost:7700/quest
+func proxyTargetConfig(config *Config, port int) *Config {
+	local := make(map[string]string)
+	for _, e := range configEndpoints(config) {
+		local[e.Name] = fmt.Sprintf("http://localhost:%d/%s", port, strings.TrimPrefix(e.Name, "server."))
+	}
+	return withLocalURLs(config, local, false)
+}
+
+// envProxy forwards /<key>/... to the URL of that key in the selected env
+type envProxy struct {
+	load      func(env string) (*Config, error)
+	protected func(env string) bool // nil: no env is protected
+
+	mu        sync.RWMutex
+	status    proxyStatus
+	upstreams map[string]*url.URL
+}
+
+// switchEnv loads an env and makes it the one requests are forwarded to
+func (p *envProxy) switchEnv(env string) error {
+	config, err := p.load(env)
+	if err != nil {
+		return err
+	}
+	list := proxyUpstreams(config)
+	upstreams := make(map[string]*url.URL, len(list))
+	for _, upstream := range list {
+		u, err := url.Parse(upstream.URL)
+		if err != nil {
+			return fmt.Errorf("%s: %v", upstream.Key, err)
+		}
+		upstreams[upstream.Key] = u
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Env = env
+	p.status.Upstreams = list
+	p.upstreams = upstreams
+	return nil
+}
+
+// currentStatus returns a copy of the proxy status
+func (p *envProxy) currentStatus() proxyStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.status
+}
+
+// upstreamURL maps a request URL to the upstream one: /quest/api/x?a=1 with
+// quest = https://q.example.com/base becomes https://q.example.com/base/api/x?a=1
+func upstreamURL(upstream *url.URL, rest *url.URL) *url.URL {
+	out := *upstream
+	if rest.Path != "" && rest.Path != "/" {
+		out.Path = strings.TrimSuffix(upstream.Path, "/") + rest.Path
+		out.RawPath = ""
+	}
+	switch {
+	case upstream.RawQuery == "":
+		out.RawQuery = rest.RawQuery
+	case rest.RawQuery != "":
+		out.RawQuery = upstream.RawQuery + "&" + rest.RawQuery
+	}
+	return &out
+}
+
+func (p *envProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, proxyAdminPrefix) {
+		p.serveAdmin(w, r)
+		return
+	}
+
+	key, rest, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	p.mu.RLock()
+	upstream, ok := p.upstreams[key]
+	env := p.status.Env
+	p.mu.RUnlock()
+	if !ok {
+		http.Error(w, fmt.Sprintf("envswitch proxy: no '%s' URL in env %s", key, env), http.StatusBadGateway)
+		return
+	}
+
+	restURL := &url.URL{RawQuery: r.URL.RawQuery}
+	if rest != "" {
+		restURL.Path = "/" + rest
+	}
+	target := upstreamURL(upstream, restURL)
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = target
+			pr.Out.Host = target.Host
+			pr.SetXForwarded()
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			fmt.Fprintf(logOutput(), "✗ %s %s %s → %v\n", time.Now().Format("15:04:05"), r.Method, target.Redacted(), err)
+			http.Error(w, fmt.Sprintf("envswitch proxy (%s): %v", env, err), http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// serveAdmin handles GET /_envswitch/status and POST /_envswitch/switch
+// {"env": "stress"}; a protected env also needs "confirmProtected": true
+func (p *envProxy) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	switch strings.TrimPrefix(r.URL.Path, proxyAdminPrefix) {
+	case "status":
+		writeProxyJSON(w, http.StatusOK, p.currentStatus())
+	case "switch":
+		if r.Method != http.MethodPost {
+			writeProxyJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "use POST"})
+			return
+		}
+		// A JSON content type can't be sent cross-site without a CORS
+		// preflight, which the proxy never allows, so web pages can't switch it
+		if r.Header.Get("Content-Type") != "application/json" {
+			writeProxyJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "expected application/json"})
+			return
+		}
+		var body struct {
+			Env              string `json:"env"`
+			ConfirmProtected bool   `json:"confirmProtected"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Env == "" {
+			writeProxyJSON(w, http.StatusBadRequest, map[string]string{"error": `expected {"env": "<env>"}`})
+			return
+		}
+		// Checked here too: anything local can POST, not only envswitch
+		if p.protected != nil && p.protected(body.Env) && !body.ConfirmProtected {
+			writeProxyJSON(w, http.StatusForbidden, map[string]string{"error": protectedError(body.Env).Error()})
+			return
+		}
+		from := p.currentStatus().Env
+		if err := p.switchEnv(body.Env); err != nil {
+			writeProxyJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+			return
+		}
+		fmt.Fprintf(logOutput(), "🔀 %s switched %s → %s\n", time.Now().Format("15:04:05"), from, body.Env)
+		writeProxyJSON(w, http.StatusOK, p.currentStatus())
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func writeProxyJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// callProxy sends an admin request to the proxy on port and decodes its status
+func callProxy(port int, method, action string, body interface{}, timeout time.Duration) (*proxyStatus, error) {
+	var payload io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("http://localhost:%d%s%s", port, proxyAdminPrefix, action), payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := (&http.Client{Timeout: timeout}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("no envswitch proxy on port %d (start one with `envswitch proxy serve`)", port)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		if failure.Error == "" {
+			failure.Error = resp.Status
+		}
+		if resp.StatusCode == http.StatusForbidden {
+			return nil, withCode(codeProtectedEnv, fmt.Errorf("proxy: %s", failure.Error))
+		}
+		return nil, fmt.Errorf("proxy: %s", failure.Error)
+	}
+	var status proxyStatus
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, fmt.Errorf("proxy on port %d: %v", port, err)
+	}
+	return &status, nil
+}
+
+// fetchProxyStatus asks the proxy on port which env it forwards to
+func fetchProxyStatus(port int, timeout time.Duration) (*proxyStatus, error) {
+	return callProxy(port, http.MethodGet, "status", nil, timeout)
+}
+
+// switchProxy tells the proxy on port to forward to env; no file is touched
+func switchProxy(port int, env string, confirmProtected bool) (*proxyStatus, error) {
+	body := map[string]interface{}{"env": env, "confirmProtected": confirmProtected}
+	return callProxy(port, http.MethodPost, "switch", body, 10*time.Second)
+}
+
+// switchAppProxy switches the proxy on port for a switch in proxy mode:
+// protected envs need confirmation, and the switch is logged like a written
+// target (see auditProxySwitch)
+func switchAppProxy(opts switchOptions, port int) (*proxyStatus, error) {
+	if err := checkProtected(opts); err != nil {
+		return nil, err
+	}
+	status, err := switchProxy(port, opts.Env, opts.ConfirmProtected)
+	if err != nil {
+		return nil, err
+	}
+	if opts.App == "" {
+		opts.App = status.App
+	}
+	auditProxySwitch(opts, port)
+	return status, nil
+}
+
+// proxyPortFlag resolves --port: the flag, then the app's saved proxy port, then 7700
+func proxyPortFlag(port int, saved AppConfig) int {
+	switch {
+	case port != 0:
+		return port
+	case saved.ProxyPort != 0:
+		return saved.ProxyPort
+	default:
+		return defaultProxyPort
+	}
+}
+
+// proxyInitResult is the --output json result of `proxy init`
+type proxyInitResult struct {
+	Target string `json:"target"`
+	Env    string `json:"env"` // where the values other than URLs come from
+	Port   int    `json:"port"`
+	App    string `json:"app,omitempty"`
+}
+
+// runProxy implements `envswitch proxy serve|init|switch|status|off`
+func runProxy(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch proxy serve|init|switch|status|off"))
+	}
+
+	fs := flag.NewFlagSet("proxy "+args[0], flag.ContinueOnError)
+	flags := addEnvFlags(fs)
+	port := fs.Int("port", 0, fmt.Sprintf("Port of the proxy (default: the app's saved proxy port, or %d)", defaultProxyPort))
+	isDist := fs.Bool("dist", false, "Set isDist to true (proxy init)")
+	confirmProtected := addProtectedFlag(fs)
+	positional, err := parseInterspersed(fs, args[1:])
+	if err != nil {
+		return err
+	}
+	if *flags.env == "" && len(positional) > 0 {
+		*flags.env = positional[0]
+	}
+	if err := flags.resolve(fs); err != nil {
+		return err
+	}
+	*port = proxyPortFlag(*port, flags.saved)
+
+	switch args[0] {
+	case "serve":
+		return serveProxy(flags, *port)
+
+	case "init":
+		// Write the target once with proxy URLs
+		if *flags.env == "" {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch proxy init --env <env> [--app name] [--port %d]", defaultProxyPort))
+		}
+		opts := flags.switchOptions()
+		opts.IsDist = *isDist
+		plan, err := planSwitch(opts)
+		if err != nil {
+			return err
+		}
+		// The proxy decides the env from now on, so no protected warning either
+		result := renderTarget(stripProtectedWarning(plan.Original), proxyTargetConfig(plan.Config, *port), opts.Format, opts.IsDist)
+		if err := os.WriteFile(opts.TargetPath, []byte(result), 0644); err != nil {
+			return fmt.Errorf("writing target file %s: %v", opts.TargetPath, err)
+		}
+		if *flags.app != "" {
+			_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+				saved := config.Apps[*flags.app]
+				saved.ProxyPort = *port
+				saved.LastEnv = opts.Env
+				config.Apps[*flags.app] = saved
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if jsonOutput() {
+			return printJSON("proxy", proxyInitResult{opts.TargetPath, opts.Env, *port, *flags.app}, nil, nil)
+		}
+		fmt.Printf("✓ Target now points at the proxy on port %d\n", *port)
+		fmt.Printf("  Target: %s\n", opts.TargetPath)
+		fmt.Printf("  Other values are from: %s\n", opts.Env)
+		serve := fmt.Sprintf("envswitch proxy serve --env %s", opts.Env)
+		if *flags.app != "" {
+			fmt.Printf("  Switches of %s now go to the proxy (undo with `envswitch proxy off --app %q`)\n", *flags.app, *flags.app)
+			serve += fmt.Sprintf(" --app %q", *flags.app)
+		}
+		fmt.Printf("\n  Start it with: %s\n", serve)
+		return nil
+
+	case "switch":
+		if *flags.env == "" {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch proxy switch <env> [--app name] [--port %d] [--%s]", defaultProxyPort, protectedFlag))
+		}
+		opts := flags.switchOptions()
+		opts.ConfirmProtected = *confirmProtected
+		status, err := switchAppProxy(opts, *port)
+		if err != nil {
+			return err
+		}
+		if *flags.app == "" {
+			*flags.app = status.App
+		}
+		if err := saveProxyEnv(*flags.app, status.Env); err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON("proxy", status, nil, nil)
+		}
+		fmt.Printf("✓ Proxy on port %d now forwards to: %s (no files changed)\n", *port, status.Env)
+		return nil
+
+	case "status":
+		status, err := fetchProxyStatus(*port, 2*time.Second)
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON("proxy", status, nil, nil)
+		}
+		printProxyStatus(status)
+		return nil
+
+	case "off":
+		if *flags.app == "" {
+			return withCode(codeUsage, fmt.Errorf("usage: envswitch proxy off --app <name>"))
+		}
+		_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+			saved := config.Apps[*flags.app]
+			saved.ProxyPort = 0
+			config.Apps[*flags.app] = saved
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		return printDone("proxy", fmt.Sprintf("Switches of %s write the target again. Switch once to replace the proxy URLs:", *flags.app),
+			fmt.Sprintf("envswitch --app %q --env %s", *flags.app, *flags.env))
+
+	default:
+		return fmt.Errorf("unknown proxy command '%s' (use serve, init, switch, status or off)", args[0])
+	}
+}
+
+// saveProxyEnv records the env a proxy switched to as the last env of app
+func saveProxyEnv(app, env string) error {
+	if app == "" {
+		return nil
+	}
+	_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+		if saved, exists := config.Apps[app]; exists {
+			saved.LastEnv = env
+			config.Apps[app] = saved
+		}
+		return nil
+	})
+	return err
+}
+
+func printProxyStatus(status *proxyStatus) {
+	fmt.Printf("🔀 Proxy on port %d → %s", status.Port, status.Env)
+	if status.App != "" {
+		fmt.Printf(" (%s)", status.App)
+	}
+	fmt.Println()
+	for _, upstream := range status.Upstreams {
+		fmt.Printf("   /%-14s %s\n", upstream.Key, upstream.URL)
+	}
+}
+
+// serveProxy runs the proxy until Ctrl+C
+func serveProxy(flags *envFlags, port int) error {
+	if *flags.env == "" {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch proxy serve --env <env> [--app name] [--port %d]", defaultProxyPort))
+	}
+
+	configDir, configType, keyFile := *flags.configDir, flags.configTypeValue(), *flags.keyFile
+	protectedEnvs := flags.saved.ProtectedEnvs
+	proxy := &envProxy{
+		load: func(env string) (*Config, error) {
+			configPath := envConfigPath(configDir, env, configType)
+			config, err := loadEnvConfig(configPath, configType, keyFile)
+			if err != nil {
+				return nil, fmt.Errorf("loading config %s: %v", configPath, err)
+			}
+			return config, nil
+		},
+		protected: func(env string) bool {
+			return envProtected(configDir, env, configType, protectedEnvs)
+		},
+		status: proxyStatus{App: *flags.app, Port: port},
+	}
+	if err := proxy.switchEnv(*flags.env); err != nil {
+		return err
+	}
+
+	// Only local processes may use the proxy (and switch it)
+	listener, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		return err
+	}
+	server := &http.Server{Handler: proxy}
+	errs := make(chan error, 1)
+	go func() { errs <- server.Serve(listener) }()
+
+	status := proxy.currentStatus()
+	if jsonOutput() {
+		printJSON("proxy", status, nil, nil)
+	} else {
+		printProxyStatus(&status)
+		fmt.Printf("\n   Switch with: envswitch proxy switch <env> --port %d. Press Ctrl+C to stop\n", port)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	select {
+	case <-interrupt:
+		fmt.Fprintln(logOutput(), "\n👋 Stopped the proxy")
+		return server.Close()
+	case err := <-errs:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	}
+}
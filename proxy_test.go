@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestUpstreamURL(t *testing.T) {
+	tests := []struct {
+		upstream string
+		rest     string
+		want     string
+	}{
+		{"https://q.example.com", "/api/x?a=1", "https://q.example.com/api/x?a=1"},
+		{"https://q.example.com/base/", "/api/x", "https://q.example.com/base/api/x"},
+		{"https://cdn.example.com/w.js", "", "https://cdn.example.com/w.js"},
+		{"https://cdn.example.com/w.js?v=2", "?cb=1", "https://cdn.example.com/w.js?v=2&cb=1"},
+	}
+	for _, tt := range tests {
+		upstream, _ := url.Parse(tt.upstream)
+		rest, _ := url.Parse(tt.rest)
+		if got := upstreamURL(upstream, rest).String(); got != tt.want {
+			t.Errorf("upstreamURL(%s, %s) = %s, want %s", tt.upstream, tt.rest, got, tt.want)
+		}
+	}
+}
+
+func TestProxyTargetConfig(t *testing.T) {
+	config := &Config{
+		Server:      map[string]interface{}{"quest": "https://q", "bo": "https://b/base"},
+		QuestServer: "https://qs",
+		QuestFront:  "https://front",
+		serverKeys:  []string{"quest", "bo"},
+	}
+	target := proxyTargetConfig(config, 7700)
+	got := renderTarget("var urls = {\n  \"quest\": \"x\",\n  \"bo\": \"x\"\n};", target, "envJs", false)
+	want := "var urls = {\n  \"quest\": \"http://localhost:7700/quest\",\n  \"bo\": \"http://localhost:7700/bo\"\n};"
+	if got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+	if target.QuestServer != "http://localhost:7700/questServer" || target.QuestFront != "https://front" {
+		t.Errorf("questServer %s, questFront %s", target.QuestServer, target.QuestFront)
+	}
+}
+
+func TestEnvProxy(t *testing.T) {
+	// One upstream per env, echoing what it received
+	upstream := func(env string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "%s %s %s", env, r.Method, r.URL.RequestURI())
+		}))
+	}
+	test, stress := upstream("test"), upstream("stress")
+	defer test.Close()
+	defer stress.Close()
+
+	configs := map[string]*Config{
+		"test":   {Server: map[string]interface{}{"quest": test.URL + "/v1"}},
+		"stress": {Server: map[string]interface{}{"quest": stress.URL}},
+	}
+	proxy := &envProxy{
+		load: func(env string) (*Config, error) {
+			if config, ok := configs[env]; ok {
+				return config, nil
+			}
+			return nil, fmt.Errorf("config file not found: config.%s.json", env)
+		},
+		protected: func(env string) bool { return env == "stress" },
+		status:    proxyStatus{App: "The Vault", Port: 7700},
+	}
+	if err := proxy.switchEnv("test"); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	get := func(path string) (int, string) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+	post := func(contentType, body string) int {
+		t.Helper()
+		resp, err := http.Post(server.URL+"/_envswitch/switch", contentType, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if status, body := get("/quest/users?id=1"); status != 200 || body != "test GET /v1/users?id=1" {
+		t.Errorf("test: %d %s", status, body)
+	}
+	if status, body := get("/bo/x"); status != http.StatusBadGateway || !strings.Contains(body, "no 'bo' URL in env test") {
+		t.Errorf("unknown key: %d %s", status, body)
+	}
+
+	if status := post("text/plain", `{"env": "stress"}`); status != http.StatusUnsupportedMediaType {
+		t.Errorf("text/plain switch = %d, want 415", status)
+	}
+	if status := post("application/json", `{"env": "nope"}`); status != http.StatusUnprocessableEntity {
+		t.Errorf("switch to a missing env = %d, want 422", status)
+	}
+	if status := post("application/json", `{"env": "stress"}`); status != http.StatusForbidden {
+		t.Errorf("unconfirmed switch to a protected env = %d, want 403", status)
+	}
+	if status, body := get("/quest/users"); status != 200 || body != "test GET /v1/users" {
+		t.Errorf("after a refused switch: %d %s", status, body)
+	}
+	if status := post("application/json", `{"env": "stress", "confirmProtected": true}`); status != 200 {
+		t.Fatalf("switch = %d", status)
+	}
+	if status, body := get("/quest/users"); status != 200 || body != "stress GET /users" {
+		t.Errorf("after switch: %d %s", status, body)
+	}
+	if status, body := get("/_envswitch/status"); status != 200 || !strings.Contains(body, `"env":"stress"`) || !strings.Contains(body, `"app":"The Vault"`) {
+		t.Errorf("status: %d %s", status, body)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyReplacements(t *testing.T) {
+	config := &Config{
+		Server:      "https://api.example.com",
+		QuestServer: "https://quest.example.com",
+		QuestFront:  "https://front.example.com",
+		Google:      GoogleConf{Recaptcha: "site-key"},
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		isDist  bool
+		want    string
+	}{
+		{
+			name:    "double quotes",
+			content: `baseUrl: "old", questUrl: "old",`,
+			want:    `baseUrl: "https://api.example.com", questUrl: "https://quest.example.com",`,
+		},
+		{
+			name:    "single quotes are kept",
+			content: `baseUrl: 'old', questFront: 'old'`,
+			want:    `baseUrl: 'https://api.example.com', questFront: 'https://front.example.com'`,
+		},
+		{
+			name:    "no trailing comma on the last key",
+			content: "recaptchaApiKey: \"old\",\n    isDist: false\n}",
+			isDist:  true,
+			want:    "recaptchaApiKey: \"site-key\",\n    isDist: true\n}",
+		},
+		{
+			name:    "CRLF line endings",
+			content: "baseUrl: \"old\",\r\nisDist: true\r\n",
+			want:    "baseUrl: \"https://api.example.com\",\r\nisDist: false\r\n",
+		},
+		{
+			name:    "whole keys only",
+			content: `mybaseUrl: "keep", baseUrl: "old"`,
+			want:    `mybaseUrl: "keep", baseUrl: "https://api.example.com"`,
+		},
+		{
+			name:    "escaped quote in the old value",
+			content: `baseUrl: "a\"b", questUrl: "old"`,
+			want:    `baseUrl: "https://api.example.com", questUrl: "https://quest.example.com"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyReplacements(tt.content, config, tt.isDist); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyEnvJsReplacements(t *testing.T) {
+	config := &Config{
+		Server:    map[string]interface{}{"quest": "https://quest.example.com"},
+		WalkmeUrl: "https://walkme.example.com/w.js",
+		Google:    GoogleConf{Recaptcha: "site-key"},
+	}
+	const urls = `var urls = {"quest":"https://quest.example.com"};`
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "minified one-line env.js",
+			content: `var urls = {"quest":"old"}; var recaptchaKey = "old"; var isDist = true; var walkMeUrl= "old"`,
+			want:    urls + ` var recaptchaKey = "site-key"; var isDist = false; var walkMeUrl= "https://walkme.example.com/w.js"`,
+		},
+		{
+			name:    "walkMeUrl before a trailing newline",
+			content: "var walkMeUrl= \"old\"\n",
+			want:    "var walkMeUrl= \"https://walkme.example.com/w.js\"\n",
+		},
+		{
+			name:    "single quotes are kept",
+			content: "var recaptchaKey = 'old';\nvar walkMeUrl = 'old';\n",
+			want:    "var recaptchaKey = 'site-key';\nvar walkMeUrl = 'https://walkme.example.com/w.js';\n",
+		},
+		{
+			name:    "missing semicolons are not added",
+			content: "var recaptchaKey = \"old\"\nvar isDist = true\n",
+			want:    "var recaptchaKey = \"site-key\"\nvar isDist = false\n",
+		},
+		{
+			name:    "braces inside strings and comments",
+			content: "var urls = {\n  \"a\": \"}\", // }\n  \"b\": '{', /* } */\n}; var isDist = true",
+			want:    "var urls = {\n  \"quest\": \"https://quest.example.com\",\n}; var isDist = false",
+		},
+		{
+			name:    "unclosed urls object is left alone",
+			content: "var urls = {\"a\": \"x\"\nvar isDist = true",
+			want:    "var urls = {\"a\": \"x\"\nvar isDist = false",
+		},
+		{
+			name:    "CRLF multi-line urls",
+			content: "var urls = {\r\n  \"quest\": \"old\"\r\n};\r\nvar isDist = true;\r\nvar walkMeUrl= \"old\"\r\n",
+			want:    "var urls = {\r\n  \"quest\": \"https://quest.example.com\"\r\n};\r\nvar isDist = false;\r\nvar walkMeUrl= \"https://walkme.example.com/w.js\"\r\n",
+		},
+		{
+			name:    "values change in place, keeping quotes, comments and layout",
+			content: "var urls = {\n    // API\n    quest: 'old' // trailing\n};",
+			want:    "var urls = {\n    // API\n    quest: 'https://quest.example.com' // trailing\n};",
+		},
+		{
+			name:    "keys missing from the config are dropped",
+			content: "var urls = {\n  \"quest\": \"old\",\n  \"legacy\": \"old\"\n};",
+			want:    "var urls = {\n  \"quest\": \"https://quest.example.com\"\n};",
+		},
+		{
+			name:    "let and const",
+			content: "const urls = {quest: \"old\", bo: `x`}",
+			want:    `const urls = {quest: "https://quest.example.com"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyEnvJsReplacements(tt.content, config, false); got != tt.want {
+				t.Errorf("got\n%q\nwant\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnvJsKeyOrder(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.order.json")
+	data := `{"server": {"vault": "https://v", "quest": "https://q", "bo": "https://b"}}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(config.orderedServerKeys(), ","); got != "vault,quest,bo" {
+		t.Errorf("server keys = %s, want file order vault,quest,bo", got)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "target order first, new keys in config order",
+			content: "var urls = {\n\t'bo': 'x',\n\t'front': 'x',\n\t'quest': 'x'\n};",
+			want:    "var urls = {\n\t'bo': 'https://b',\n\t'quest': 'https://q',\n\t'vault': 'https://v'\n};",
+		},
+		{
+			name:    "CRLF line endings",
+			content: "var urls = {\r\n  \"quest\": \"x\",\r\n  \"front\": \"x\"\r\n};\r\n",
+			want:    "var urls = {\r\n  \"quest\": \"https://q\",\r\n  \"vault\": \"https://v\",\r\n  \"bo\": \"https://b\"\r\n};\r\n",
+		},
+		{
+			name:    "single-line with bare keys and trailing comma",
+			content: "var urls = { quest : 'x', agents : 'x', };",
+			want:    "var urls = { quest : 'https://q', vault : 'https://v', bo : 'https://b', };",
+		},
+		{
+			name:    "empty object gets the config order",
+			content: "var urls = {};",
+			want:    `var urls = {"vault":"https://v","quest":"https://q","bo":"https://b"};`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := applyEnvJsReplacements(tt.content, config, false); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+
+	js := parseJSConfig("module.exports = { server: { tpv: 'https://t', 'quest': \"https://q\" } }")
+	if got := strings.Join(js.orderedServerKeys(), ","); got != "tpv,quest" {
+		t.Errorf("JS server keys = %s, want tpv,quest", got)
+	}
+}
+
+func TestQuoteJS(t *testing.T) {
+	tests := []struct {
+		value string
+		quote byte
+		want  string
+	}{
+		{`plain`, '"', `"plain"`},
+		{`it's`, '\'', `'it\'s'`},
+		{`say "hi"`, '\'', `'say "hi"'`},
+		{`a\b`, '"', `"a\\b"`},
+		{"two\nlines", '"', `"two\nlines"`},
+		{`$1 ${2}`, '"', `"$1 ${2}"`},
+	}
+	for _, tt := range tests {
+		if got := quoteJS(tt.value, tt.quote); got != tt.want {
+			t.Errorf("quoteJS(%q, %c) = %s, want %s", tt.value, tt.quote, got, tt.want)
+		}
+		// What we write reads back as the same value
+		if back := unquoteJS(quoteJS(tt.value, tt.quote)); back != tt.value {
+			t.Errorf("unquoteJS(quoteJS(%q)) = %q", tt.value, back)
+		}
+	}
+}
+
+func TestLoadConfigFromJSEdgeCases(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		check   func(c *Config) string
+		want    string
+	}{
+		{
+			name:    "single and double quotes",
+			content: `server: 'https://a', questServer: "https://b"`,
+			check:   func(c *Config) string { return c.Server.(string) + " " + c.QuestServer },
+			want:    "https://a https://b",
+		},
+		{
+			name:    "quoted keys",
+			content: `{"server": "https://a", 'walkmeUrl': 'https://w'}`,
+			check:   func(c *Config) string { return c.Server.(string) + " " + c.WalkmeUrl },
+			want:    "https://a https://w",
+		},
+		{
+			name:    "questServer is not server",
+			content: "questServer: 'https://q',\nserver: {\n  quest: 'https://sq'\n}",
+			check: func(c *Config) string {
+				return c.QuestServer + " " + c.Server.(map[string]interface{})["quest"].(string)
+			},
+			want: "https://q https://sq",
+		},
+		{
+			name:    "escaped quote inside the value",
+			content: `google: { recaptcha: 'it\'s' }`,
+			check:   func(c *Config) string { return c.Google.Recaptcha },
+			want:    "it's",
+		},
+		{
+			name:    "CRLF line endings",
+			content: "module.exports = function () {\r\n  return {\r\n    server: 'https://a',\r\n    questFront: 'https://f'\r\n  }\r\n}\r\n",
+			check:   func(c *Config) string { return c.Server.(string) + " " + c.QuestFront },
+			want:    "https://a https://f",
+		},
+		{
+			name:    "empty value",
+			content: `server: 'https://a', walkmeUrl: ''`,
+			check:   func(c *Config) string { return "[" + c.WalkmeUrl + "]" },
+			want:    "[]",
+		},
+	}
+
+	dir := t.TempDir()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, "config."+strings.ReplaceAll(tt.name, " ", "_")+".js")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			config, err := LoadConfigFromJS(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.check(config); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,452 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Encrypted values look like "enc:v1:<base64(salt | nonce | AES-GCM ciphertext)>".
+// The AES-256 key is derived from a passphrase with PBKDF2-SHA256.
+const (
+	secretPrefix     = "enc:v1:"
+	secretSaltSize   = 16
+	secretIterations = 100000
+	secretKeyEnvVar  = "ENVSWITCH_SECRET_KEY"
+)
+
+// secretTokenRe finds encrypted values inside config files (JSON or JS)
+var secretTokenRe = regexp.MustCompile(`enc:v1:[A-Za-z0-9+/=]+`)
+
+// derivedKeys caches PBKDF2 output per salt, so configs with many secrets load
+// fast. Profiles switch apps in parallel, hence the lock.
+var (
+	derivedKeys   = make(map[string][]byte)
+	derivedKeysMu sync.Mutex
+)
+
+// getKeyPath returns the path to the default secrets keyfile
+func getKeyPath() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ".envswitch.key"
+	}
+	return filepath.Join(homeDir, ".envswitch.key")
+}
+
+// loadPassphrase returns the secrets passphrase from the given keyfile,
+// $ENVSWITCH_SECRET_KEY or the default keyfile, in that order
+func loadPassphrase(keyFile string) (string, error) {
+	if keyFile == "" {
+		if passphrase := strings.TrimSpace(os.Getenv(secretKeyEnvVar)); passphrase != "" {
+			return passphrase, nil
+		}
+		keyFile = getKeyPath()
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", fmt.Errorf("no secrets key: set $%s or create %s (%v)", secretKeyEnvVar, keyFile, err)
+	}
+	passphrase := strings.TrimSpace(string(data))
+	if passphrase == "" {
+		return "", fmt.Errorf("secrets keyfile %s is empty", keyFile)
+	}
+	return passphrase, nil
+}
+
+// isEncrypted reports whether a config value is an enc:v1: secret
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func deriveKey(passphrase string, salt []byte) ([]byte, error) {
+	cacheKey := passphrase + "\x00" + string(salt)
+	derivedKeysMu.Lock()
+	key, ok := derivedKeys[cacheKey]
+	derivedKeysMu.Unlock()
+	if ok {
+		return key, nil
+	}
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, secretIterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	derivedKeysMu.Lock()
+	derivedKeys[cacheKey] = key
+	derivedKeysMu.Unlock()
+	return key, nil
+}
+
+func newGCM(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptSecret encrypts a plain value into the enc:v1: format
+func encryptSecret(plaintext, passphrase string) (string, error) {
+	salt := make([]byte, secretSaltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return "", err
+	}
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	payload := append(salt, nonce...)
+	payload = gcm.Seal(payload, nonce, []byte(plaintext), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// decryptSecret decrypts an enc:v1: value
+func decryptSecret(value, passphrase string) (string, error) {
+	payload, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted value: %v", err)
+	}
+	if len(payload) < secretSaltSize {
+		return "", fmt.Errorf("malformed encrypted value: too short")
+	}
+
+	salt := payload[:secretSaltSize]
+	gcm, err := newGCM(passphrase, salt)
+	if err != nil {
+		return "", err
+	}
+	rest := payload[secretSaltSize:]
+	if len(rest) < gcm.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted value: too short")
+	}
+
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt (wrong key?)")
+	}
+	return string(plaintext), nil
+}
+
+// decryptConfig replaces every enc:v1: value in the config with its plain text.
+// The key is only looked up when the config actually contains secrets.
+func decryptConfig(config *Config, keyFile string) error {
+	passphrase := ""
+	return mapConfigStrings(config, func(name, value string) (string, error) {
+		if !isEncrypted(value) {
+			return value, nil
+		}
+		if passphrase == "" {
+			var err error
+			if passphrase, err = loadPassphrase(keyFile); err != nil {
+				return "", err
+			}
+		}
+		plain, err := decryptSecret(value, passphrase)
+		if err != nil {
+			return "", fmt.Errorf("%s: %v", name, err)
+		}
+		config.decrypted = append(config.decrypted, plain)
+		return plain, nil
+	})
+}
+
+// defaultSecretFields are masked in all output unless --reveal is given.
+// Apps can mark more fields as secret with "secretFields" in their saved settings.
+var defaultSecretFields = []string{
+	"firebase.apiKey",
+	"firebase.messagingSenderId",
+	"google.mapsKey",
+	"google.recaptcha",
+}
+
+// isSecretField reports whether a config field (JSON path) is marked as secret
+func isSecretField(name string, extra []string) bool {
+	for _, field := range defaultSecretFields {
+		if field == name {
+			return true
+		}
+	}
+	for _, field := range extra {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// secretValues returns the values of secret fields plus every decrypted enc:v1: value
+func (c *Config) secretValues(extraFields []string) []string {
+	values := append([]string{}, c.decrypted...)
+	mapConfigStrings(c, func(name, value string) (string, error) {
+		if value != "" && isSecretField(name, extraFields) {
+			values = append(values, value)
+		}
+		return value, nil
+	})
+	return values
+}
+
+// maskValue shortens a secret to its first 4 and last 3 characters (stre…key)
+func maskValue(value string) string {
+	runes := []rune(value)
+	if len(runes) < 10 {
+		return "****"
+	}
+	return string(runes[:4]) + "…" + string(runes[len(runes)-3:])
+}
+
+// maskSecrets hides the secret values that appear in a line of output. Only
+// whole values are masked: a secret inside a longer word or number ("true"
+// in "untrue", a 6-digit sender id in a longer number) is unrelated text.
+func maskSecrets(line string, secrets []string) string {
+	// Longest first, so a secret containing another one is masked as a whole
+	sorted := append([]string{}, secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, secret := range sorted {
+		if secret == "" {
+			continue
+		}
+		var masked strings.Builder
+		last := 0
+		for start := 0; start < len(line); {
+			i := strings.Index(line[start:], secret)
+			if i < 0 {
+				break
+			}
+			i += start
+			end := i + len(secret)
+			if wholeValue(line, i, end) {
+				masked.WriteString(line[last:i])
+				masked.WriteString(maskValue(secret))
+				last = end
+				start = end
+			} else {
+				start = i + 1
+			}
+		}
+		masked.WriteString(line[last:])
+		line = masked.String()
+	}
+	return line
+}
+
+// wholeValue reports whether line[start:end] isn't part of a longer word:
+// a word character at either edge isn't followed (or preceded) by another
+func wholeValue(line string, start, end int) bool {
+	isWord := func(c byte) bool { return isJSIdentChar(c) || c >= 0x80 }
+	return (start == 0 || !isWord(line[start-1]) || !isWord(line[start])) &&
+		(end == len(line) || !isWord(line[end]) || !isWord(line[end-1]))
+}
+
+// runSecrets implements `envswitch secrets keygen|encrypt|decrypt|rotate`
+func runSecrets(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch secrets keygen|encrypt|decrypt|rotate [flags]"))
+	}
+
+	fs := flag.NewFlagSet("secrets "+args[0], flag.ContinueOnError)
+	keyFile := fs.String("keyfile", "", "Keyfile with the passphrase (default $"+secretKeyEnvVar+" or ~/.envswitch.key)")
+	addOutputFlag(fs)
+
+	switch args[0] {
+	case "keygen":
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return withCode(codeUsage, err)
+		}
+		path := *keyFile
+		if path == "" {
+			path = getKeyPath()
+		}
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("keyfile %s already exists", path)
+		}
+		raw := make([]byte, 32)
+		if _, err := io.ReadFull(rand.Reader, raw); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(raw)+"\n"), 0600); err != nil {
+			return err
+		}
+		return printDone("secrets", "Created keyfile: "+path)
+
+	case "encrypt", "decrypt":
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return withCode(codeUsage, err)
+		}
+		value, err := secretArgOrStdin(fs.Args())
+		if err != nil {
+			return err
+		}
+		passphrase, err := loadPassphrase(*keyFile)
+		if err != nil {
+			return err
+		}
+		var out string
+		if args[0] == "encrypt" {
+			out, err = encryptSecret(value, passphrase)
+		} else {
+			out, err = decryptSecret(value, passphrase)
+		}
+		if err != nil {
+			return err
+		}
+		if jsonOutput() {
+			return printJSON("secrets", secretValueResult{out}, nil, nil)
+		}
+		fmt.Println(out)
+		return nil
+
+	case "rotate":
+		configDir := fs.String("config-dir", "./configs", "Directory containing the config files to re-encrypt")
+		newKeyFile := fs.String("new-keyfile", "", "Keyfile with the new passphrase")
+		newKeyEnv := fs.String("new-key-env", "", "Environment variable holding the new passphrase")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return withCode(codeUsage, err)
+		}
+		oldPassphrase, err := loadPassphrase(*keyFile)
+		if err != nil {
+			return err
+		}
+		var newPassphrase string
+		switch {
+		case *newKeyEnv != "":
+			newPassphrase = strings.TrimSpace(os.Getenv(*newKeyEnv))
+			if newPassphrase == "" {
+				return fmt.Errorf("$%s is empty", *newKeyEnv)
+			}
+		case *newKeyFile != "":
+			if newPassphrase, err = loadPassphrase(*newKeyFile); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("rotate needs --new-keyfile or --new-key-env")
+		}
+		rotated, err := rotateSecrets(*configDir, oldPassphrase, newPassphrase)
+		if jsonOutput() {
+			return printJSON("secrets", secretsRotateResult{rotated}, nil, err)
+		}
+		for _, f := range rotated {
+			fmt.Printf("✓ Rotated %d secret(s) in %s\n", f.Count, f.Path)
+		}
+		return err
+
+	default:
+		return fmt.Errorf("unknown secrets command '%s' (use keygen, encrypt, decrypt or rotate)", args[0])
+	}
+}
+
+// secretValueResult is the --output json result of `secrets encrypt|decrypt`
+type secretValueResult struct {
+	Value string `json:"value"`
+}
+
+// rotatedFile is a config file whose secrets were re-encrypted
+type rotatedFile struct {
+	Path  string `json:"path"`
+	Count int    `json:"count"`
+}
+
+// secretsRotateResult is the --output json result of `secrets rotate`
+type secretsRotateResult struct {
+	Files []rotatedFile `json:"files"`
+}
+
+// secretArgOrStdin returns the single positional value, or reads it from stdin
+func secretArgOrStdin(args []string) (string, error) {
+	if len(args) > 1 {
+		return "", fmt.Errorf("expected a single value")
+	}
+	if len(args) == 1 {
+		return args[0], nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// rotateSecrets re-encrypts every enc:v1: value of the env configs in configDir.
+// Nothing is written unless every secret could be decrypted with the old key.
+// It returns the files written so far.
+func rotateSecrets(configDir, oldPassphrase, newPassphrase string) ([]rotatedFile, error) {
+	type pendingFile struct {
+		rotatedFile
+		content string
+		mode    os.FileMode
+	}
+	var pending []pendingFile
+
+	for _, env := range listEnvs(configDir) {
+		for _, path := range envConfigFiles(configDir, env) {
+			info, err := os.Stat(path)
+			if err != nil {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+
+			count := 0
+			var rotateErr error
+			rotated := secretTokenRe.ReplaceAllStringFunc(string(data), func(token string) string {
+				if rotateErr != nil {
+					return token
+				}
+				plain, err := decryptSecret(token, oldPassphrase)
+				if err != nil {
+					rotateErr = err
+					return token
+				}
+				encrypted, err := encryptSecret(plain, newPassphrase)
+				if err != nil {
+					rotateErr = err
+					return token
+				}
+				count++
+				return encrypted
+			})
+			if rotateErr != nil {
+				return nil, fmt.Errorf("%s: %v", path, rotateErr)
+			}
+			if count == 0 {
+				continue
+			}
+
+			pending = append(pending, pendingFile{rotatedFile{path, count}, rotated, info.Mode().Perm()})
+		}
+	}
+
+	written := make([]rotatedFile, 0, len(pending))
+	for _, f := range pending {
+		if err := os.WriteFile(f.Path, []byte(f.content), f.mode); err != nil {
+			return written, err
+		}
+		written = append(written, f.rotatedFile)
+	}
+	return written, nil
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSecretRoundTrip(t *testing.T) {
+	for _, value := range []string{"site-key", "", "ünïcode ✓", `quotes ' " and \ backslash`} {
+		encrypted, err := encryptSecret(value, "passphrase")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncrypted(encrypted) || !secretTokenRe.MatchString(encrypted) {
+			t.Errorf("%q: not an enc:v1: value: %s", value, encrypted)
+		}
+		plain, err := decryptSecret(encrypted, "passphrase")
+		if err != nil || plain != value {
+			t.Errorf("%q: decrypted to %q (%v)", value, plain, err)
+		}
+	}
+
+	// A new salt and nonce every time
+	a, _ := encryptSecret("same", "passphrase")
+	b, _ := encryptSecret("same", "passphrase")
+	if a == b {
+		t.Error("encrypting the same value twice gave the same output")
+	}
+}
+
+func TestDecryptSecretErrors(t *testing.T) {
+	valid, err := encryptSecret("site-key", "right")
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(valid, secretPrefix))
+	encode := func(b []byte) string { return secretPrefix + base64.StdEncoding.EncodeToString(b) }
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{"wrong key", valid, "wrong key"},
+		{"not base64", "enc:v1:!!!", "malformed encrypted value"},
+		{"shorter than the salt", encode(payload[:secretSaltSize-1]), "too short"},
+		{"no room for the nonce", encode(payload[:secretSaltSize+4]), "too short"},
+		{"truncated ciphertext", encode(payload[:len(payload)-1]), "wrong key"},
+	}
+	for _, tt := range tests {
+		passphrase := "right"
+		if tt.name == "wrong key" {
+			passphrase = "wrong"
+		}
+		if _, err := decryptSecret(tt.value, passphrase); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+// Run with -race: profiles decrypt configs from several goroutines
+func TestDecryptConcurrent(t *testing.T) {
+	values := make([]string, 8)
+	for i := range values {
+		values[i], _ = encryptSecret("site-key", "passphrase")
+	}
+	derivedKeys = make(map[string][]byte) // every goroutine derives its key
+	var wg sync.WaitGroup
+	for _, value := range values {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if plain, err := decryptSecret(value, "passphrase"); err != nil || plain != "site-key" {
+				t.Errorf("decrypted to %q (%v)", plain, err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestLoadPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("HOME", dir)
+	t.Setenv(secretKeyEnvVar, "")
+	keyFile := filepath.Join(dir, "custom.key")
+	os.WriteFile(keyFile, []byte("from-file\n"), 0600)
+
+	if _, err := loadPassphrase(""); err == nil || !strings.Contains(err.Error(), "no secrets key") {
+		t.Errorf("no key anywhere: error = %v", err)
+	}
+	if got, err := loadPassphrase(keyFile); err != nil || got != "from-file" {
+		t.Errorf("keyfile: %q, %v", got, err)
+	}
+
+	os.WriteFile(getKeyPath(), []byte("  \n"), 0600)
+	if _, err := loadPassphrase(""); err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Errorf("empty default keyfile: error = %v", err)
+	}
+
+	t.Setenv(secretKeyEnvVar, " from-env ")
+	if got, err := loadPassphrase(""); err != nil || got != "from-env" {
+		t.Errorf("$%s: %q, %v", secretKeyEnvVar, got, err)
+	}
+	if got, _ := loadPassphrase(keyFile); got != "from-file" {
+		t.Errorf("an explicit keyfile wins over $%s, got %q", secretKeyEnvVar, got)
+	}
+}
+
+func TestRotateSecrets(t *testing.T) {
+	encrypt := func(value, passphrase string) string {
+		encrypted, err := encryptSecret(value, passphrase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return encrypted
+	}
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.prod.json": `{"google": {"recaptcha": "` + encrypt("prod-key", "old") + `"}}`,
+		"config.test.js":   `module.exports = { google: { recaptcha: '` + encrypt("test-key", "old") + `' } };`,
+		"config.cfg.json":  `{"server": "https://cfg.example.com"}`,
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	rotated, err := rotateSecrets(dir, "old", "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rotated) != 2 {
+		t.Errorf("rotated %+v, want the two files with secrets", rotated)
+	}
+	for name, want := range map[string]string{"config.prod.json": "prod-key", "config.test.js": "test-key"} {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		token := secretTokenRe.FindString(string(data))
+		if plain, err := decryptSecret(token, "new"); err != nil || plain != want {
+			t.Errorf("%s: %q, %v with the new key", name, plain, err)
+		}
+	}
+
+	// A secret the old key can't open stops the rotation before anything is written
+	os.WriteFile(filepath.Join(dir, "config.zzz.json"), []byte(`{"google": {"mapsKey": "`+encrypt("x", "other")+`"}}`), 0644)
+	before := make(map[string]string)
+	for name := range files {
+		data, _ := os.ReadFile(filepath.Join(dir, name))
+		before[name] = string(data)
+	}
+	rotated, err = rotateSecrets(dir, "new", "newer")
+	if err == nil || !strings.Contains(err.Error(), "config.zzz.json") {
+		t.Errorf("error = %v, want the file that failed", err)
+	}
+	if len(rotated) != 0 {
+		t.Errorf("rotated %+v after a failure", rotated)
+	}
+	for name, content := range before {
+		if data, _ := os.ReadFile(filepath.Join(dir, name)); string(data) != content {
+			t.Errorf("%s was rewritten although the rotation failed", name)
+		}
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	for _, tt := range []struct{ value, want string }{
+		{"", "****"},
+		{"123456", "****"},
+		{"123456789", "****"},
+		{"stress-recaptcha-site-key", "stre…key"},
+		{"ünïcode-sëcrët", "ünïc…rët"},
+	} {
+		if got := maskValue(tt.value); got != tt.want {
+			t.Errorf("maskValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestMaskSecrets(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		line    string
+		secrets []string
+		want    string
+	}{
+		{"whole value", "stress-recaptcha-site-key", []string{"stress-recaptcha-site-key"}, "stre…key"},
+		{"quoted in a diff", `- recaptchaKey: 'stress-recaptcha-site-key',`, []string{"stress-recaptcha-site-key"}, `- recaptchaKey: 'stre…key',`},
+		{"every occurrence", "123456 and 123456", []string{"123456"}, "**** and ****"},
+		{"in a URL", "https://maps.example.com/js?key=AIzaSyExample123&v=3", []string{"AIzaSyExample123"}, "https://maps.example.com/js?key=AIza…123&v=3"},
+		{"part of a longer number", "messagingSenderId: '1234567890', port 123456", []string{"123456"}, "messagingSenderId: '1234567890', port ****"},
+		{"part of a word", "untrue || true", []string{"true"}, "untrue || ****"},
+		{"part of a non-ASCII word", "clé-sécrétée sécrét", []string{"sécrét"}, "clé-sécrétée ****"},
+		{"edges that aren't word characters", "x=/secret/path/", []string{"/secret/"}, "x=****path/"},
+		{"longest first", "site-key-long-version", []string{"site-key", "site-key-long-version"}, "site…ion"},
+		{"empty secret", "nothing to hide", []string{""}, "nothing to hide"},
+		{"no secrets", "stress-recaptcha-site-key", nil, "stress-recaptcha-site-key"},
+	} {
+		if got := maskSecrets(tt.line, tt.secrets); got != tt.want {
+			t.Errorf("%s: maskSecrets(%q) = %q, want %q", tt.name, tt.line, got, tt.want)
+		}
+	}
+}
+
+// show masks secret fields unless --reveal is given
+func TestShowReveal(t *testing.T) {
+	configDir, _ := filepath.Abs("testdata/configs")
+	t.Chdir(t.TempDir())
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	for _, tt := range []struct {
+		args []string
+		want string
+		not  string
+	}{
+		{[]string{"stress", "--config-dir", configDir}, "stre…key", "stress-recaptcha-site-key"},
+		{[]string{"stress", "--config-dir", configDir, "--reveal"}, "stress-recaptcha-site-key", "stre…key"},
+	} {
+		out, err := captureStdout(t, func() error { return runShow(tt.args) })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(out, tt.want) || strings.Contains(out, tt.not) {
+			t.Errorf("show %v:\n%s", tt.args, out)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+)
+
+// runShow prints the values an env config resolves to, with secrets masked
+func runShow(args []string) error {
+	fs := flag.NewFlagSet("show", flag.ContinueOnError)
+	flags := addEnvFlags(fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	// Allow `envswitch show test` as well as `envswitch show --env test`
+	if *flags.env == "" && len(positional) > 0 {
+		*flags.env = positional[0]
+	}
+	if err := flags.resolve(fs); err != nil {
+		return err
+	}
+	if *flags.env == "" {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch show --env <env> [--app name] [--config-dir dir] [--js] [--reveal]"))
+	}
+
+	configPath := envConfigPath(*flags.configDir, *flags.env, flags.configTypeValue())
+	config, err := loadCommandConfig(configPath, flags.configTypeValue(), *flags.keyFile)
+	if err != nil {
+		return err
+	}
+
+	secrets := flags.secrets(config)
+	entries := configEntries(config)
+	for i := range entries {
+		entries[i].Value = maskSecrets(entries[i].Value, secrets)
+	}
+	if jsonOutput() {
+		return printJSON("show", showResult{*flags.env, configPath, entries}, nil, nil)
+	}
+
+	fmt.Printf("Environment: %s\n", *flags.env)
+	fmt.Printf("Config: %s\n\n", configPath)
+	for _, entry := range entries {
+		fmt.Printf("  %-28s %s\n", entry.Name, entry.Value)
+	}
+	return nil
+}
+
+// showResult is the --output json result of `envswitch show`
+type showResult struct {
+	Env        string        `json:"env"`
+	ConfigPath string        `json:"configPath"`
+	Values     []configEntry `json:"values"`
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Saves take a lock file next to the config; a lock older than
+// configLockStale is left over from a crashed process and is removed
+const (
+	configLockWait  = 5 * time.Second
+	configLockStale = 30 * time.Second
+)
+
+// configVersion is the schema version written to the saved settings file.
+// Bump it together with a new entry in configMigrations.
+const configVersion = 2
+
+// configMigrations[i] upgrades a decoded config file from version i to i+1.
+// Steps work on the raw JSON so they can rename or reshape fields that the
+// current structs no longer have.
+var configMigrations = []func(raw map[string]interface{}) error{
+	migrateLegacyVault, // 0 → 1
+	migrateConfigType,  // 1 → 2
+}
+
+// newerConfigError is returned for a file written by a newer envswitch
+type newerConfigError struct {
+	Version int
+}
+
+func (e *newerConfigError) Error() string {
+	return fmt.Sprintf("config version %d is newer than this envswitch supports (%d); please upgrade", e.Version, configVersion)
+}
+
+// storePath is set by --store and overrides every other config location
+var storePath string
+
+// addStoreFlag registers --store on a flag set
+func addStoreFlag(fs *flag.FlagSet) {
+	fs.StringVar(&storePath, "store", "", "Saved settings file to use (default $ENVSWITCH_CONFIG or $XDG_CONFIG_HOME/envswitch/config.json)")
+}
+
+// getConfigPath returns the path settings are saved to: --store, then
+// $ENVSWITCH_CONFIG, then $XDG_CONFIG_HOME/envswitch/config.json
+// (~/.config/envswitch/config.json when XDG_CONFIG_HOME is unset)
+func getConfigPath() (string, error) {
+	if storePath != "" {
+		return storePath, nil
+	}
+	if path := os.Getenv("ENVSWITCH_CONFIG"); path != "" {
+		return path, nil
+	}
+
+	// The XDG spec says to ignore relative values
+	configHome := os.Getenv("XDG_CONFIG_HOME")
+	if !filepath.IsAbs(configHome) {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("cannot locate the config file (%v); set ENVSWITCH_CONFIG or use --store", err)
+		}
+		configHome = filepath.Join(homeDir, ".config")
+	}
+	return filepath.Join(configHome, "envswitch", "config.json"), nil
+}
+
+// getReadConfigPath returns the path settings are loaded from: the config
+// path, or the legacy ~/.envswitch-config.json until the first save
+func getReadConfigPath() (string, error) {
+	path, err := getConfigPath()
+	if err != nil || storePath != "" || os.Getenv("ENVSWITCH_CONFIG") != "" {
+		return path, err
+	}
+	if _, statErr := os.Stat(path); os.IsNotExist(statErr) {
+		if homeDir, homeErr := os.UserHomeDir(); homeErr == nil {
+			legacy := filepath.Join(homeDir, ".envswitch-config.json")
+			if _, legacyErr := os.Stat(legacy); legacyErr == nil {
+				return legacy, nil
+			}
+		}
+	}
+	return path, nil
+}
+
+// loadPersistentConfig loads the saved configuration, merged with the apps of
+// the repo's .envswitch.yaml (personal entries override workspace fields).
+// A corrupted file is moved aside and reported rather than replaced.
+func loadPersistentConfig() (PersistentConfig, error) {
+	config, err := loadPersonalConfig(true)
+	if err != nil {
+		return config, err
+	}
+	return withWorkspace(config), nil
+}
+
+// peekPersistentConfig is loadPersistentConfig without side effects on a
+// corrupted file, for callers that can't report errors (shell completion)
+func peekPersistentConfig() PersistentConfig {
+	config, err := loadPersonalConfig(false)
+	if err != nil {
+		return config
+	}
+	return withWorkspace(config)
+}
+
+// withWorkspace merges the apps of the repo's .envswitch.yaml, if any
+func withWorkspace(config PersistentConfig) PersistentConfig {
+	if ws, err := findWorkspace(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: ignoring workspace file: %v\n", err)
+	} else if ws != nil {
+		config = ws.merge(config)
+	}
+	return config
+}
+
+// loadPersonalConfig loads the saved settings file and migrates it to the
+// current version. With backupCorrupt, a file that can't be decoded is
+// renamed to <path>.corrupt-<timestamp> so the next save starts fresh.
+func loadPersonalConfig(backupCorrupt bool) (PersistentConfig, error) {
+	empty := PersistentConfig{Version: configVersion, Apps: make(map[string]AppConfig)}
+	path, err := getReadConfigPath()
+	if err != nil {
+		return empty, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return empty, fmt.Errorf("reading %s: %v", path, err)
+	}
+	if err != nil {
+		// No file yet: start from an empty version-0 config so the
+		// migrations seed the defaults
+		data = []byte("{}")
+	}
+
+	config, err := decodePersistentConfig(data)
+	if err == nil {
+		return config, nil
+	}
+	if _, newer := err.(*newerConfigError); newer || !backupCorrupt {
+		return empty, fmt.Errorf("%s: %v", path, err)
+	}
+
+	backup := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if renameErr := os.Rename(path, backup); renameErr != nil {
+		return empty, fmt.Errorf("%s is corrupted (%v) and could not be backed up: %v", path, err, renameErr)
+	}
+	return empty, fmt.Errorf("%s is corrupted (%v); moved it to %s, a fresh config will be created on the next run", path, err, backup)
+}
+
+// decodePersistentConfig parses a config file and runs the pending migrations
+func decodePersistentConfig(data []byte) (PersistentConfig, error) {
+	var config PersistentConfig
+
+	raw := make(map[string]interface{})
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return config, err
+	}
+	if err := migratePersistentConfig(raw); err != nil {
+		return config, err
+	}
+
+	migrated, err := json.Marshal(raw)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(migrated, &config); err != nil {
+		return config, err
+	}
+	if config.Apps == nil {
+		config.Apps = make(map[string]AppConfig)
+	}
+	return config, nil
+}
+
+// migratePersistentConfig upgrades a raw config one version at a time
+func migratePersistentConfig(raw map[string]interface{}) error {
+	version := 0
+	if v, exists := raw["version"]; exists {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n != float64(int(n)) {
+			return fmt.Errorf("invalid version %v", v)
+		}
+		version = int(n)
+	}
+	if version > configVersion {
+		return &newerConfigError{Version: version}
+	}
+
+	for ; version < configVersion; version++ {
+		if err := configMigrations[version](raw); err != nil {
+			return fmt.Errorf("migrating to version %d: %v", version+1, err)
+		}
+	}
+	raw["version"] = configVersion
+	return nil
+}
+
+// migrateLegacyVault upgrades unversioned files: a missing app list gets the
+// default "The Vault" app, and "The Vault" is switched to JS configs (it was
+// forced on every load before versioning, so it can be changed from now on)
+func migrateLegacyVault(raw map[string]interface{}) error {
+	if raw["apps"] == nil {
+		raw["apps"] = map[string]interface{}{
+			"The Vault": map[string]interface{}{"useJS": true},
+		}
+		return nil
+	}
+
+	apps, ok := raw["apps"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("apps: expected an object")
+	}
+	if vault, ok := apps["The Vault"].(map[string]interface{}); ok {
+		vault["useJS"] = true
+	}
+	return nil
+}
+
+// migrateConfigType replaces the useJS flag of every app with a config type:
+// "js" for apps that used JS configs, auto (no field) for the others
+func migrateConfigType(raw map[string]interface{}) error {
+	apps, ok := raw["apps"].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	for _, value := range apps {
+		app, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if useJS, _ := app["useJS"].(bool); useJS {
+			app["configType"] = "js"
+		}
+		delete(app, "useJS")
+	}
+	return nil
+}
+
+// updatePersistentConfig reloads the saved settings under a lock, applies
+// change and saves the result, so concurrent sessions (several TUIs, a watch
+// and a profile run) don't overwrite each other's updates. It returns the
+// saved config, merged with the workspace like loadPersistentConfig.
+func updatePersistentConfig(change func(config *PersistentConfig) error) (PersistentConfig, error) {
+	path, err := getConfigPath()
+	if err != nil {
+		return PersistentConfig{}, err
+	}
+	unlock, err := lockConfig(path)
+	if err != nil {
+		return PersistentConfig{}, err
+	}
+	defer unlock()
+
+	config, err := loadPersistentConfig()
+	if err != nil {
+		return config, err
+	}
+	if err := change(&config); err != nil {
+		return config, err
+	}
+	return config, savePersistentConfig(config)
+}
+
+// lockConfig takes <path>.lock, waiting for another envswitch to release it
+func lockConfig(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	lockPath := path + ".lock"
+	deadline := time.Now().Add(configLockWait)
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			mine, err := f.Stat()
+			f.Close()
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, err
+			}
+			return func() {
+				// A lock held past configLockStale may have been taken over
+				if info, err := os.Stat(lockPath); err == nil && sameLock(info, mine) {
+					os.Remove(lockPath)
+				}
+			}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if info, statErr := os.Stat(lockPath); statErr == nil && time.Since(info.ModTime()) > configLockStale {
+			takeOverLock(lockPath, info)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s is locked by another envswitch (remove %s if none is running)", path, lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// takeOverLock removes a lock found stale. Another envswitch may have taken
+// it over first and locked again, so the lock is renamed aside (only one
+// rename wins) and put back when it isn't the stale one.
+func takeOverLock(lockPath string, stale os.FileInfo) {
+	aside := fmt.Sprintf("%s.stale-%d-%d", lockPath, os.Getpid(), time.Now().UnixNano())
+	if err := os.Rename(lockPath, aside); err != nil {
+		return
+	}
+	if info, err := os.Stat(aside); err == nil && !sameLock(info, stale) {
+		// A live lock: link doesn't replace a lock taken in the meantime
+		os.Link(aside, lockPath)
+	}
+	os.Remove(aside)
+}
+
+// sameLock reports whether two stats are of the same lock file (the inode of
+// a removed lock can be reused by the next one, its time can't)
+func sameLock(a, b os.FileInfo) bool {
+	return os.SameFile(a, b) && a.ModTime().Equal(b.ModTime())
+}
+
+// savePersistentConfig saves the configuration to disk. Workspace apps are
+// reduced to the personal overrides (and last-used env).
+func savePersistentConfig(config PersistentConfig) error {
+	if ws, err := findWorkspace(); err == nil && ws != nil {
+		config = ws.strip(config)
+	}
+	config.Version = configVersion
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	path, err := getConfigPath()
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+// writeFileAtomic writes an owner-only file (it may hold secret settings)
+// through a temp file and a rename, so readers never see a partial file
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
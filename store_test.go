@@ -0,0 +1,241 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPersonalConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		file    string // saved settings; empty for no file
+		err     string // substring of the error; empty for success
+		corrupt bool   // the file is moved to <path>.corrupt-<ts>
+		check   func(t *testing.T, config PersistentConfig)
+	}{
+		{
+			name: "no file",
+			check: func(t *testing.T, config PersistentConfig) {
+				if config.Apps["The Vault"].ConfigType != "js" {
+					t.Errorf("default app = %+v", config.Apps["The Vault"])
+				}
+			},
+		},
+		{
+			name: "v0 to v2",
+			file: `{"apps": {"The Vault": {"configDir": "/vault/configs"}, "Backoffice": {"configDir": "/bo/configs", "useJS": true}, "Front": {"configDir": "/front/configs"}}}`,
+			check: func(t *testing.T, config PersistentConfig) {
+				if config.Version != configVersion {
+					t.Errorf("version = %d, want %d", config.Version, configVersion)
+				}
+				vault, bo, front := config.Apps["The Vault"], config.Apps["Backoffice"], config.Apps["Front"]
+				if vault.ConfigType != "js" || vault.ConfigDir != "/vault/configs" {
+					t.Errorf("The Vault = %+v", vault)
+				}
+				if bo.ConfigType != "js" || front.ConfigType != "" {
+					t.Errorf("useJS not replaced: Backoffice = %q, Front = %q", bo.ConfigType, front.ConfigType)
+				}
+			},
+		},
+		{
+			// The Vault is only forced to JS configs by the v0 migration
+			name: "v1 to v2",
+			file: `{"version": 1, "apps": {"The Vault": {"configDir": "/vault/configs"}}}`,
+			check: func(t *testing.T, config PersistentConfig) {
+				if app := config.Apps["The Vault"]; app.ConfigType != "" || app.ConfigDir != "/vault/configs" {
+					t.Errorf("The Vault = %+v", app)
+				}
+			},
+		},
+		{
+			name: "current",
+			file: `{"version": 2, "apps": {"Front": {"configDir": "/front/configs", "configType": "yaml"}}}`,
+			check: func(t *testing.T, config PersistentConfig) {
+				if len(config.Apps) != 1 || config.Apps["Front"].ConfigType != "yaml" {
+					t.Errorf("apps = %+v", config.Apps)
+				}
+			},
+		},
+		{name: "version as a string", file: `{"version": "2", "apps": {}}`, err: "invalid version 2", corrupt: true},
+		{name: "negative version", file: `{"version": -1, "apps": {}}`, err: "invalid version -1", corrupt: true},
+		{name: "fractional version", file: `{"version": 1.5, "apps": {}}`, err: "invalid version 1.5", corrupt: true},
+		{name: "apps not an object", file: `{"apps": ["The Vault"]}`, err: "migrating to version 1", corrupt: true},
+		{name: "corrupted", file: `{"version": 2, "apps": {`, err: "is corrupted", corrupt: true},
+		{name: "newer", file: `{"version": 3, "apps": {}}`, err: "please upgrade"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "config.json")
+			t.Setenv("ENVSWITCH_CONFIG", path)
+			if tt.file != "" {
+				os.WriteFile(path, []byte(tt.file), 0644)
+			}
+
+			config, err := loadPersonalConfig(true)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				tt.check(t, config)
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("err = %v, want %q", err, tt.err)
+			}
+			if config.Version != configVersion || len(config.Apps) != 0 {
+				t.Errorf("config after an error = %+v, want an empty one", config)
+			}
+
+			backups, _ := filepath.Glob(path + ".corrupt-*")
+			if !tt.corrupt {
+				if len(backups) != 0 {
+					t.Errorf("backed up %v", backups)
+				}
+				if data, _ := os.ReadFile(path); string(data) != tt.file {
+					t.Errorf("file changed to %q", data)
+				}
+				return
+			}
+			if len(backups) != 1 || !strings.Contains(err.Error(), backups[0]) {
+				t.Fatalf("backups = %v, err = %v", backups, err)
+			}
+			if data, _ := os.ReadFile(backups[0]); string(data) != tt.file {
+				t.Errorf("backup = %q", data)
+			}
+			if _, err := os.Stat(path); !os.IsNotExist(err) {
+				t.Errorf("corrupted file left in place: %v", err)
+			}
+		})
+	}
+}
+
+func TestNewerConfigRefused(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := filepath.Join(dir, "config.json")
+	t.Setenv("ENVSWITCH_CONFIG", path)
+	os.WriteFile(path, []byte(`{"version": 99, "apps": {}}`), 0644)
+
+	var newer *newerConfigError
+	if _, err := decodePersistentConfig([]byte(`{"version": 99}`)); !errors.As(err, &newer) || newer.Version != 99 {
+		t.Errorf("decode: err = %v, want a newerConfigError", err)
+	}
+	// A save must not overwrite what a newer envswitch wrote
+	_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+		t.Error("change called for a newer file")
+		return nil
+	})
+	if err == nil {
+		t.Fatal("update of a newer file succeeded")
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), `"version": 99`) {
+		t.Errorf("file overwritten: %s", data)
+	}
+}
+
+// Sessions saving at the same time each keep their update
+func TestUpdatePersistentConfigConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	t.Chdir(dir)
+	path := filepath.Join(dir, "config.json")
+	t.Setenv("ENVSWITCH_CONFIG", path)
+
+	const sessions = 8
+	errs := make(chan error, sessions)
+	for i := range sessions {
+		go func() {
+			_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+				config.Apps[fmt.Sprintf("App %d", i)] = AppConfig{LastEnv: "stress"}
+				return nil
+			})
+			errs <- err
+		}()
+	}
+	for range sessions {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	config, err := loadPersonalConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sessions {
+		if app, exists := config.Apps[fmt.Sprintf("App %d", i)]; !exists || app.LastEnv != "stress" {
+			t.Errorf("App %d lost: %+v", i, config.Apps)
+		}
+	}
+	if _, err := os.Stat(path + ".lock"); !os.IsNotExist(err) {
+		t.Errorf("lock left behind: %v", err)
+	}
+}
+
+// A lock older than configLockStale is from a crashed process: it is taken over
+func TestLockConfigStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	lockPath := path + ".lock"
+	os.WriteFile(lockPath, nil, 0600)
+	old := time.Now().Add(-configLockStale - time.Minute)
+	os.Chtimes(lockPath, old, old)
+
+	start := time.Now()
+	unlock, err := lockConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > configLockWait/2 {
+		t.Errorf("waited %v for a stale lock", waited)
+	}
+	if info, err := os.Stat(lockPath); err != nil || !info.ModTime().After(old) {
+		t.Errorf("lock not taken over: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(lockPath); !os.IsNotExist(err) {
+		t.Errorf("unlock left the lock: %v", err)
+	}
+}
+
+// Two sessions can find the same stale lock: the one that comes second must
+// not remove the lock the first took since
+func TestLockConfigStaleRace(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	lockPath := path + ".lock"
+	os.WriteFile(lockPath, nil, 0600)
+	old := time.Now().Add(-configLockStale - time.Minute)
+	os.Chtimes(lockPath, old, old)
+	stale, err := os.Stat(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first session takes over and locks
+	os.Remove(lockPath)
+	unlock, err := lockConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The second one acts on what it saw before
+	takeOverLock(lockPath, stale)
+	if info, err := os.Stat(lockPath); err != nil || !info.ModTime().After(old) {
+		t.Fatalf("the live lock was removed: %v", err)
+	}
+	if leftovers, _ := filepath.Glob(lockPath + ".stale-*"); len(leftovers) != 0 {
+		t.Errorf("left %v", leftovers)
+	}
+
+	// A session whose lock was taken over doesn't remove the new one
+	os.Remove(lockPath)
+	os.WriteFile(lockPath, nil, 0600)
+	other := time.Now().Add(time.Minute)
+	os.Chtimes(lockPath, other, other)
+	unlock()
+	if _, err := os.Stat(lockPath); err != nil {
+		t.Errorf("unlock removed another session's lock: %v", err)
+	}
+}
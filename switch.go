@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// targetFormats lists the formats of --format
+var targetFormats = []string{"serverConfig", "envJs"}
+
+// switchOptions describes one environment switch, from the CLI or the TUI
+type switchOptions struct {
+	ConfigDir  string
+	TargetPath string
+	Env        string
+	ConfigType string // auto, json, js, js-eval, yaml or toml
+	Format     string // "serverConfig" or "envJs"
+	Template   string // renders the whole target instead of the format's rules
+	IsDist     bool
+	KeyFile    string
+	Hooks      hookConfig
+	Output     io.Writer // hook output (default stdout)
+	App        string    // saved app, for the audit log
+	Source     string    // cli, tui, profile or watch (default cli)
+
+	// Protected envs are only switched to with ConfirmProtected (typed in the
+	// TUI, --yes-i-mean-prod in the CLI); see protected.go
+	ProtectedEnvs    []string
+	ConfirmProtected bool
+}
+
+// switchPlan is an env config applied to the target in memory, not yet written
+type switchPlan struct {
+	ConfigPath string
+	Config     *Config
+	Original   string
+	Result     string
+	Matches    []ruleMatch
+	Created    bool // the target doesn't exist yet (templates only)
+	Protected  bool // the env is protected; Result carries the warning comment
+}
+
+// planSwitch loads the env config and applies it to the target content
+func planSwitch(opts switchOptions) (*switchPlan, error) {
+	configPath := envConfigPath(opts.ConfigDir, opts.Env, opts.ConfigType)
+
+	config, err := loadCommandConfig(configPath, opts.ConfigType, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Template != "" {
+		plan, err := planTemplate(opts, configPath, config)
+		if err != nil {
+			return nil, err
+		}
+		plan.protect(opts)
+		return plan, nil
+	}
+
+	if opts.Format != "" && !slices.Contains(targetFormats, opts.Format) {
+		return nil, withCode(codeValidationFailed, fmt.Errorf("unknown format '%s' (use %s)", opts.Format, strings.Join(targetFormats, " or ")))
+	}
+
+	// Check if target file exists
+	if _, statErr := os.Stat(opts.TargetPath); os.IsNotExist(statErr) {
+		return nil, withCode(codeTargetMissing, fmt.Errorf("target file not found: %s", opts.TargetPath))
+	}
+
+	content, err := os.ReadFile(opts.TargetPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading target file %s: %v", opts.TargetPath, err)
+	}
+
+	plan := &switchPlan{
+		ConfigPath: configPath,
+		Config:     config,
+		Original:   string(content),
+		Result:     renderTarget(string(content), config, opts.Format, opts.IsDist),
+		Matches:    matchRules(string(content), config, opts.Format, opts.IsDist),
+	}
+	plan.protect(opts)
+
+	// Nothing matched: most likely the wrong target or --format
+	total := 0
+	for _, m := range plan.Matches {
+		total += m.Matches
+	}
+	if total == 0 {
+		format := opts.Format
+		if format == "" {
+			format = "serverConfig"
+		}
+		return plan, withCode(codeNoMatch, fmt.Errorf("no %s rule matched %s (is the format right?)", format, opts.TargetPath))
+	}
+	return plan, nil
+}
+
+// protect flags a plan for a protected env and puts the warning comment at
+// the top of its result; for any other env it takes an old warning out
+func (p *switchPlan) protect(opts switchOptions) {
+	p.Protected = isProtected(p.Config, opts.Env, opts.ProtectedEnvs)
+	p.Result = markProtected(p.Result, opts.TargetPath, opts.Env, p.Protected)
+}
+
+// ruleMatch is how often one replacement rule matched the target
+type ruleMatch struct {
+	Rule    string `json:"rule"`
+	Matches int    `json:"matches"`
+}
+
+// matchRules reports how often each rule of the format matches content
+func matchRules(content string, config *Config, format string, isDist bool) []ruleMatch {
+	var replacements []Replacement
+	matches := make([]ruleMatch, 0)
+	if format == "envJs" {
+		found := 0
+		tokens, _ := tokenizeJS(content)
+		if _, close := findVarObject(skipComments(tokens), "urls"); close >= 0 {
+			found = 1
+		}
+		matches = append(matches, ruleMatch{"urls", found})
+		replacements = envJsReplacements(config, isDist)
+	} else {
+		replacements = serverConfigReplacements(config, isDist)
+	}
+	for _, r := range replacements {
+		matches = append(matches, ruleMatch{r.Name, len(r.Pattern.FindAllStringIndex(content, -1))})
+	}
+	return matches
+}
+
+// diffLine is a changed line of a target; Old or New is nil for a line that
+// was only removed or only added. Line counts in the new target, or in the
+// original for a removed line.
+type diffLine struct {
+	Line int     `json:"line"`
+	Old  *string `json:"old,omitempty"`
+	New  *string `json:"new,omitempty"`
+}
+
+// diffMaxCells bounds the LCS table of diffLines; past it the changed middle
+// is reported as removed and added as a whole
+const diffMaxCells = 4 << 20
+
+// diffLines compares two versions of a target line by line, masking secrets.
+// Lines are matched by a longest common subsequence, so a line inserted at the
+// top (like a protected env warning) doesn't shift every line after it. A run
+// of removed lines followed by added ones pairs up into changed lines.
+func diffLines(original, modified string, secrets []string) []diffLine {
+	origLines := strings.Split(original, "\n")
+	modLines := strings.Split(modified, "\n")
+
+	// Only the middle between the common head and tail needs the LCS table
+	head := 0
+	for head < len(origLines) && head < len(modLines) && origLines[head] == modLines[head] {
+		head++
+	}
+	tail := 0
+	for tail < len(origLines)-head && tail < len(modLines)-head && origLines[len(origLines)-1-tail] == modLines[len(modLines)-1-tail] {
+		tail++
+	}
+	a, b := origLines[head:len(origLines)-tail], modLines[head:len(modLines)-tail]
+
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	var lcs [][]int
+	if (len(a)+1)*(len(b)+1) <= diffMaxCells {
+		lcs = make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if a[i] == b[j] {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+	}
+
+	diff := make([]diffLine, 0)
+	var removed, added []int // indexes into a and b of the current run
+	flush := func() {
+		for k := 0; k < len(removed) || k < len(added); k++ {
+			var line diffLine
+			if k < len(removed) {
+				old := maskSecrets(a[removed[k]], secrets)
+				line.Old, line.Line = &old, head+removed[k]+1
+			}
+			if k < len(added) {
+				updated := maskSecrets(b[added[k]], secrets)
+				line.New, line.Line = &updated, head+added[k]+1
+			}
+			diff = append(diff, line)
+		}
+		removed, added = removed[:0], added[:0]
+	}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case lcs != nil && i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			i++
+			j++
+		case j == len(b) || i < len(a) && (lcs == nil || lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, i)
+			i++
+		default:
+			added = append(added, j)
+			j++
+		}
+	}
+	flush()
+	return diff
+}
+
+// renderTarget applies a config to target content in the given format
+func renderTarget(content string, config *Config, format string, isDist bool) string {
+	switch format {
+	case "envJs":
+		return applyEnvJsReplacements(content, config, isDist)
+	default: // "serverConfig"
+		return applyReplacements(content, config, isDist)
+	}
+}
+
+// executeSwitch writes the planned target between the pre- and post-switch hooks.
+// A failing pre-switch hook aborts before anything is written; a failing
+// post-switch hook restores the original target when RollbackOnFailure is set.
+// Every written target is recorded in the app's audit log. Protected envs are
+// refused unless the switch is confirmed.
+func executeSwitch(opts switchOptions) (*switchPlan, error) {
+	plan, err := planSwitch(opts)
+	if err != nil {
+		return nil, err
+	}
+	return plan, executePlan(opts, plan)
+}
+
+// executePlan carries out a switch planned by planSwitch (see executeSwitch)
+func executePlan(opts switchOptions, plan *switchPlan) error {
+	if plan.Protected && !opts.ConfirmProtected {
+		return protectedError(opts.Env)
+	}
+
+	if opts.Hooks.Untrusted != "" {
+		warnUntrustedHooks(opts)
+	}
+	if err := runHooks("pre-switch", opts.Hooks.PreSwitch, opts.Hooks.Timeout, opts, plan.ConfigPath); err != nil {
+		return withCode(codeHookFailed, fmt.Errorf("%v (switch aborted)", err))
+	}
+
+	if plan.Created {
+		if err := os.MkdirAll(filepath.Dir(opts.TargetPath), 0755); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(opts.TargetPath, []byte(plan.Result), 0644); err != nil {
+		return fmt.Errorf("writing target file %s: %v", opts.TargetPath, err)
+	}
+
+	after := plan.Result
+	err := runHooks("post-switch", opts.Hooks.PostSwitch, opts.Hooks.Timeout, opts, plan.ConfigPath)
+	if err != nil {
+		if !opts.Hooks.RollbackOnFailure {
+			err = withCode(codeHookFailed, err)
+		} else if rbErr := restoreTarget(opts.TargetPath, plan); rbErr != nil {
+			err = withCode(codeHookFailed, fmt.Errorf("%v; rollback failed: %v", err, rbErr))
+		} else {
+			after = plan.Original
+			err = withCode(codeHookFailed, fmt.Errorf("%v (target rolled back)", err))
+		}
+	}
+
+	auditSwitch(opts, plan, after, err)
+	return err
+}
+
+// restoreTarget puts back the target a switch replaced (or removes the one it created)
+func restoreTarget(path string, plan *switchPlan) error {
+	if plan.Created {
+		return os.Remove(path)
+	}
+	return os.WriteFile(path, []byte(plan.Original), 0644)
+}
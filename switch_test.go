@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffLines(t *testing.T) {
+	for _, tt := range []struct {
+		name, original, modified string
+		want                     []string // "line: -old +new"
+	}{
+		{"same", "a\nb", "a\nb", nil},
+		{"changed", "a\nb\nc", "a\nB\nc", []string{"2: -b +B"}},
+		{"inserted at the top", "a\nb\nc", "new\na\nb\nc", []string{"1: +new"}},
+		{"removed", "a\nb\nc", "a\nc", []string{"2: -b"}},
+		{"inserted and changed", "a\nb\nc", "new\na\nB\nc", []string{"1: +new", "3: -b +B"}},
+		{"more added than removed", "a\nb\nz", "a\nB\nC\nz", []string{"2: -b +B", "3: +C"}},
+		{"appended", "a", "a\nb\n", []string{"2: +b", "3: +"}},
+		{"emptied", "a\nb", "", []string{"1: -a +", "2: -b"}},
+	} {
+		got := make([]string, 0)
+		for _, line := range diffLines(tt.original, tt.modified, nil) {
+			s := fmt.Sprintf("%d:", line.Line)
+			if line.Old != nil {
+				s += " -" + *line.Old
+			}
+			if line.New != nil {
+				s += " +" + *line.New
+			}
+			got = append(got, s)
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("%s: diff = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Secrets are masked on both sides
+	diff := diffLines("key: 'test-maps-key-1'", "key: 'stress-maps-key-2'", []string{"test-maps-key-1", "stress-maps-key-2"})
+	if len(diff) != 1 || strings.Contains(*diff[0].Old, "maps-key-1") || strings.Contains(*diff[0].New, "maps-key-2") {
+		t.Errorf("masked diff = %+v", diff)
+	}
+
+	// Past diffMaxCells, the changed middle is paired up line by line
+	var before, after []string
+	for i := range 2100 {
+		before = append(before, fmt.Sprintf("old %d", i))
+		after = append(after, fmt.Sprintf("new %d", i))
+	}
+	diff = diffLines("head\n"+strings.Join(before, "\n"), "head\n"+strings.Join(after, "\n"), nil)
+	if len(diff) != 2100 || diff[0].Line != 2 || *diff[0].Old != "old 0" || *diff[0].New != "new 0" {
+		t.Errorf("large diff: %d lines, first %+v", len(diff), diff[0])
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// serverURL is one entry of the server object, as listed by the urls helper
+type serverURL struct {
+	Key string
+	URL string
+}
+
+// templateFuncs are the helpers target templates can call
+func templateFuncs(config *Config) template.FuncMap {
+	return template.FuncMap{
+		// jsQuote renders a value as a double-quoted JS string
+		"jsQuote": func(value interface{}) string {
+			if value == nil {
+				value = ""
+			}
+			return quoteJS(fmt.Sprint(value), '"')
+		},
+		// json renders a value as JSON (objects come out with sorted keys)
+		"json": func(value interface{}) (string, error) {
+			data, err := json.Marshal(value)
+			return string(data), err
+		},
+		// default returns value, or fallback when value is missing or empty
+		"default": func(fallback, value interface{}) interface{} {
+			if value == nil || reflect.ValueOf(value).IsZero() {
+				return fallback
+			}
+			return value
+		},
+		// urls lists the server object in the order of the config file
+		"urls": func() []serverURL {
+			values, _ := config.Server.(map[string]interface{})
+			urls := make([]serverURL, 0, len(values))
+			for _, key := range config.orderedServerKeys() {
+				urls = append(urls, serverURL{key, fmt.Sprint(values[key])})
+			}
+			return urls
+		},
+	}
+}
+
+// templateData is the config tree a template renders: the fields of the
+// config file (server, questServer, firebase.apiKey, ...) plus env and isDist
+func templateData(config *Config, env string, isDist bool) (map[string]interface{}, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(map[string]interface{})
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	tree["env"] = env
+	tree["isDist"] = isDist
+	return tree, nil
+}
+
+// renderTemplate renders a target template with an env config. A key the
+// config doesn't have is an error (look it up with index to allow that).
+func renderTemplate(path string, config *Config, env string, isDist bool) (string, error) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return "", withCode(codeValidationFailed, fmt.Errorf("reading template: %v", err))
+	}
+	tmpl, err := template.New(path).Funcs(templateFuncs(config)).Option("missingkey=error").Parse(string(source))
+	if err != nil {
+		return "", withCode(codeValidationFailed, err)
+	}
+	data, err := templateData(config, env, isDist)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		if strings.Contains(err.Error(), "map has no entry for key") {
+			err = fmt.Errorf("%v in the %s config (use index for keys it may not have)", err, env)
+		}
+		return "", withCode(codeValidationFailed, err)
+	}
+	return out.String(), nil
+}
+
+// planTemplate renders the whole target from a template. Unlike the rules,
+// it doesn't need an existing target: a missing one is created.
+func planTemplate(opts switchOptions, configPath string, config *Config) (*switchPlan, error) {
+	plan := &switchPlan{ConfigPath: configPath, Config: config}
+	content, err := os.ReadFile(opts.TargetPath)
+	switch {
+	case os.IsNotExist(err):
+		plan.Created = true
+	case err != nil:
+		return nil, fmt.Errorf("reading target file %s: %v", opts.TargetPath, err)
+	}
+	plan.Original = string(content)
+
+	plan.Result, err = renderTemplate(opts.Template, config, opts.Env, opts.IsDist)
+	if err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTemplateSwitch(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(dir, "config.json"))
+	target := filepath.Join(dir, "app", "env.js")
+	opts := switchOptions{
+		ConfigDir:  testConfigDir,
+		TargetPath: target,
+		Env:        "stress",
+		Template:   filepath.Join(testTemplateDir, "env.js.tmpl"),
+	}
+
+	// The target doesn't exist yet
+	plan, err := executeSwitch(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !plan.Created || plan.Original != "" {
+		t.Errorf("plan of a new target: created %v, original %q", plan.Created, plan.Original)
+	}
+	written, err := os.ReadFile(target)
+	if err != nil || !strings.Contains(string(written), `"quest": "https://stress-quest.example.com/api",`) {
+		t.Errorf("target not generated: %v\n%s", err, written)
+	}
+
+	// A rolled-back switch removes the target it created
+	os.Remove(target)
+	opts.Hooks = hookConfig{PostSwitch: []string{"exit 1"}, Timeout: defaultHookTimeout, RollbackOnFailure: true}
+	opts.Output = &strings.Builder{}
+	if _, err := executeSwitch(opts); errorCode(err) != codeHookFailed {
+		t.Fatalf("err = %v, want a hook failure", err)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Errorf("rollback left the created target behind: %v", err)
+	}
+}
+
+func TestTemplateMissingValue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "broken.tmpl")
+	os.WriteFile(path, []byte("var a = 1;\nvar b = {{.google.nope}};\n"), 0644)
+	_, err := renderTemplate(path, loadTestEnv(t, "test"), "test", false)
+	if errorCode(err) != codeValidationFailed || !strings.Contains(err.Error(), "broken.tmpl:2:") || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("err = %v, want a validation error on line 2", err)
+	}
+
+	// index allows a missing key, and output that happens to read "<no value>" is fine
+	os.WriteFile(path, []byte(`{{default "none" (index . "nope")}} <no value>`), 0644)
+	if got, err := renderTemplate(path, loadTestEnv(t, "test"), "test", false); err != nil || got != "none <no value>" {
+		t.Errorf("got %q, %v", got, err)
+	}
+}
+
+func TestTemplateGitGuard(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	repo := t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(t.TempDir(), "config.json"))
+	if _, err := gitOutput(repo, "init", "-q"); err != nil {
+		t.Fatal(err)
+	}
+	target := filepath.Join(repo, "env.js")
+	app := AppConfig{ConfigDir: testConfigDir, TargetPath: target, Template: filepath.Join(testTemplateDir, "env.js.tmpl"), DefaultEnv: "test"}
+	if err := savePersistentConfig(PersistentConfig{Apps: map[string]AppConfig{"Vault": app}}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, env := range []string{"test", "stress"} {
+		opts := switchOptions{ConfigDir: app.ConfigDir, TargetPath: target, Env: env, Template: app.Template}
+		if _, err := executeSwitch(opts); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := gitOutput(repo, "add", "env.js"); err != nil {
+			t.Fatal(err)
+		}
+		err := checkGitGuard(repo)
+		if env == "test" && err != nil {
+			t.Errorf("rendered from the default env: %v", err)
+		}
+		if env == "stress" && (err == nil || !strings.Contains(err.Error(), "not on its default env 'test'")) {
+			t.Errorf("rendered from stress: error = %v", err)
+		}
+	}
+}
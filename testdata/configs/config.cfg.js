@@ -0,0 +1,23 @@
+'use strict';
+
+// Gulp config for the cfg environment
+module.exports = function () {
+    return {
+        server: 'https://cfg-api.example.com',
+        questServer: 'https://cfg-quest.example.com',
+        questFront: "https://cfg-front.example.com",
+        firebase: {
+            apiKey: 'cfg-firebase-api-key',
+            authDomain: 'cfg-app.firebaseapp.com',
+            databaseURL: 'https://cfg-app.firebaseio.com',
+            storageBucket: 'cfg-app.appspot.com',
+            messaginSenderId: '555555555'
+        },
+        google: {
+            mapsKey: 'cfg-maps-key',
+            analytics: 'UA-CFG-1',
+            recaptcha: 'cfg-recaptcha-site-key'
+        },
+        walkmeUrl: 'https://cdn.walkme.com/users/cfg/walkme_cfg.js'
+    };
+};
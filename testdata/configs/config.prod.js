@@ -0,0 +1,18 @@
+module.exports = function () {
+    return {
+        server: {
+            quest: 'https://quest.example.com/api',
+            agents: 'https://agents.example.com',
+            bo: 'https://bo.example.com',
+            tpv: 'https://tpv.example.com',
+            vault: 'https://vault.example.com',
+            front: 'https://www.example.com'
+        },
+        questServer: 'https://quest.example.com',
+        questFront: 'https://front.example.com',
+        google: {
+            recaptcha: 'prod-recaptcha-site-key'
+        },
+        walkmeUrl: 'https://cdn.walkme.com/users/prod/walkme_prod.js'
+    }
+}
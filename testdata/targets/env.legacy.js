@@ -0,0 +1,9 @@
+/* Generated by gulp - switch with envswitch */
+var urls = {
+  quest: 'http://localhost:3000/api', // API gateway
+  front: 'http://localhost:8080',
+  legacy: 'http://localhost:9999',
+};
+var recaptchaKey = 'local-recaptcha-site-key';
+var isDist = false;
+var walkMeUrl = 'https://cdn.walkme.com/users/local/walkme_local.js';
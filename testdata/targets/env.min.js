@@ -0,0 +1 @@
+var urls = {"quest":"http://localhost:3000/api","agents":"http://localhost:3001","bo":"http://localhost:3002","tpv":"http://localhost:3003","vault":"http://localhost:3004","front":"http://localhost:8080"}; var recaptchaKey = "local-recaptcha-site-key"; var isDist = false; var walkMeUrl= "https://cdn.walkme.com/users/local/walkme_local.js"
\ No newline at end of file
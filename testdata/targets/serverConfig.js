@@ -0,0 +1,15 @@
+(function () {
+    'use strict';
+
+    angular.module('theVault').factory('serverConfig', serverConfig);
+
+    function serverConfig() {
+        return {
+            baseUrl: "https://local-api.example.com",
+            questUrl: "https://local-quest.example.com",
+            questFront: "https://local-front.example.com",
+            recaptchaApiKey: "local-recaptcha-site-key",
+            isDist: false
+        };
+    }
+})();
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// tomlDocument is a parsed TOML file. Keys lists the keys of every table in
+// file order ("" for the root, "server" for [server]), since maps lose it.
+type tomlDocument struct {
+	Values map[string]interface{}
+	Keys   map[string][]string
+}
+
+// parseTOML parses a TOML document. Tables become map[string]interface{},
+// integers int64 and dates time.Time.
+func parseTOML(data []byte) (*tomlDocument, error) {
+	doc := &tomlDocument{Values: make(map[string]interface{}), Keys: make(map[string][]string)}
+	meta, err := toml.Decode(string(data), &doc.Values)
+	if err != nil {
+		return nil, err
+	}
+	// [a.b] and a.b = 1 define a in the root too
+	for _, key := range meta.Keys() {
+		for i, name := range key {
+			table := strings.Join(key[:i], ".")
+			if !slices.Contains(doc.Keys[table], name) {
+				doc.Keys[table] = append(doc.Keys[table], name)
+			}
+		}
+	}
+	return doc, nil
+}
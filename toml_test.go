@@ -0,0 +1,76 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTOML(t *testing.T) {
+	type m = map[string]interface{}
+	type l = []interface{}
+	for _, tt := range []struct {
+		name string
+		toml string
+		want m
+		keys map[string][]string
+		err  string
+	}{
+		{name: "empty", toml: "# nothing\n", want: m{}, keys: map[string][]string{}},
+		{
+			name: "strings",
+			toml: "a = \"tab\\there\" # comment\nb = 'C:\\path'\nc = \"\"\"\nline 1\nline 2\"\"\"\nd = '''# not a comment'''\n",
+			want: m{"a": "tab\there", "b": `C:\path`, "c": "line 1\nline 2", "d": "# not a comment"},
+			keys: map[string][]string{"": {"a", "b", "c", "d"}},
+		},
+		{
+			name: "numbers and bools",
+			toml: "int = 42\nsep = 1_000\nhex = 0x1F\nfloat = 1.5\non = true\n",
+			want: m{"int": int64(42), "sep": int64(1000), "hex": int64(31), "float": 1.5, "on": true},
+			keys: map[string][]string{"": {"int", "sep", "hex", "float", "on"}},
+		},
+		{
+			name: "dates",
+			toml: "at = 1979-05-27T07:32:00Z\n",
+			want: m{"at": time.Date(1979, 5, 27, 7, 32, 0, 0, time.UTC)},
+			keys: map[string][]string{"": {"at"}},
+		},
+		{
+			name: "tables keep their key order",
+			toml: "env = \"x\"\n[server]\nvault = \"v\"\nquest = \"q\"\n\"admin.api\" = \"a\"\n[firebase.options]\nkey = \"k\"\n",
+			want: m{"env": "x", "server": m{"vault": "v", "quest": "q", "admin.api": "a"}, "firebase": m{"options": m{"key": "k"}}},
+			keys: map[string][]string{"": {"env", "server", "firebase"}, "server": {"vault", "quest", "admin.api"}, "firebase": {"options"}, "firebase.options": {"key"}},
+		},
+		{
+			name: "dotted keys, inline tables and arrays",
+			toml: "google.maps = \"m\"\nflow = [\"x\", 3]\npoint = { x = 1, y = 2 }\n[[servers]]\nname = \"a\"\n",
+			want: m{"google": m{"maps": "m"}, "flow": l{"x", int64(3)}, "point": m{"x": int64(1), "y": int64(2)}, "servers": []map[string]interface{}{{"name": "a"}}},
+			keys: map[string][]string{"": {"google", "flow", "point", "servers"}, "google": {"maps"}, "point": {"x", "y"}, "servers": {"name"}},
+		},
+		{name: "duplicate key", toml: "a = \"x\"\na = \"y\"\n", err: "line 2"},
+		{name: "table over a value", toml: "a = \"x\"\n[a]\n", err: "line 2"},
+		{name: "trailing text", toml: "a = \"x\" b\n", err: "line 1"},
+		{name: "unclosed string", toml: "a = \"open\n", err: "line 1"},
+		{name: "bare value", toml: "a = nope\n", err: "line 1"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := parseTOML([]byte(tt.toml))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(doc.Values, tt.want) {
+				t.Errorf("got %#v\nwant %#v", doc.Values, tt.want)
+			}
+			if !reflect.DeepEqual(doc.Keys, tt.keys) {
+				t.Errorf("keys = %v, want %v", doc.Keys, tt.keys)
+			}
+		})
+	}
+}
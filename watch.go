@@ -0,0 +1,202 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// fileStamp is what the watcher compares to notice a file change
+type fileStamp struct {
+	exists  bool
+	modTime time.Time
+	size    int64
+}
+
+// stampFiles takes the current stamp of every watched file
+func stampFiles(paths []string) map[string]fileStamp {
+	stamps := make(map[string]fileStamp, len(paths))
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[path] = fileStamp{true, info.ModTime(), info.Size()}
+		} else {
+			stamps[path] = fileStamp{}
+		}
+	}
+	return stamps
+}
+
+func stampsEqual(a, b map[string]fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, stamp := range a {
+		other, ok := b[path]
+		if !ok || stamp.exists != other.exists || stamp.size != other.size || !stamp.modTime.Equal(other.modTime) {
+			return false
+		}
+	}
+	return true
+}
+
+// watchEvent is the --output json line of one watch run
+type watchEvent struct {
+	Time         time.Time `json:"time"`
+	Env          string    `json:"env"`
+	Changed      bool      `json:"changed"`
+	ChangedLines int       `json:"changedLines"`
+}
+
+// runWatch implements `envswitch watch`: it re-applies the env to the target
+// whenever the config file (or the secrets keyfile) changes
+func runWatch(args []string) error {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	flags := addEnvFlags(fs)
+	hooks := addHookFlags(fs)
+	confirmProtected := addProtectedFlag(fs)
+	isDist := fs.Bool("dist", false, "Set isDist to true")
+	debounce := fs.Duration("debounce", 300*time.Millisecond, "Wait until the files are quiet for this long before re-applying")
+	interval := fs.Duration("interval", 200*time.Millisecond, "How often the watched files are checked")
+	savedHooks := fs.Bool("hooks", false, "Run the app's saved hooks on every re-apply")
+
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if *flags.env == "" && len(positional) > 0 {
+		*flags.env = positional[0]
+	}
+	if err := flags.resolve(fs); err != nil {
+		return err
+	}
+	if *flags.env == "" {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch watch --env <env> [--app name] [--config-dir dir] [--target file] [--js] [--format f]"))
+	}
+
+	opts := flags.switchOptions()
+	opts.IsDist = *isDist
+	saved := flags.saved
+	if !*savedHooks {
+		// A saved `npm run build` hook shouldn't fire on every save
+		saved.PreSwitch, saved.PostSwitch, saved.untrustedHooks = nil, nil, false
+	}
+	opts.Hooks = hooks.config(saved)
+	opts.Source = sourceWatch
+	opts.ConfirmProtected = *confirmProtected
+
+	watched := watchedFiles(opts)
+	log := logOutput()
+	fmt.Fprintf(log, "👀 Watching %s for environment: %s\n", watched[0], opts.Env)
+	fmt.Fprintf(log, "   Target: %s\n", opts.TargetPath)
+	if len(flags.saved.PreSwitch)+len(flags.saved.PostSwitch) > 0 && !*savedHooks {
+		fmt.Fprintln(log, "   Saved hooks are skipped while watching (--hooks runs them on every re-apply)")
+	}
+	fmt.Fprintln(log, "   Press Ctrl+C to stop")
+	if jsonOutput() {
+		// Hook output would break the JSON lines on stdout
+		opts.Output = os.Stderr
+	}
+
+	// Every run prints one line: text, or JSON with --output json
+	report := func(plan *switchPlan, err error, line string) {
+		if !jsonOutput() {
+			fmt.Println(line)
+			return
+		}
+		event := watchEvent{Time: time.Now(), Env: opts.Env}
+		if err == nil {
+			event.Changed = plan.Result != plan.Original
+			event.ChangedLines = len(diffLines(plan.Original, plan.Result, nil))
+		}
+		printJSON("watch", event, nil, err)
+	}
+
+	apply := func() {
+		stamp := time.Now().Format("15:04:05")
+		plan, err := planSwitch(opts)
+		if err != nil {
+			// Keep watching: the next save may fix it
+			report(nil, err, fmt.Sprintf("✗ %s %v", stamp, err))
+			return
+		}
+		if plan.Result == plan.Original {
+			report(plan, nil, fmt.Sprintf("· %s no changes", stamp))
+			return
+		}
+		if err := executePlan(opts, plan); err != nil {
+			report(nil, err, fmt.Sprintf("✗ %s %v", stamp, err))
+			return
+		}
+		report(plan, nil, fmt.Sprintf("✓ %s re-applied %s", stamp, opts.Env))
+	}
+
+	apply()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	watchFiles(watched, *interval, *debounce, apply, interrupt)
+	fmt.Fprintln(log, "\n👋 Stopped watching")
+	return nil
+}
+
+// watchedFiles lists the files a watch re-applies on: the env config first
+func watchedFiles(opts switchOptions) []string {
+	watched := []string{envConfigPath(opts.ConfigDir, opts.Env, opts.ConfigType)}
+	if opts.ConfigType == configTypeJSEval {
+		// The files an evaluated config may require, but not the target
+		// when it lives next to them
+		target, _ := filepath.Abs(opts.TargetPath)
+		for _, pattern := range []string{"*.js", "*.cjs", "*.mjs", "*.json"} {
+			paths, _ := filepath.Glob(filepath.Join(opts.ConfigDir, pattern))
+			for _, path := range paths {
+				if abs, _ := filepath.Abs(path); abs == target {
+					continue
+				}
+				if !slices.Contains(watched, path) {
+					watched = append(watched, path)
+				}
+			}
+		}
+	}
+	if opts.Template != "" {
+		watched = append(watched, opts.Template)
+	}
+	if opts.KeyFile != "" {
+		watched = append(watched, opts.KeyFile)
+	} else if os.Getenv(secretKeyEnvVar) == "" {
+		watched = append(watched, getKeyPath())
+	}
+	return watched
+}
+
+// watchFiles checks the files every interval and calls apply once they
+// changed and stayed quiet for debounce, until stop receives
+func watchFiles(watched []string, interval, debounce time.Duration, apply func(), stop <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	last := stampFiles(watched)
+	var changedAt time.Time
+	for {
+		select {
+		case <-stop:
+			return
+		case now := <-ticker.C:
+			if current := stampFiles(watched); !stampsEqual(current, last) {
+				last = current
+				changedAt = now
+				continue
+			}
+			if !changedAt.IsZero() && now.Sub(changedAt) >= debounce {
+				changedAt = time.Time{}
+				apply()
+				// Re-stamp so our own writes (and hook side effects) don't trigger another run
+				last = stampFiles(watched)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Saves in a burst are re-applied once, and what apply itself writes doesn't
+// trigger another run
+func TestWatchFiles(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.test.json")
+	os.WriteFile(config, []byte("{}"), 0644)
+
+	applied := make(chan struct{}, 10)
+	apply := func() {
+		// Like a hook that touches a watched file
+		os.WriteFile(config, []byte(`{"applied": true}`), 0644)
+		applied <- struct{}{}
+	}
+	stop := make(chan os.Signal)
+	done := make(chan struct{})
+	go func() {
+		watchFiles([]string{config}, 10*time.Millisecond, 150*time.Millisecond, apply, stop)
+		close(done)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	for i := 1; i <= 3; i++ {
+		os.WriteFile(config, []byte(strings.Repeat(" ", i)+"{}"), 0644)
+		time.Sleep(40 * time.Millisecond)
+	}
+	select {
+	case <-applied:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not re-applied after the saves")
+	}
+	select {
+	case <-applied:
+		t.Fatal("re-applied more than once for a burst of saves, or for its own write")
+	case <-time.After(400 * time.Millisecond):
+	}
+
+	os.WriteFile(config, []byte(`{"saved": "again"}`), 0644)
+	select {
+	case <-applied:
+	case <-time.After(2 * time.Second):
+		t.Fatal("not re-applied after the next save")
+	}
+
+	close(stop)
+	<-done
+}
+
+// The target is not watched, even next to the files a js-eval config requires
+func TestWatchedFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"config.test.js", "shared.js", "serverConfig.js", "notes.txt"} {
+		os.WriteFile(filepath.Join(dir, name), nil, 0644)
+	}
+	keyFile := filepath.Join(dir, "keys", "secret.key")
+	opts := switchOptions{
+		ConfigDir:  dir,
+		ConfigType: configTypeJSEval,
+		Env:        "test",
+		TargetPath: filepath.Join(dir, "serverConfig.js"),
+		KeyFile:    keyFile,
+	}
+
+	want := []string{filepath.Join(dir, "config.test.js"), filepath.Join(dir, "shared.js"), keyFile}
+	if got := watchedFiles(opts); !slices.Equal(got, want) {
+		t.Errorf("watched = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// workspaceFileNames are looked up in the cwd and every parent directory
+var workspaceFileNames = []string{".envswitch.yaml", ".envswitch.yml"}
+
+// Workspace is a repo-local .envswitch.yaml declaring the apps of a repository.
+// Paths in it are relative to the directory that holds the file.
+//
+//	apps:
+//	  The Vault:
+//	    configDir: gulp/configs
+//	    targetPath: app/env.js
+//	    format: envJs
+//	    configType: js
+//
+//	profiles:
+//	  fullstack-stress: {The Vault: stress, Backoffice: stress}
+//
+// Hooks of a workspace file only run once the user trusted that exact content
+// with `envswitch workspace trust`, since they come from whoever wrote the repo.
+type Workspace struct {
+	Path     string                       `json:"-"` // the .envswitch.yaml file
+	Root     string                       `json:"-"` // the directory paths are relative to
+	Hash     string                       `json:"-"` // SHA-256 of the file, for trust
+	Apps     map[string]AppConfig         `json:"apps"`
+	Profiles map[string]map[string]string `json:"profiles"`
+}
+
+// findWorkspace walks up from the cwd to the first .envswitch.yaml.
+// It returns nil (and no error) when there is none.
+func findWorkspace() (*Workspace, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, nil
+	}
+
+	for {
+		for _, name := range workspaceFileNames {
+			path := filepath.Join(dir, name)
+			if _, err := os.Stat(path); err == nil {
+				return loadWorkspace(path)
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return nil, nil
+		}
+		dir = parent
+	}
+}
+
+// loadWorkspace parses a workspace file and resolves its paths
+func loadWorkspace(path string) (*Workspace, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	// The YAML tree maps onto the same JSON field names as the saved settings file
+	raw, err := json.Marshal(tree)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	ws := &Workspace{}
+	if err := json.Unmarshal(raw, ws); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	ws.Path = path
+	ws.Root = filepath.Dir(path)
+	sum := sha256.Sum256(data)
+	ws.Hash = hex.EncodeToString(sum[:])
+	for name, app := range ws.Apps {
+		app.ConfigDir = ws.resolvePath(app.ConfigDir)
+		app.TargetPath = ws.resolvePath(app.TargetPath)
+		app.Template = ws.resolvePath(app.Template)
+		app.KeyFile = ws.resolvePath(app.KeyFile)
+		app.workspace = path
+		ws.Apps[name] = app
+	}
+	return ws, nil
+}
+
+// resolvePath anchors a workspace-relative path at the workspace root
+func (ws *Workspace) resolvePath(path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(ws.Root, filepath.FromSlash(path))
+}
+
+// trusted reports whether the user trusted the current content of the file
+func (ws *Workspace) trusted(config PersistentConfig) bool {
+	return config.TrustedWorkspaces[ws.Path] == ws.Hash
+}
+
+// hookCommands lists the hooks the file declares, as "app: stage: command"
+func (ws *Workspace) hookCommands() []string {
+	commands := make([]string, 0)
+	for name, app := range ws.Apps {
+		for _, hook := range app.hookList() {
+			commands = append(commands, name+": "+hook)
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// apps returns the workspace apps as they apply for config: without their
+// hooks unless the file is trusted
+func (ws *Workspace) apps(config PersistentConfig) map[string]AppConfig {
+	if ws.trusted(config) {
+		return ws.Apps
+	}
+	apps := make(map[string]AppConfig, len(ws.Apps))
+	for name, app := range ws.Apps {
+		if len(app.PreSwitch) > 0 || len(app.PostSwitch) > 0 {
+			app.PreSwitch, app.PostSwitch = nil, nil
+			app.untrustedHooks = true
+		}
+		apps[name] = app
+	}
+	return apps
+}
+
+// untrustedWorkspace returns the workspace file whose hooks the app lost
+// because the file isn't trusted ("" when there are none)
+func untrustedWorkspace(app AppConfig) string {
+	if !app.untrustedHooks {
+		return ""
+	}
+	return app.workspace
+}
+
+// warnUntrustedHooks tells that the hooks of an untrusted workspace were skipped
+func warnUntrustedHooks(opts switchOptions) {
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, "⚠️  Skipped the hooks of %s: review them, then run `envswitch workspace trust`\n", opts.Hooks.Untrusted)
+}
+
+// merge layers the personal settings on top of the workspace apps: personal
+// entries only override the fields they set (e.g. lastEnv)
+func (ws *Workspace) merge(config PersistentConfig) PersistentConfig {
+	merged := config
+	merged.Apps = make(map[string]AppConfig)
+	for name, app := range config.Apps {
+		merged.Apps[name] = app
+	}
+	for name, app := range ws.apps(config) {
+		if personal, exists := config.Apps[name]; exists {
+			app = overlayApp(app, personal)
+		}
+		merged.Apps[name] = app
+	}
+
+	// Personal profiles win over workspace profiles with the same name
+	if len(ws.Profiles) > 0 || len(config.Profiles) > 0 {
+		merged.Profiles = make(map[string]map[string]string)
+		for name, apps := range ws.Profiles {
+			merged.Profiles[name] = apps
+		}
+		for name, apps := range config.Profiles {
+			merged.Profiles[name] = apps
+		}
+	}
+	return merged
+}
+
+// strip reduces workspace apps to the fields that differ from the workspace
+// (plus lastEnv), so only per-user overrides end up in the personal file
+func (ws *Workspace) strip(config PersistentConfig) PersistentConfig {
+	stripped := config
+	stripped.Apps = make(map[string]AppConfig)
+	for name, app := range config.Apps {
+		if base, exists := ws.Apps[name]; exists {
+			// Compare with what the app was merged from: hooks skipped by an
+			// untrusted file are no personal override, even once it is trusted
+			if app.untrustedHooks {
+				base.PreSwitch, base.PostSwitch = nil, nil
+			}
+			app = diffApp(app, base)
+		}
+		stripped.Apps[name] = app
+	}
+
+	stripped.Profiles = nil
+	for name, apps := range config.Profiles {
+		if !reflect.DeepEqual(apps, ws.Profiles[name]) {
+			if stripped.Profiles == nil {
+				stripped.Profiles = make(map[string]map[string]string)
+			}
+			stripped.Profiles[name] = apps
+		}
+	}
+	return stripped
+}
+
+// appFields returns the JSON fields of an app as a map
+func appFields(app AppConfig) map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, _ := json.Marshal(app)
+	json.Unmarshal(data, &fields)
+	return fields
+}
+
+// UnmarshalJSON decodes an app and remembers which fields the JSON set
+func (a *AppConfig) UnmarshalJSON(data []byte) error {
+	type plain AppConfig
+	if err := json.Unmarshal(data, (*plain)(a)); err != nil {
+		return err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	a.setFields = make([]string, 0, len(raw))
+	for key := range raw {
+		a.setFields = append(a.setFields, key)
+	}
+	sort.Strings(a.setFields)
+	return nil
+}
+
+// MarshalJSON encodes an app, writing the fields it was read with even when
+// they are empty (omitempty would drop an override like skipWorktree: false)
+func (a AppConfig) MarshalJSON() ([]byte, error) {
+	type plain AppConfig
+	data, err := json.Marshal(plain(a))
+	if err != nil || len(a.setFields) == 0 {
+		return data, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	missing := false
+	for _, key := range a.setFields {
+		if _, exists := fields[key]; !exists {
+			if zero, ok := appZeroValue(key); ok {
+				fields[key] = zero
+				missing = true
+			}
+		}
+	}
+	if !missing {
+		return data, nil
+	}
+	return json.Marshal(fields)
+}
+
+// appZeroValue returns the JSON of the empty value of an AppConfig field
+func appZeroValue(key string) (json.RawMessage, bool) {
+	field, ok := appField(key)
+	if !ok {
+		return nil, false
+	}
+	zero, err := json.Marshal(reflect.Zero(field.Type).Interface())
+	return zero, err == nil
+}
+
+// appOmitsEmpty reports whether an AppConfig field is left out when empty, so
+// an empty value in a file was written on purpose
+func appOmitsEmpty(key string) bool {
+	field, ok := appField(key)
+	return ok && strings.Contains(field.Tag.Get("json"), ",omitempty")
+}
+
+// appField looks up an AppConfig field by its JSON name
+func appField(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(AppConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ","); name == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// isEmptyField reports whether a decoded JSON field is empty (null, false, 0,
+// "" or [])
+func isEmptyField(value interface{}) bool {
+	if list, ok := value.([]interface{}); ok {
+		return len(list) == 0
+	}
+	return value == nil || reflect.ValueOf(value).IsZero()
+}
+
+// overlayApp sets the fields of override on top of base: the non-empty
+// fields, plus the empty ones its JSON set explicitly (skipWorktree: false).
+// Fields that are always written (configDir, lastEnv...) only count when set.
+func overlayApp(base, override AppConfig) AppConfig {
+	fields := appFields(override)
+	for key, value := range fields {
+		explicit := override.setFields != nil && slices.Contains(override.setFields, key) && appOmitsEmpty(key)
+		if isEmptyField(value) && !explicit {
+			delete(fields, key)
+		}
+	}
+	setFields := base.setFields
+	data, _ := json.Marshal(fields)
+	json.Unmarshal(data, &base)
+	for _, key := range setFields {
+		if !slices.Contains(base.setFields, key) {
+			base.setFields = append(base.setFields, key)
+		}
+	}
+	sort.Strings(base.setFields)
+	return base
+}
+
+// diffApp keeps only the fields of app that differ from base (and lastEnv).
+// A field of base that app cleared is kept as an explicit empty value.
+func diffApp(app, base AppConfig) AppConfig {
+	fields := appFields(app)
+	baseFields := appFields(base)
+	for key, value := range baseFields {
+		if _, exists := fields[key]; !exists && !isEmptyField(value) {
+			fields[key] = nil
+		}
+	}
+	for key, value := range fields {
+		if key != "lastEnv" && reflect.DeepEqual(value, baseFields[key]) {
+			delete(fields, key)
+		}
+	}
+
+	var diff AppConfig
+	data, _ := json.Marshal(fields)
+	json.Unmarshal(data, &diff)
+	return diff
+}
+
+// workspaceStatus is the --output json result of `workspace status`
+type workspaceStatus struct {
+	Path    string   `json:"path"`
+	Trusted bool     `json:"trusted"`
+	Hooks   []string `json:"hooks"`
+}
+
+// runWorkspace implements `envswitch workspace status|trust|untrust`
+func runWorkspace(args []string) error {
+	if len(args) == 0 {
+		return withCode(codeUsage, fmt.Errorf("usage: envswitch workspace status|trust|untrust"))
+	}
+
+	fs := flag.NewFlagSet("workspace "+args[0], flag.ContinueOnError)
+	addStoreFlag(fs)
+	addOutputFlag(fs)
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return withCode(codeUsage, err)
+	}
+	ws, err := findWorkspace()
+	if err != nil {
+		return err
+	}
+	if ws == nil {
+		return fmt.Errorf("no .envswitch.yaml in this directory or its parents")
+	}
+	config, err := loadPersonalConfig(true)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "status":
+		status := workspaceStatus{ws.Path, ws.trusted(config), ws.hookCommands()}
+		if jsonOutput() {
+			return printJSON("workspace", status, nil, nil)
+		}
+		fmt.Printf("Workspace: %s\n", status.Path)
+		switch {
+		case len(status.Hooks) == 0:
+			fmt.Println("No hooks")
+		case status.Trusted:
+			fmt.Println("Trusted: its hooks run on switches")
+		default:
+			fmt.Println("Not trusted: its hooks are skipped until you run `envswitch workspace trust`")
+		}
+		for _, hook := range status.Hooks {
+			fmt.Printf("  %s\n", hook)
+		}
+		return nil
+
+	case "trust", "untrust":
+		_, err := updatePersistentConfig(func(config *PersistentConfig) error {
+			if args[0] == "untrust" {
+				delete(config.TrustedWorkspaces, ws.Path)
+				return nil
+			}
+			if config.TrustedWorkspaces == nil {
+				config.TrustedWorkspaces = make(map[string]string)
+			}
+			config.TrustedWorkspaces[ws.Path] = ws.Hash
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if args[0] == "untrust" {
+			return printDone("workspace", "Hooks of "+ws.Path+" are skipped again")
+		}
+		// Trust covers this exact content: any edit to the file needs a new trust
+		return printDone("workspace", "Trusted "+ws.Path+" (until it changes); its hooks now run:", ws.hookCommands()...)
+
+	default:
+		return fmt.Errorf("unknown workspace command '%s' (use status, trust or untrust)", args[0])
+	}
+}
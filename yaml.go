@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML parses a YAML document. Mappings become map[string]interface{},
+// sequences []interface{}, like encoding/json decodes them. A number only
+// stays a number when it reads back the same: 012345, +5 or 1_000 stay
+// strings, so an id or a zip code isn't rewritten.
+func parseYAML(data []byte) (interface{}, error) {
+	root, err := yamlRoot(data)
+	if err != nil || root == nil {
+		return map[string]interface{}{}, err
+	}
+	return yamlValue(root)
+}
+
+// yamlRoot returns the top node of a YAML document (nil when it is empty)
+func yamlRoot(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil
+	}
+	return doc.Content[0], nil
+}
+
+// yamlValue converts a node to the map/slice/scalar tree parseYAML returns
+func yamlValue(node *yaml.Node) (interface{}, error) {
+	switch node.Kind {
+	case yaml.AliasNode:
+		return yamlValue(node.Alias)
+	case yaml.SequenceNode:
+		items := make([]interface{}, 0, len(node.Content))
+		for _, child := range node.Content {
+			item, err := yamlValue(child)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case yaml.MappingNode:
+		return yamlMapping(node)
+	case yaml.ScalarNode:
+		return yamlScalar(node), nil
+	}
+	return nil, fmt.Errorf("line %d: unsupported YAML node", node.Line)
+}
+
+// yamlMapping converts a mapping, with its << merge keys
+func yamlMapping(node *yaml.Node) (map[string]interface{}, error) {
+	values := make(map[string]interface{}, len(node.Content)/2)
+	merged := make(map[string]interface{})
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d: mapping keys must be scalars", key.Line)
+		}
+		if key.ShortTag() == "!!merge" {
+			if err := yamlMerge(merged, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if _, exists := values[key.Value]; exists {
+			return nil, fmt.Errorf("line %d: key %q is defined twice", key.Line, key.Value)
+		}
+		converted, err := yamlValue(value)
+		if err != nil {
+			return nil, err
+		}
+		values[key.Value] = converted
+	}
+	// Keys of the mapping itself win over merged ones
+	for key, value := range merged {
+		if _, exists := values[key]; !exists {
+			values[key] = value
+		}
+	}
+	return values, nil
+}
+
+// yamlMerge adds the mapping (or sequence of mappings) of a << key to merged;
+// earlier mappings of a sequence win
+func yamlMerge(merged map[string]interface{}, node *yaml.Node) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	sources := []*yaml.Node{node}
+	if node.Kind == yaml.SequenceNode {
+		sources = node.Content
+	}
+	for _, source := range sources {
+		value, err := yamlValue(source)
+		if err != nil {
+			return err
+		}
+		mapping, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("line %d: << needs a mapping", source.Line)
+		}
+		for key, v := range mapping {
+			if _, exists := merged[key]; !exists {
+				merged[key] = v
+			}
+		}
+	}
+	return nil
+}
+
+// yamlScalar converts a scalar to string, bool, int64, float64 or nil
+func yamlScalar(node *yaml.Node) interface{} {
+	switch node.ShortTag() {
+	case "!!null":
+		return nil
+	case "!!bool":
+		var b bool
+		if node.Decode(&b) == nil {
+			return b
+		}
+	case "!!int":
+		if n, err := strconv.ParseInt(node.Value, 10, 64); err == nil && strconv.FormatInt(n, 10) == node.Value {
+			return n
+		}
+	case "!!float":
+		f, err := strconv.ParseFloat(node.Value, 64)
+		if err == nil && !math.IsInf(f, 0) && strconv.FormatFloat(f, 'f', -1, 64) == node.Value {
+			return f
+		}
+	}
+	return node.Value
+}
+
+// yamlServerKeys returns the keys of the top-level server mapping in file order
+func yamlServerKeys(data []byte) []string {
+	root, err := yamlRoot(data)
+	if err != nil || root == nil || root.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		server := root.Content[i+1]
+		if root.Content[i].Value != "server" || server.Kind != yaml.MappingNode {
+			continue
+		}
+		keys := make([]string, 0, len(server.Content)/2)
+		for j := 0; j < len(server.Content); j += 2 {
+			keys = append(keys, server.Content[j].Value)
+		}
+		return keys
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	type m = map[string]interface{}
+	type l = []interface{}
+	for _, tt := range []struct {
+		name string
+		yaml string
+		want interface{}
+		err  string
+	}{
+		{name: "empty", yaml: "# nothing\n", want: m{}},
+		{name: "strings", yaml: "a: plain text\nb: 'it''s'\nc: \"tab\\there\"\n", want: m{"a": "plain text", "b": "it's", "c": "tab\there"}},
+		{name: "numbers", yaml: "int: 42\nnegative: -7\nfloat: 1.5\n", want: m{"int": int64(42), "negative": int64(-7), "float": 1.5}},
+		{
+			name: "non-canonical numbers stay strings",
+			yaml: "zip: 012345\nplus: +5\nsep: 1_000\nhex: 0x1F\noctal: 0o17\ntrailing: 1.50\nexp: 1e3\ninf: .inf\n",
+			want: m{"zip": "012345", "plus": "+5", "sep": "1_000", "hex": "0x1F", "octal": "0o17", "trailing": "1.50", "exp": "1e3", "inf": ".inf"},
+		},
+		{name: "quoted numbers", yaml: "a: \"42\"\nb: '1.5'\n", want: m{"a": "42", "b": "1.5"}},
+		{name: "bools and nulls", yaml: "a: true\nb: False\nc: yes\nd: null\ne: ~\nf:\n", want: m{"a": true, "b": false, "c": "yes", "d": nil, "e": nil, "f": nil}},
+		{name: "timestamps stay strings", yaml: "date: 2024-01-02\n", want: m{"date": "2024-01-02"}},
+		{
+			name: "nested",
+			yaml: "server:\n  vault: https://v.example.com # comment\n  list:\n    - a\n    - {b: 1}\nflow: [x, 'y', 3]\n",
+			want: m{"server": m{"vault": "https://v.example.com", "list": l{"a", m{"b": int64(1)}}}, "flow": l{"x", "y", int64(3)}},
+		},
+		{name: "block scalars", yaml: "literal: |\n  line 1\n  line 2\nfolded: >\n  one\n  two\n", want: m{"literal": "line 1\nline 2\n", "folded": "one two\n"}},
+		{
+			name: "anchors and merge keys",
+			yaml: "base: &base\n  server: https://base.example.com\n  walkmeUrl: w\nstress:\n  <<: *base\n  server: https://stress.example.com\ncopy: *base\n",
+			want: m{
+				"base":   m{"server": "https://base.example.com", "walkmeUrl": "w"},
+				"stress": m{"server": "https://stress.example.com", "walkmeUrl": "w"},
+				"copy":   m{"server": "https://base.example.com", "walkmeUrl": "w"},
+			},
+		},
+		{name: "top-level list", yaml: "- a\n- b\n", want: l{"a", "b"}},
+		{name: "duplicate key", yaml: "a: 1\nb: 2\na: 3\n", err: `line 3: key "a" is defined twice`},
+		{name: "bad indentation", yaml: "a:\n  b: 1\n c: 2\n", err: "did not find expected key"},
+		{name: "unclosed quote", yaml: "a: \"open\n", err: "yaml:"},
+		{name: "unclosed flow", yaml: "a: [1, 2\n", err: "yaml:"},
+		{name: "merge of a scalar", yaml: "a:\n  <<: 1\n", err: "<< needs a mapping"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.yaml))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestYAMLServerKeys(t *testing.T) {
+	for _, tt := range []struct {
+		yaml string
+		want []string
+	}{
+		{"server:\n  vault: v\n  quest: q\n  admin: a\n", []string{"vault", "quest", "admin"}},
+		{"env: x\nserver: {quest: q, vault: v}\n", []string{"quest", "vault"}},
+		{"server: https://api.example.com\n", nil},
+		{"- server\n", nil},
+	} {
+		if got := yamlServerKeys([]byte(tt.yaml)); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: keys = %v, want %v", tt.yaml, got, tt.want)
+		}
+	}
+}